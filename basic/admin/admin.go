@@ -0,0 +1,508 @@
+// Package admin is the operator's view of the server: who is connected,
+// what was submitted lately and how the process is doing, with keys to
+// disconnect a session, to announce something to everyone, to restore
+// submissions from the trash and to move orders along. Bulk changes are
+// previewed in a dry run before they are made. Directories the operator
+// shares can be looked through, read-only, on the files page.
+package admin
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jwc20/wish-bubbletea-tests/basic/breaker"
+	"github.com/jwc20/wish-bubbletea-tests/basic/grid"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessions"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// refreshEvery is how often the view reloads on its own
+const refreshEvery = 2 * time.Second
+
+// recentSubmissions is how many submissions the view shows
+const recentSubmissions = 8
+
+// Server is what the admin view looks at
+type Server struct {
+	Sessions    *sessions.Registry
+	Submissions *storage.Store
+	Started     time.Time
+	// Broadcast shows text as a banner in every session, empty text clears it
+	// It returns how many sessions it reached
+	Broadcast func(text string) int
+	// Queued reports how many connections are waiting for a slot, nil when there's no limit
+	Queued func() int
+	// Retention is how long submissions stay in the trash before they're purged
+	Retention time.Duration
+	// Breakers reports how each integration is doing, nil when there are none
+	Breakers func() []breaker.Status
+	// Admin is who's using the view, recorded on the order events they add
+	Admin string
+	// Audit records what the admin changed, e.g. restoring someone's submission
+	Audit func(action, target, detail string)
+	// Dirs are shown on the files page
+	Dirs []Dir
+	// DownloadHint is where the files can be downloaded from, e.g. an SFTP
+	// URL, with {path} for the file's path under its directory's name
+	DownloadHint string
+	// LockAfter is how long the view can sit without a keypress before it
+	// locks, zero to never lock
+	LockAfter time.Duration
+	// Unlock checks the admin's authenticator code, nil when they have no
+	// second factor and any key unlocks
+	Unlock func(code string) bool
+	// IdleTimeout closes the view after this long without a keypress, with a
+	// warning a minute before, zero to keep it open
+	IdleTimeout time.Duration
+}
+
+// page is what the view lists under the server stats
+type page int
+
+const (
+	pageSessions page = iota
+	pageTrash
+	pageOrders
+	pageFiles
+)
+
+// snapshot is one load of everything the view shows
+type snapshot struct {
+	sessions   []sessions.Info
+	recent     []storage.Submission
+	trash      []storage.Submission
+	orders     []orders.Order
+	skipped    int // order events that couldn't be applied, see orders.Project
+	err        error
+	uptime     time.Duration
+	goroutines int
+	heap       uint64
+	queued     int
+	breakers   []breaker.Status
+	files      []file // only listed while the files page is open
+}
+
+type snapshotMsg snapshot
+
+type tickMsg struct{}
+
+// Model is the admin view
+type Model struct {
+	srv  Server
+	self uint64 // the admin's own session, which can't be kicked from here
+	f    l10n.Formatter
+	snap snapshot
+	page page
+	// sessionTable and orderTable list the sessions and orders, trashCursor
+	// is the selected row of the trash
+	sessionTable grid.Model[sessions.Info]
+	orderTable   grid.Model[orders.Order]
+	trashCursor  int
+	// fileTable is the files page's tree, with the directories in expanded
+	// open, and filePreview shows the start of the file previewing
+	fileTable   grid.Model[file]
+	expanded    map[string]bool
+	filePreview viewport.Model
+	previewing  string
+	status      string
+	// composing is true while typing an announcement into announce
+	composing bool
+	announce  textinput.Model
+	// dryRun previews bulk changes before making them, pending is the one
+	// being previewed in preview
+	dryRun  bool
+	pending *plan
+	preview table.Model
+	// locked hides everything after Server.LockAfter without a keypress, see lock.go
+	// lastActive starts when the view opens, keys typed while locked count too
+	locked     bool
+	lastActive time.Time
+	unlock     textinput.Model
+	unlockErr  string
+	// unlockTries counts wrong codes since the view was last unlocked
+	unlockTries int
+	// idleWarned shows the warning that the view is about to close, see idle.go
+	idleWarned bool
+
+	title    lipgloss.Style
+	faint    lipgloss.Style
+	selected lipgloss.Style
+}
+
+// New creates the admin view for the session self, rendering through r
+// and writing numbers and times with f
+func New(r *lipgloss.Renderer, srv Server, self uint64, f l10n.Formatter) Model {
+	announce := textinput.New()
+	announce.Placeholder = "server restarting in 5 minutes (empty clears)"
+	announce.Width = 50
+	m := Model{
+		srv:      srv,
+		announce: announce,
+		dryRun:   true,
+		unlock:   newUnlockInput(),
+		self:     self,
+		// The first checks are LockAfter and IdleTimeout after the view opens
+		lastActive: time.Now(),
+		f:          f,
+		title:      r.NewStyle().Bold(true),
+		faint:      r.NewStyle().Faint(true),
+		selected:   r.NewStyle().Reverse(true),
+	}
+	styles := grid.Styles{Header: m.title, Focused: m.title.Underline(true), Selected: m.selected, Faint: m.faint}
+	m.sessionTable = newSessionTable(self, styles)
+	m.orderTable = newOrderTable(f, styles)
+	m.fileTable = newFileTable(srv.Dirs, f.Date, styles)
+	m.filePreview = viewport.New(40, fileRows+1)
+	return m
+}
+
+func (m Model) Init() tea.Cmd {
+	cmds := []tea.Cmd{m.load, tick()}
+	if m.srv.LockAfter > 0 {
+		cmds = append(cmds, lockTick(m.srv.LockAfter))
+	}
+	if m.srv.IdleTimeout > 0 {
+		cmds = append(cmds, idleTick(max(m.srv.IdleTimeout-idleWarning, 0)))
+	}
+	return tea.Batch(cmds...)
+}
+
+// load reads the registry, the database and the runtime in the background
+func (m Model) load() tea.Msg {
+	snap := snapshot{
+		sessions:   m.srv.Sessions.List(),
+		uptime:     time.Since(m.srv.Started).Round(time.Second),
+		goroutines: runtime.NumGoroutine(),
+	}
+	if m.srv.Queued != nil {
+		snap.queued = m.srv.Queued()
+	}
+	if m.srv.Breakers != nil {
+		snap.breakers = m.srv.Breakers()
+	}
+	snap.recent, snap.err = m.srv.Submissions.Recent(recentSubmissions)
+	if snap.err == nil {
+		snap.trash, snap.err = m.srv.Submissions.TrashAll()
+	}
+	if snap.err == nil {
+		var events []orders.Event
+		if events, snap.err = m.srv.Submissions.Events(0); snap.err == nil {
+			var errs []error
+			snap.orders, errs = orders.Project(events)
+			snap.skipped = len(errs)
+		}
+	}
+	if m.page == pageFiles {
+		snap.files = m.listFiles()
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	snap.heap = mem.HeapAlloc
+	return snapshotMsg(snap)
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshEvery, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case snapshotMsg:
+		m.snap = snapshot(msg)
+		m.sessionTable = m.sessionTable.SetRows(m.snap.sessions)
+		m.orderTable = m.orderTable.SetRows(m.snap.orders)
+		m.trashCursor = min(m.trashCursor, max(len(m.snap.trash)-1, 0))
+		if m.page == pageFiles {
+			m.fileTable = m.fileTable.SetRows(m.snap.files)
+			return m.followSelection()
+		}
+	case previewMsg:
+		if msg.key == m.previewing {
+			m.filePreview.SetContent(msg.text)
+		}
+	case tea.WindowSizeMsg:
+		m.sessionTable = m.sessionTable.SetSize(msg.Width, tableRows)
+		m.orderTable = m.orderTable.SetSize(msg.Width, tableRows)
+		m = m.sizeFiles(msg.Width)
+	case tickMsg:
+		// Nothing shows while locked or warned, so there's nothing to reload
+		if m.locked || m.idleWarned {
+			return m, tick()
+		}
+		return m, tea.Batch(m.load, tick())
+	case lockMsg:
+		return m.checkLock(msg)
+	case idleMsg:
+		return m.checkIdle(msg)
+	case tea.KeyMsg:
+		m.lastActive = time.Now()
+		// The key that answers the idle warning does nothing else
+		if m.idleWarned && msg.String() != "ctrl+c" {
+			m.idleWarned = false
+			return m, m.load
+		}
+		if m.locked {
+			return m.updateLocked(msg)
+		}
+		if m.composing {
+			return m.compose(msg)
+		}
+		if m.pending != nil {
+			return m.confirm(msg)
+		}
+		var handled bool
+		switch m.page {
+		case pageSessions:
+			m.sessionTable, handled = m.sessionTable.Update(msg)
+		case pageOrders:
+			m.orderTable, handled = m.orderTable.Update(msg)
+		case pageFiles:
+			if m.fileTable, handled = m.fileTable.Update(msg); handled {
+				return m.followSelection()
+			}
+		}
+		if handled {
+			return m, nil
+		}
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return m, tea.Quit
+		case "up", "k":
+			m.trashCursor = max(m.trashCursor-1, 0)
+		case "down", "j":
+			m.trashCursor = min(m.trashCursor+1, max(len(m.snap.trash)-1, 0))
+		case "r":
+			return m, m.load
+		case "t":
+			m.page = m.toggle(pageTrash)
+		case "o":
+			m.page = m.toggle(pageOrders)
+		case "e":
+			m.page = m.toggle(pageFiles)
+			return m, m.load
+		case "enter":
+			if m.page == pageFiles {
+				return m.openFile()
+			}
+		case "J":
+			m.filePreview.ScrollDown(1)
+		case "K":
+			m.filePreview.ScrollUp(1)
+		case "u":
+			if m.page == pageTrash {
+				return m.restore()
+			}
+		case "n":
+			if m.page == pageOrders {
+				return m.advance("")
+			}
+		case "f":
+			if m.page == pageOrders {
+				return m.advance(orders.Refunded)
+			}
+		case "F":
+			if m.page == pageOrders {
+				return m.refundPlan()
+			}
+		case "P":
+			if m.page == pageTrash {
+				return m.purgePlan()
+			}
+		case "d":
+			m.dryRun = !m.dryRun
+			m.status = "dry run is off, bulk changes happen straight away"
+			if m.dryRun {
+				m.status = "dry run is on, bulk changes are previewed first"
+			}
+		case "x":
+			if m.page == pageSessions {
+				return m.kick()
+			}
+		case "b":
+			m.composing = true
+			m.announce.SetValue("")
+			return m, m.announce.Focus()
+		}
+	}
+	if m.composing {
+		var cmd tea.Cmd
+		m.announce, cmd = m.announce.Update(msg)
+		return m, cmd
+	}
+	if m.locked && m.srv.Unlock != nil {
+		var cmd tea.Cmd
+		m.unlock, cmd = m.unlock.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// toggle opens p, or goes back to the sessions if it's already open
+func (m Model) toggle(p page) page {
+	if m.page == p {
+		return pageSessions
+	}
+	return p
+}
+
+// compose handles keys while an announcement is being typed
+func (m Model) compose(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.composing = false
+		m.announce.Blur()
+		return m, nil
+	case "enter":
+		m.composing = false
+		m.announce.Blur()
+		return m.announcePlan(strings.TrimSpace(m.announce.Value()))
+	}
+	var cmd tea.Cmd
+	m.announce, cmd = m.announce.Update(msg)
+	return m, cmd
+}
+
+// breakersView adds a line saying how each integration is doing, if there are any
+func (m Model) breakersView(b *strings.Builder) {
+	if len(m.snap.breakers) == 0 {
+		return
+	}
+	states := make([]string, len(m.snap.breakers))
+	for i, br := range m.snap.breakers {
+		states[i] = fmt.Sprintf("%s %s", br.Name, br.State)
+		if br.State == breaker.Open {
+			states[i] = m.selected.Render(fmt.Sprintf("%s paused until %s", br.Name, m.f.Time(br.RetryAt)))
+		}
+	}
+	b.WriteString("\nintegrations: " + strings.Join(states, " • "))
+}
+
+// kick disconnects the selected session
+func (m Model) kick() (tea.Model, tea.Cmd) {
+	target, ok := m.sessionTable.Selected()
+	if !ok {
+		return m, nil
+	}
+	switch {
+	case target.ID == m.self:
+		m.status = "that's you, use q to leave"
+	case m.srv.Sessions.Kill(target.ID, "an administrator closed this session"):
+		m.status = fmt.Sprintf("kicked %s (session %d)", user.CleanName(target.User), target.ID)
+	default:
+		m.status = fmt.Sprintf("session %d already left", target.ID)
+	}
+	return m, m.load
+}
+
+// restore takes the selected submission out of the trash
+func (m Model) restore() (tea.Model, tea.Cmd) {
+	if m.trashCursor >= len(m.snap.trash) {
+		return m, nil
+	}
+	sub := m.snap.trash[m.trashCursor]
+	if err := m.srv.Submissions.RestoreAny(sub.ID); err != nil {
+		m.status = fmt.Sprintf("could not restore submission %d: %v", sub.ID, err)
+		return m, m.load
+	}
+	if m.srv.Audit != nil {
+		m.srv.Audit("trash.restore", sub.User, fmt.Sprint(sub.ID))
+	}
+	m.status = fmt.Sprintf("restored %q for %s", sub.Value, user.CleanName(sub.User))
+	return m, m.load
+}
+
+func (m Model) View() string {
+	if m.idleWarned {
+		return idleView()
+	}
+	if m.locked {
+		return m.lockedView()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", m.title.Render("Server"))
+	fmt.Fprintf(&b, "up %s • %s sessions • %s goroutines • %s MiB heap",
+		m.snap.uptime, m.f.Int(len(m.snap.sessions)), m.f.Int(m.snap.goroutines), m.f.Decimal(float64(m.snap.heap)/(1<<20), 1))
+	if m.srv.Queued != nil {
+		fmt.Fprintf(&b, " • %s queued", m.f.Int(m.snap.queued))
+	}
+	if m.dryRun {
+		b.WriteString(" • dry run")
+	}
+	m.breakersView(&b)
+	b.WriteString("\n\n")
+
+	if m.pending != nil {
+		return b.String() + m.previewView()
+	}
+
+	switch m.page {
+	case pageTrash:
+		m.trashView(&b)
+		return b.String()
+	case pageOrders:
+		m.ordersView(&b)
+		return b.String()
+	case pageFiles:
+		m.filesView(&b)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "%s\n", m.title.Render("Sessions"))
+	b.WriteString(m.sessionTable.View() + "\n")
+
+	fmt.Fprintf(&b, "\n%s\n", m.title.Render("Recent submissions"))
+	if m.snap.err != nil {
+		fmt.Fprintf(&b, "could not load: %v\n", m.snap.err)
+	}
+	if len(m.snap.recent) == 0 && m.snap.err == nil {
+		b.WriteString(m.faint.Render("none yet") + "\n")
+	}
+	for _, sub := range m.snap.recent {
+		fmt.Fprintf(&b, "%-16s %-24q %-16s %s\n", user.CleanName(sub.User), sub.Value, user.CleanName(sub.Coffee), m.faint.Render(m.f.When(sub.At, time.Now())))
+	}
+
+	if m.status != "" {
+		fmt.Fprintf(&b, "\n%s\n", m.status)
+	}
+	if m.composing {
+		fmt.Fprintf(&b, "\n%s\n%s", m.announce.View(), m.faint.Render("enter to send • esc to cancel"))
+		return b.String()
+	}
+	b.WriteString("\n" + m.faint.Render("↑/↓ select • "+tableKeys+" • x kick • b announce • d dry run • t trash • o orders • e files • r refresh • q quit"))
+	return b.String()
+}
+
+// trashView lists everyone's deleted submissions in place of the sessions
+func (m Model) trashView(b *strings.Builder) {
+	fmt.Fprintf(b, "%s\n", m.title.Render("Trash"))
+	if m.snap.err != nil {
+		fmt.Fprintf(b, "could not load: %v\n", m.snap.err)
+	}
+	if len(m.snap.trash) == 0 && m.snap.err == nil {
+		b.WriteString(m.faint.Render("empty") + "\n")
+	}
+	for i, sub := range m.snap.trash {
+		line := fmt.Sprintf("%-16s %-24q deleted %s, purged %s", user.CleanName(sub.User), sub.Value,
+			m.f.When(sub.DeletedAt, time.Now()), m.f.Date(sub.DeletedAt.Add(m.srv.Retention)))
+		if i == m.trashCursor {
+			line = m.selected.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	if m.status != "" {
+		fmt.Fprintf(b, "\n%s\n", m.status)
+	}
+	b.WriteString("\n" + m.faint.Render("↑/↓ select • u restore • P purge expired • d dry run • t sessions • r refresh • q quit"))
+}
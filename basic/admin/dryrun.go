@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// previewHeight is how many rows a preview shows before it scrolls
+const previewHeight = 12
+
+// plan is a bulk change, what it will touch and how to make it
+// In dry-run mode the rows are shown as a table and run waits for enter;
+// run acts on exactly those rows rather than looking again
+type plan struct {
+	title   string
+	columns []table.Column
+	rows    []table.Row
+	run     func(Model) (Model, tea.Cmd)
+}
+
+// propose makes p now, or in dry-run mode shows what it would touch first
+func (m Model) propose(p plan) (tea.Model, tea.Cmd) {
+	if !m.dryRun {
+		return p.run(m)
+	}
+	t := table.New(
+		table.WithColumns(p.columns),
+		table.WithRows(p.rows),
+		// One more line for the header
+		table.WithHeight(min(len(p.rows), previewHeight)+1),
+		table.WithFocused(true),
+	)
+	// The table's own styles use the server's renderer, these use the admin's
+	t.SetStyles(table.Styles{
+		Header:   m.title.Padding(0, 1),
+		Cell:     m.faint.UnsetFaint().Padding(0, 1),
+		Selected: m.selected,
+	})
+	m.pending, m.preview = &p, t
+	return m, nil
+}
+
+// confirm handles keys while a plan is being previewed
+func (m Model) confirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "enter":
+		p := *m.pending
+		m.pending = nil
+		return p.run(m)
+	case "esc", "q":
+		m.pending = nil
+		m.status = "dry run, nothing was changed"
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.preview, cmd = m.preview.Update(msg)
+	return m, cmd
+}
+
+// purgePlan removes everything in the trash past retention now, rather
+// than waiting for the hourly purge
+func (m Model) purgePlan() (tea.Model, tea.Cmd) {
+	cutoff := time.Now().Add(-m.srv.Retention)
+	expired, err := m.srv.Submissions.Expired(cutoff)
+	if err != nil {
+		m.status = fmt.Sprintf("could not look for expired submissions: %v", err)
+		return m, nil
+	}
+	p := plan{
+		title: fmt.Sprintf("Purge %s submissions deleted before %s", m.f.Int(len(expired)), m.f.Date(cutoff)),
+		columns: []table.Column{
+			{Title: "ID", Width: 6},
+			{Title: "User", Width: 16},
+			{Title: "Value", Width: 24},
+			{Title: "Deleted", Width: 26},
+		},
+	}
+	for _, sub := range expired {
+		p.rows = append(p.rows, table.Row{fmt.Sprint(sub.ID), user.CleanName(sub.User), user.CleanName(sub.Value), m.f.When(sub.DeletedAt, time.Now())})
+	}
+	// Anything deleted since was deleted after cutoff, so the same cutoff purges
+	// what's listed, less anything restored meanwhile
+	p.run = func(m Model) (Model, tea.Cmd) {
+		n, err := m.srv.Submissions.Purge(cutoff)
+		if err != nil {
+			m.status = fmt.Sprintf("could not purge the trash: %v", err)
+			return m, m.load
+		}
+		if m.srv.Audit != nil {
+			m.srv.Audit("trash.purge", "", fmt.Sprintf("%d submissions deleted before %s", n, cutoff.UTC().Format(time.RFC3339)))
+		}
+		m.status = fmt.Sprintf("purged %s submissions", m.f.Int(int(n)))
+		return m, m.load
+	}
+	return m.propose(p)
+}
+
+// refundPlan refunds every order of the selected order's user that can still be refunded
+func (m Model) refundPlan() (tea.Model, tea.Cmd) {
+	selected, ok := m.orderTable.Selected()
+	if !ok {
+		return m, nil
+	}
+	who := selected.User
+	var targets []orders.Order
+	for _, o := range m.snap.orders {
+		if o.User == who && o.Can(orders.Refunded) {
+			targets = append(targets, o)
+		}
+	}
+	p := plan{
+		title: fmt.Sprintf("Refund %s orders for %s", m.f.Int(len(targets)), who),
+		columns: []table.Column{
+			{Title: "Order", Width: 6},
+			{Title: "Item", Width: 16},
+			{Title: "Now", Width: 9},
+			{Title: "Becomes", Width: 9},
+		},
+	}
+	for _, o := range targets {
+		p.rows = append(p.rows, table.Row{fmt.Sprint(o.ID), o.Item, string(o.State), string(orders.Refunded)})
+	}
+	p.run = func(m Model) (Model, tea.Cmd) {
+		done, changed := 0, 0
+		for _, o := range targets {
+			// Each event follows the order as it was previewed, one that moved on since is left alone
+			err := m.addEvent(o, orders.Refunded)
+			switch {
+			case errors.Is(err, storage.ErrConflict):
+				changed++
+			case err != nil:
+				m.status = fmt.Sprintf("refunded %s orders, then order %d failed: %v", m.f.Int(done), o.ID, err)
+				return m, m.load
+			default:
+				done++
+			}
+		}
+		m.status = fmt.Sprintf("refunded %s orders for %s", m.f.Int(done), who)
+		if changed > 0 {
+			m.status += fmt.Sprintf(", %s changed while you were looking, check them again", m.f.Int(changed))
+		}
+		return m, m.load
+	}
+	return m.propose(p)
+}
+
+// announcePlan shows text as a banner in every session, empty text clears it
+func (m Model) announcePlan(text string) (tea.Model, tea.Cmd) {
+	reached := m.srv.Sessions.List()
+	title := fmt.Sprintf("Announce %q to %s sessions", text, m.f.Int(len(reached)))
+	if text == "" {
+		title = fmt.Sprintf("Clear the banner in %s sessions", m.f.Int(len(reached)))
+	}
+	p := plan{
+		title: title,
+		columns: []table.Column{
+			{Title: "Session", Width: 8},
+			{Title: "User", Width: 16},
+			{Title: "From", Width: 22},
+		},
+	}
+	for _, s := range reached {
+		p.rows = append(p.rows, table.Row{fmt.Sprint(s.ID), user.CleanName(s.User), s.Remote})
+	}
+	p.run = func(m Model) (Model, tea.Cmd) {
+		n := m.srv.Broadcast(text)
+		m.status = fmt.Sprintf("announced to %s sessions", m.f.Int(n))
+		if text == "" {
+			m.status = fmt.Sprintf("cleared the banner in %s sessions", m.f.Int(n))
+		}
+		return m, nil
+	}
+	return m.propose(p)
+}
+
+// previewView shows the pending plan in place of the page it came from
+func (m Model) previewView() string {
+	p := m.pending
+	view := m.title.Render("Dry run: "+p.title) + "\n\n"
+	if len(p.rows) == 0 {
+		view += m.faint.Render("nothing would change") + "\n"
+	} else {
+		view += m.preview.View() + "\n"
+	}
+	view += fmt.Sprintf("\n%s rows • nothing has changed yet\n", m.f.Int(len(p.rows)))
+	return view + "\n" + m.faint.Render("enter to run it for real • esc to cancel • ↑/↓ scroll")
+}
@@ -0,0 +1,300 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jwc20/wish-bubbletea-tests/basic/grid"
+)
+
+// Dir is a directory the operator lets admins look through on the files page
+type Dir struct {
+	Name string
+	Path string
+}
+
+// ParseDirs reads comma separated name=path pairs, e.g. "content=content,exports=/srv/exports"
+func ParseDirs(spec string) ([]Dir, error) {
+	var dirs []Dir
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, p, ok := strings.Cut(part, "=")
+		if !ok || name == "" || p == "" || strings.ContainsAny(name, "/:") {
+			return nil, fmt.Errorf("%q: want name=path", part)
+		}
+		if slices.ContainsFunc(dirs, func(d Dir) bool { return d.Name == name }) {
+			return nil, fmt.Errorf("%q: %s is listed twice", part, name)
+		}
+		dirs = append(dirs, Dir{Name: name, Path: p})
+	}
+	return dirs, nil
+}
+
+// CheckDirs makes sure every directory can be read
+func CheckDirs(dirs []Dir) error {
+	var errs []error
+	for _, d := range dirs {
+		if _, err := os.ReadDir(d.Path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// The files page's layout
+const (
+	fileRows = 16
+	// treeWidth is about what the tree's columns take, the preview gets the rest
+	treeWidth = 56
+	// maxPreview is the most of a file that's read to preview
+	maxPreview = 64 << 10
+)
+
+// file is one row of the tree, a directory, a file in it, or a directory that couldn't be read
+type file struct {
+	dir   int    // which of Server.Dirs it's in
+	path  string // within the directory, "." for the directory itself
+	depth int
+	isDir bool
+	size  int64
+	mod   time.Time
+	err   error
+}
+
+func (f file) key() string {
+	return fmt.Sprintf("%d:%s", f.dir, f.path)
+}
+
+// previewMsg is the start of a file, or why it can't be shown
+type previewMsg struct {
+	key  string
+	text string
+}
+
+// newFileTable lists the tree, it's kept in tree order so there's nothing to sort by
+func newFileTable(dirs []Dir, f func(time.Time) string, styles grid.Styles) grid.Model[file] {
+	return grid.New([]grid.Column[file]{
+		{Title: "Name", Width: 30, Cell: func(e file) string {
+			name := path.Base(e.path)
+			if e.path == "." {
+				name = dirs[e.dir].Name
+			}
+			switch {
+			case e.err != nil:
+				return strings.Repeat("  ", e.depth) + "! " + name
+			case e.isDir:
+				return strings.Repeat("  ", e.depth) + name + "/"
+			}
+			return strings.Repeat("  ", e.depth) + name
+		}},
+		{Title: "Size", Width: 8, Cell: func(e file) string {
+			if e.isDir || e.err != nil {
+				return ""
+			}
+			return byteSize(e.size)
+		}},
+		{Title: "Modified", Width: 12, Cell: func(e file) string {
+			if e.mod.IsZero() {
+				return ""
+			}
+			return f(e.mod)
+		}},
+	}, file.key, fileRows, styles)
+}
+
+// listFiles walks the directories, going into those that are expanded
+// The directories are opened as an os.Root, so a symlink can't lead out of them
+func (m Model) listFiles() []file {
+	var files []file
+	for i, d := range m.srv.Dirs {
+		top := file{dir: i, path: ".", isDir: true}
+		root, err := os.OpenRoot(d.Path)
+		if err != nil {
+			top.err = err
+			files = append(files, top)
+			continue
+		}
+		files = append(files, top)
+		if m.expanded[top.key()] {
+			files = m.listDir(files, root.FS(), i, ".", 1)
+		}
+		root.Close()
+	}
+	return files
+}
+
+// listDir adds the entries of dir to files, directories first
+func (m Model) listDir(files []file, fsys fs.FS, i int, dir string, depth int) []file {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return append(files, file{dir: i, path: path.Join(dir, "(unreadable)"), depth: depth, err: err})
+	}
+	slices.SortStableFunc(entries, func(a, b fs.DirEntry) int {
+		switch {
+		case a.IsDir() == b.IsDir():
+			return 0
+		case a.IsDir():
+			return -1
+		}
+		return 1
+	})
+	for _, e := range entries {
+		f := file{dir: i, path: path.Join(dir, e.Name()), depth: depth, isDir: e.IsDir()}
+		if info, err := e.Info(); err == nil {
+			f.size, f.mod = info.Size(), info.ModTime()
+		}
+		files = append(files, f)
+		if f.isDir && m.expanded[f.key()] {
+			files = m.listDir(files, fsys, i, f.path, depth+1)
+		}
+	}
+	return files
+}
+
+// openFile expands or collapses the selected directory
+func (m Model) openFile() (tea.Model, tea.Cmd) {
+	f, ok := m.fileTable.Selected()
+	if !ok || !f.isDir || f.err != nil {
+		return m, nil
+	}
+	expanded := maps.Clone(m.expanded)
+	if expanded == nil {
+		expanded = map[string]bool{}
+	}
+	if expanded[f.key()] {
+		delete(expanded, f.key())
+	} else {
+		expanded[f.key()] = true
+	}
+	m.expanded = expanded
+	return m, m.load
+}
+
+// followSelection starts loading the selected file's preview if it isn't the one shown
+func (m Model) followSelection() (Model, tea.Cmd) {
+	f, ok := m.fileTable.Selected()
+	if !ok || f.key() == m.previewing {
+		return m, nil
+	}
+	m.previewing = f.key()
+	m.filePreview.GotoTop()
+	switch {
+	case f.err != nil:
+		m.filePreview.SetContent(f.err.Error())
+		return m, nil
+	case f.isDir:
+		m.filePreview.SetContent("")
+		return m, nil
+	}
+	m.filePreview.SetContent(m.faint.Render("loading…"))
+	d := m.srv.Dirs[f.dir]
+	return m, func() tea.Msg {
+		return previewMsg{key: f.key(), text: readPreview(d.Path, f.path)}
+	}
+}
+
+// readPreview returns the start of the file at name in dir as text that's safe to draw
+func readPreview(dir, name string) string {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err.Error()
+	}
+	defer root.Close()
+	file, err := root.Open(name)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxPreview))
+	if err != nil {
+		return err.Error()
+	}
+	truncated := len(data) == maxPreview
+	// The limit can fall in the middle of a character
+	for i := 0; truncated && i < utf8.UTFMax-1 && !utf8.Valid(data); i++ {
+		data = data[:len(data)-1]
+	}
+	if slices.Contains(data, 0) || !utf8.Valid(data) {
+		return "binary file, not previewed"
+	}
+	// Escape sequences in a file could redraw or retitle the admin's terminal
+	text := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t':
+			return ' '
+		case r < ' ' || r == 0x7f || r >= 0x80 && r < 0xa0:
+			return '�'
+		}
+		return r
+	}, string(data))
+	if truncated {
+		text += "\n…"
+	}
+	return text
+}
+
+// downloadHint says where the selected file can be fetched from, empty without Server.DownloadHint
+func (m Model) downloadHint() string {
+	f, ok := m.fileTable.Selected()
+	if !ok || f.isDir || f.err != nil || m.srv.DownloadHint == "" {
+		return ""
+	}
+	p := path.Join(m.srv.Dirs[f.dir].Name, f.path)
+	return "download: " + strings.ReplaceAll(m.srv.DownloadHint, "{path}", p)
+}
+
+// filesView shows the directories' tree next to the selected file in place of the sessions
+func (m Model) filesView(b *strings.Builder) {
+	fmt.Fprintf(b, "%s\n", m.title.Render("Files"))
+	if len(m.srv.Dirs) == 0 {
+		b.WriteString(m.faint.Render("no directories are shared, see --admin-files") + "\n")
+	} else {
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, m.fileTable.View(), "  ", m.filePreview.View()) + "\n")
+	}
+	if hint := m.downloadHint(); hint != "" {
+		fmt.Fprintf(b, "\n%s\n", hint)
+	}
+	if m.status != "" {
+		fmt.Fprintf(b, "\n%s\n", m.status)
+	}
+	b.WriteString("\n" + m.faint.Render("↑/↓ select • enter open • J/K scroll preview • +/- width • e sessions • r refresh • q quit"))
+}
+
+// sizeFiles fits the tree and the preview side by side in width
+func (m Model) sizeFiles(width int) Model {
+	m.fileTable = m.fileTable.SetSize(min(width, treeWidth), fileRows)
+	m.filePreview.Width = max(width-treeWidth-2, 20)
+	return m
+}
+
+// byteSize is n in B, KB, MB or GB
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB", "TB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
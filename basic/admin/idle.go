@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// idleWarning is how long before Server.IdleTimeout the admin is warned, as in the app
+const idleWarning = time.Minute
+
+// idleMsg checks how long the view has gone without a keypress
+type idleMsg struct {
+	at time.Time
+}
+
+// idleTick checks for inactivity again after d
+func idleTick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg { return idleMsg{at: t} })
+}
+
+// checkIdle warns the admin a minute before Server.IdleTimeout and closes the
+// view at it, scheduling the next check for when either could next happen
+// Locking doesn't stop the clock, a locked view left alone is closed too
+func (m Model) checkIdle(msg idleMsg) (Model, tea.Cmd) {
+	warnAt := max(m.srv.IdleTimeout-idleWarning, 0)
+	idle := msg.at.Sub(m.lastActive)
+	switch {
+	case idle >= m.srv.IdleTimeout:
+		return m, tea.Quit
+	case idle >= warnAt:
+		m.idleWarned = true
+		return m, idleTick(m.srv.IdleTimeout - idle)
+	}
+	return m, idleTick(warnAt - idle)
+}
+
+// idleView replaces the whole view while the admin is being warned
+func idleView() string {
+	return "still there?\n\nthis session closes in a minute if nothing is pressed\n\npress any key to stay • ctrl+c to leave"
+}
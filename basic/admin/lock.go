@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxUnlockTries is how many wrong codes the locked view takes before the session is
+// closed, as many as the app's own second factor prompt allows
+const maxUnlockTries = 5
+
+// lockMsg checks whether the view has gone idle
+type lockMsg struct {
+	at time.Time
+}
+
+// lockTick checks for inactivity again after d
+func lockTick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg { return lockMsg{at: t} })
+}
+
+// newUnlockInput is where the admin types their authenticator code to unlock
+func newUnlockInput() textinput.Model {
+	input := textinput.New()
+	input.Placeholder = "123456"
+	input.CharLimit = 6
+	input.Width = 7
+	return input
+}
+
+// checkLock locks the view once it has been idle for Server.LockAfter, and
+// schedules the next check for when that could next happen
+func (m Model) checkLock(msg lockMsg) (Model, tea.Cmd) {
+	if m.locked {
+		return m, lockTick(m.srv.LockAfter)
+	}
+	idle := msg.at.Sub(m.lastActive)
+	if idle < m.srv.LockAfter {
+		return m, lockTick(m.srv.LockAfter - idle)
+	}
+	m.locked = true
+	// Whatever was half typed stays behind the lock, not on the screen
+	m.composing = false
+	m.announce.Blur()
+	if m.srv.Unlock == nil {
+		return m, lockTick(m.srv.LockAfter)
+	}
+	m.unlock.SetValue("")
+	m.unlockErr = ""
+	return m, tea.Batch(m.unlock.Focus(), lockTick(m.srv.LockAfter))
+}
+
+// updateLocked handles keys while locked: any key resumes, or with
+// Server.Unlock set, the right authenticator code does
+func (m Model) updateLocked(msg tea.KeyMsg) (Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		return m, tea.Quit
+	}
+	if m.srv.Unlock == nil {
+		m.locked = false
+		return m, nil
+	}
+	if msg.String() != "enter" {
+		var cmd tea.Cmd
+		m.unlock, cmd = m.unlock.Update(msg)
+		return m, cmd
+	}
+	if !m.srv.Unlock(m.unlock.Value()) {
+		m.unlockTries++
+		if m.unlockTries >= maxUnlockTries {
+			if m.srv.Audit != nil {
+				m.srv.Audit("lock.closed", "", fmt.Sprintf("%d wrong codes", m.unlockTries))
+			}
+			return m, tea.Quit
+		}
+		m.unlockErr = "that's not the code, try the next one"
+		m.unlock.SetValue("")
+		return m, nil
+	}
+	m.locked = false
+	m.unlockTries = 0
+	m.unlock.Blur()
+	return m, m.load
+}
+
+// lockedView replaces the whole view while locked, so an unattended terminal
+// doesn't show who's connected or what they submitted
+func (m Model) lockedView() string {
+	if m.srv.Unlock == nil {
+		return "locked after inactivity\n\npress any key to resume • ctrl+c to leave"
+	}
+	view := "locked after inactivity, enter the code from your authenticator app\n\n" + m.unlock.View()
+	if m.unlockErr != "" {
+		view += "\n\n" + m.unlockErr
+	}
+	return view + "\n\n" + m.faint.Render("enter to unlock • ctrl+c to leave")
+}
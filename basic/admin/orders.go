@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// advance adds event t to the selected order, or the event that moves it
+// forward when t is empty
+func (m Model) advance(t orders.Type) (tea.Model, tea.Cmd) {
+	o, ok := m.orderTable.Selected()
+	if !ok {
+		return m, nil
+	}
+	if t == "" {
+		if t = o.Next(); t == "" {
+			m.status = fmt.Sprintf("order %d is %s, there's nothing after that", o.ID, o.State)
+			return m, nil
+		}
+	}
+	err := m.addEvent(o, t)
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		m.status = fmt.Sprintf("order %d changed while you were looking, check it again", o.ID)
+	case err != nil:
+		m.status = fmt.Sprintf("could not mark order %d %s: %v", o.ID, t, err)
+	default:
+		m.status = fmt.Sprintf("order %d is %s", o.ID, t)
+	}
+	return m, m.load
+}
+
+// addEvent records t happening to o as the admin, storage.ErrConflict if o
+// has moved on since it was loaded
+func (m Model) addEvent(o orders.Order, t orders.Type) error {
+	e, err := o.NewEvent(t, m.srv.Admin, time.Now())
+	if err == nil {
+		err = m.srv.Submissions.Append(e)
+	}
+	if err == nil && m.srv.Audit != nil {
+		m.srv.Audit("order."+string(t), o.User, fmt.Sprint(o.ID))
+	}
+	return err
+}
+
+// ordersView lists orders newest first, with the selected one's timeline under them
+func (m Model) ordersView(b *strings.Builder) {
+	fmt.Fprintf(b, "%s\n", m.title.Render("Orders"))
+	if m.snap.err != nil {
+		fmt.Fprintf(b, "could not load: %v\n", m.snap.err)
+	}
+	if len(m.snap.orders) == 0 && m.snap.err == nil {
+		b.WriteString(m.faint.Render("none yet") + "\n")
+	}
+	if len(m.snap.orders) > 0 {
+		b.WriteString(m.orderTable.View() + "\n")
+	}
+	if m.snap.skipped > 0 {
+		b.WriteString(m.faint.Render(fmt.Sprintf("%s events couldn't be applied, `orders` lists them", m.f.Int(m.snap.skipped))) + "\n")
+	}
+
+	if o, ok := m.orderTable.Selected(); ok {
+		fmt.Fprintf(b, "\n%s\n", m.title.Render(fmt.Sprintf("Order %d", o.ID)))
+		for _, e := range o.Timeline {
+			fmt.Fprintf(b, "%-9s by %-16s %s\n", e.Type, user.CleanName(e.Actor), m.faint.Render(m.f.When(e.At, time.Now())))
+		}
+	}
+	if m.status != "" {
+		fmt.Fprintf(b, "\n%s\n", m.status)
+	}
+	b.WriteString("\n" + m.faint.Render("↑/↓ select • "+tableKeys+" • n next step • f refund • F refund all theirs • d dry run • o sessions • r refresh • q quit"))
+}
@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/grid"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessions"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// tableRows is how many rows the sessions and orders tables show before scrolling
+const tableRows = 10
+
+// tableKeys is the footer hint for the tables' own keys
+const tableKeys = "←/→ column • s sort • +/- width"
+
+// newSessionTable lists sessions, marking the admin's own
+func newSessionTable(self uint64, styles grid.Styles) grid.Model[sessions.Info] {
+	return grid.New([]grid.Column[sessions.Info]{
+		{Title: "ID", Width: 5, Cell: func(s sessions.Info) string { return fmt.Sprint(s.ID) },
+			Less: func(a, b sessions.Info) bool { return a.ID < b.ID }},
+		{Title: "User", Width: 16, Cell: func(s sessions.Info) string {
+			if s.ID == self {
+				return user.CleanName(s.User) + " (you)"
+			}
+			return user.CleanName(s.User)
+		}, Less: func(a, b sessions.Info) bool { return a.User < b.User }},
+		{Title: "From", Width: 22, Cell: func(s sessions.Info) string { return s.Remote },
+			Less: func(a, b sessions.Info) bool { return a.Remote < b.Remote }},
+		{Title: "Size", Width: 7, Cell: func(s sessions.Info) string { return fmt.Sprintf("%dx%d", s.Width, s.Height) },
+			Less: func(a, b sessions.Info) bool { return a.Width*a.Height < b.Width*b.Height }},
+		{Title: "Connected", Width: 10, Cell: func(s sessions.Info) string { return time.Since(s.Connected).Round(time.Second).String() },
+			// Longest connected first when ascending, like the durations read
+			Less: func(a, b sessions.Info) bool { return a.Connected.Before(b.Connected) }},
+	}, func(s sessions.Info) string { return fmt.Sprint(s.ID) }, tableRows, styles)
+}
+
+// newOrderTable lists orders, newest first until it's sorted otherwise
+func newOrderTable(f l10n.Formatter, styles grid.Styles) grid.Model[orders.Order] {
+	last := func(o orders.Order) time.Time { return o.Timeline[len(o.Timeline)-1].At }
+	return grid.New([]grid.Column[orders.Order]{
+		{Title: "Order", Width: 6, Cell: func(o orders.Order) string { return fmt.Sprint(o.ID) },
+			Less: func(a, b orders.Order) bool { return a.ID < b.ID }},
+		{Title: "User", Width: 16, Cell: func(o orders.Order) string { return user.CleanName(o.User) },
+			Less: func(a, b orders.Order) bool { return a.User < b.User }},
+		{Title: "Item", Width: 16, Cell: func(o orders.Order) string { return user.CleanName(o.Item) },
+			Less: func(a, b orders.Order) bool { return a.Item < b.Item }},
+		{Title: "State", Width: 9, Cell: func(o orders.Order) string { return string(o.State) },
+			Less: func(a, b orders.Order) bool { return cmp.Less(a.State, b.State) }},
+		{Title: "Last change", Width: 30, Cell: func(o orders.Order) string { return f.When(last(o), time.Now()) },
+			Less: func(a, b orders.Order) bool { return last(a).Before(last(b)) }},
+	}, func(o orders.Order) string { return fmt.Sprint(o.ID) }, tableRows, styles)
+}
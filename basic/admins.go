@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/admin"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessions"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// admins are the key fingerprints that get the admin view instead of the app,
+// set by --admins or the config file's admins, which can change on reload
+var admins adminSet
+
+// adminFiles are the directories admins can look through, set by --admin-files,
+// and adminFilesHint where they can download them from, by --admin-files-hint
+var (
+	adminFiles     []admin.Dir
+	adminFilesHint string
+)
+
+// adminSet is swapped whole on reload, so a session never sees it half changed
+type adminSet struct {
+	keys atomic.Pointer[map[string]bool]
+}
+
+func (a *adminSet) set(keys map[string]bool) {
+	a.keys.Store(&keys)
+}
+
+func (a *adminSet) has(fingerprint string) bool {
+	keys := a.keys.Load()
+	return keys != nil && (*keys)[fingerprint]
+}
+
+func (a *adminSet) count() int {
+	if keys := a.keys.Load(); keys != nil {
+		return len(*keys)
+	}
+	return 0
+}
+
+// startedAt is when the server started, for the admin view's uptime
+var startedAt = time.Now()
+
+// parseAdmins reads a comma separated list of SHA256 fingerprints
+func parseAdmins(spec string) map[string]bool {
+	set := map[string]bool{}
+	for _, fp := range strings.Split(spec, ",") {
+		if fp = strings.TrimSpace(fp); fp != "" {
+			set[fp] = true
+		}
+	}
+	return set
+}
+
+// isAdmin reports whether the session authenticated with an admin key
+// Only the key counts, usernames and handoff tokens never make anyone an admin
+func isAdmin(s ssh.Session) bool {
+	pk := s.PublicKey()
+	return pk != nil && admins.has(gossh.FingerprintSHA256(pk))
+}
+
+// adminHandler serves the admin view, see the admin package
+func adminHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+	log.Info("Admin session", "user", s.User(), "remote", s.RemoteAddr())
+	// The view reads the database, so it waits for warm-up, which is quick
+	<-warm.done
+	if warm.err != nil {
+		return nil, nil
+	}
+	srv := admin.Server{
+		Sessions:     connected,
+		Submissions:  submissionStore,
+		Started:      startedAt,
+		Retention:    trashRetention,
+		Breakers:     breakers.All,
+		Dirs:         adminFiles,
+		DownloadHint: adminFilesHint,
+		Broadcast: func(text string) int {
+			return broadcaster.Send(broadcast.Banner{Text: text, At: time.Now()})
+		},
+	}
+	if admissions != nil {
+		srv.Queued = admissions.Queued
+	}
+	srv.LockAfter = lockAfter
+	srv.IdleTimeout = idleTimeout
+	if hasTOTP(s) {
+		// Their second factor unlocks the view too, a key on an unattended terminal doesn't
+		p, _ := user.FromContext(s.Context())
+		srv.Unlock = func(code string) bool {
+			return checkTOTP(p.Fingerprint, s.User(), code)
+		}
+	}
+	// Audited by key, names are whatever the client asked for
+	actor := fingerprint(s)
+	srv.Admin = actor
+	srv.Audit = func(action, target, detail string) {
+		recordAudit(actor, action, target, detail)
+	}
+	var saved string
+	if profile, ok := user.FromContext(s.Context()); ok {
+		saved = profile.Prefs.TimeZone
+	}
+	f := l10n.New(sessionLocale(s), loadZone(sessionZone(s, saved)))
+	m := admin.New(bubbletea.MakeRenderer(s), srv, sessions.FromContext(s.Context()).ID(), f)
+	return m, []tea.ProgramOption{tea.WithAltScreen(), tea.WithoutSignalHandler()}
+}
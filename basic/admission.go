@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// admissions caps concurrent connections, nil unless --max-connections is set
+var admissions *admission
+
+// admission lets up to max connections in at once and queues the next few
+// Queued clients are told their place and an estimated wait in the SSH banner,
+// before they authenticate, and are let in as connections close.
+// Past the queue's size connections are refused
+type admission struct {
+	max      int
+	queueMax int
+
+	mu      sync.Mutex
+	active  int
+	queue   []*ticket // waiting, first in line first
+	avgHold time.Duration
+	// counts since start, for LogStats
+	admitted int
+	waited   int
+	refused  int
+}
+
+// ticket is one connection's place, kept in its ssh.Context
+type ticket struct {
+	admitted chan struct{} // closed once the connection has a slot
+	queuedAt time.Time
+}
+
+type ticketKey struct{}
+
+func newAdmission(max, queueMax int) *admission {
+	// A guess until real connections have been timed
+	return &admission{max: max, queueMax: queueMax, avgHold: time.Minute}
+}
+
+// Option hooks admission into the server
+// It wraps whatever connection callback and auth handlers are already set,
+// so it has to come after the options that set them
+func (a *admission) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if next != nil {
+				if conn = next(ctx, conn); conn == nil {
+					return nil
+				}
+			}
+			return a.connCallback(ctx, conn)
+		}
+		s.BannerHandler = a.banner
+		if h := s.PublicKeyHandler; h != nil {
+			s.PublicKeyHandler = func(ctx ssh.Context, key ssh.PublicKey) bool {
+				return a.wait(ctx) && h(ctx, key)
+			}
+		}
+		if h := s.KeyboardInteractiveHandler; h != nil {
+			s.KeyboardInteractiveHandler = func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+				return a.wait(ctx) && h(ctx, challenger)
+			}
+		}
+		if h := s.PasswordHandler; h != nil {
+			s.PasswordHandler = func(ctx ssh.Context, password string) bool {
+				return a.wait(ctx) && h(ctx, password)
+			}
+		}
+		return nil
+	}
+}
+
+// connCallback gives the connection a slot or a place in the queue
+func (a *admission) connCallback(ctx ssh.Context, conn net.Conn) net.Conn {
+	t := &ticket{admitted: make(chan struct{}), queuedAt: time.Now()}
+
+	a.mu.Lock()
+	switch {
+	case a.active < a.max:
+		a.active++
+		a.admitted++
+		close(t.admitted)
+	case len(a.queue) < a.queueMax:
+		a.queue = append(a.queue, t)
+	default:
+		a.refused++
+		a.mu.Unlock()
+		log.Info("Server full, refusing connection", "remote", conn.RemoteAddr())
+		return nil
+	}
+	a.mu.Unlock()
+
+	ctx.SetValue(ticketKey{}, t)
+	// The slot, or the place in the queue, is given up when the connection closes
+	go func() {
+		<-ctx.Done()
+		a.leave(t)
+	}()
+	return conn
+}
+
+// leave frees the ticket's slot for the next in line, or takes it out of the queue
+func (a *admission) leave(t *ticket) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-t.admitted:
+	default:
+		a.queue = slices.DeleteFunc(a.queue, func(q *ticket) bool { return q == t })
+		return
+	}
+	a.active--
+	// Smooth out how long connections last, for the wait estimate
+	a.avgHold = (a.avgHold*7 + time.Since(t.queuedAt)) / 8
+	if len(a.queue) > 0 {
+		next := a.queue[0]
+		a.queue = a.queue[1:]
+		a.active++
+		a.admitted++
+		a.waited++
+		close(next.admitted)
+	}
+}
+
+// wait blocks authentication until the connection is admitted
+// It reports false if the client gave up first
+func (a *admission) wait(ctx ssh.Context) bool {
+	t, ok := ctx.Value(ticketKey{}).(*ticket)
+	if !ok {
+		return true
+	}
+	select {
+	case <-t.admitted:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// banner tells a queued client where it is, it's shown before authentication
+func (a *admission) banner(ctx ssh.Context) string {
+	t, ok := ctx.Value(ticketKey{}).(*ticket)
+	if !ok {
+		return ""
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	place := slices.Index(a.queue, t) + 1
+	if place == 0 {
+		return ""
+	}
+	// Each slot frees up about once per average connection
+	wait := (a.avgHold * time.Duration(place) / time.Duration(a.max)).Round(time.Second)
+	return fmt.Sprintf("The server is full. You are #%d in the queue, about %s to wait.\r\n"+
+		"Stay connected and you'll be let in automatically.\r\n", place, wait)
+}
+
+// Queued reports how many connections are waiting for a slot
+func (a *admission) Queued() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.queue)
+}
+
+// LogStats logs how full the server is and how the queue has been doing
+func (a *admission) LogStats() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	log.Info("Admission stats", "active", a.active, "max", a.max,
+		"queued", len(a.queue), "queue-max", a.queueMax,
+		"admitted", a.admitted, "waited", a.waited, "refused", a.refused,
+		"avg-connection", a.avgHold.Round(time.Second))
+}
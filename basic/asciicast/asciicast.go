@@ -0,0 +1,199 @@
+// Package asciicast records what a terminal session drew as an asciicast v2
+// file, which `asciinema play` plays back and asciinema-player embeds.
+//
+// A file is a JSON header line followed by a JSON array per event, the
+// seconds since the start, the kind ("o" for output, "r" for a resize) and
+// the data: [0.248, "o", "\u001b[2J"] or [3.5, "r", "120x40"].
+package asciicast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Ext is the extension recordings are saved with
+const Ext = ".cast"
+
+// Header is the first line of a recording
+type Header struct {
+	// Version and Timestamp are filled in by Start
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes one session's events to its file as they happen, so a
+// recording is readable up to the last event even if the server dies
+// It's safe to use from more than one goroutine
+type Recorder struct {
+	mu      sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	start   time.Time
+	written int64
+	limit   int64
+	// partial is the start of a character a write ended in the middle of
+	partial []byte
+	err     error
+}
+
+// Start creates the recording at path and writes its header
+// Once limit bytes are written, the rest of the session is left out
+func Start(path string, h Header, limit int64) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, start: time.Now(), limit: limit}
+	h.Version, h.Timestamp = 2, r.start.Unix()
+	r.enc = json.NewEncoder(countingWriter{r})
+	// Escaping <, > and & isn't needed outside HTML and makes recordings harder to read
+	r.enc.SetEscapeHTML(false)
+	if err := r.enc.Encode(h); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output records what was written to the terminal
+func (r *Recorder) Output(p []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := append(r.partial, p...)
+	// JSON strings hold text, so a character split across writes waits for its end
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.partial = slices.Clone(data[cut:])
+	if cut == 0 {
+		return r.err
+	}
+	return r.event("o", string(data[:cut]))
+}
+
+// Resize records the terminal changing size
+func (r *Recorder) Resize(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Err is why the recording stopped early, nil while it's going
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close ends the recording
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	if r.err == nil {
+		r.err = os.ErrClosed
+	}
+	return err
+}
+
+// ErrLimit is why a recording stops once it's as big as Start allowed
+var ErrLimit = errors.New("recording is at its size limit")
+
+// event writes one event, after a failed write nothing more is written
+func (r *Recorder) event(kind, data string) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.limit > 0 && r.written+int64(len(data)) > r.limit {
+		r.err = ErrLimit
+		return r.err
+	}
+	seconds := float64(time.Since(r.start).Microseconds()) / 1e6
+	if err := r.enc.Encode([]any{seconds, kind, data}); err != nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// countingWriter writes to the recording's file, keeping count for the limit
+type countingWriter struct{ r *Recorder }
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.r.f.Write(p)
+	w.r.written += int64(n)
+	return n, err
+}
+
+// Prune removes recordings in dir modified before cutoff, then the oldest
+// of the rest until they take up no more than maxBytes (0 for no limit)
+// It returns how many were removed
+func Prune(dir string, cutoff time.Time, maxBytes int64) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	type recording struct {
+		path string
+		size int64
+		mod  time.Time
+	}
+	var kept []recording
+	var total int64
+	removed := 0
+	var errs []error
+	remove := func(path string) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			return
+		}
+		removed++
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) != Ext {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if info.ModTime().Before(cutoff) {
+			remove(path)
+			continue
+		}
+		kept = append(kept, recording{path: path, size: info.Size(), mod: info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(kept, func(a, b recording) int { return a.mod.Compare(b.mod) })
+	for _, rec := range kept {
+		if maxBytes <= 0 || total <= maxBytes {
+			break
+		}
+		remove(rec.path)
+		total -= rec.size
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+// Package audit keeps an append-only record of privileged actions, like an
+// admin viewing the app as another user, as JSON lines.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	At time.Time `json:"at"`
+	// Actor is who did it, e.g. an admin's key fingerprint
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// Target is who or what it was done to, e.g. the impersonated user
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Log appends entries to a file, safe for every session to share
+// A nil Log records nothing
+type Log struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens the log at path for appending, creating it if needed
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{f: f}, nil
+}
+
+// Record appends e, stamping it with the current time if it has none
+// Each entry is synced to disk before Record returns, so a crash can't lose it
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// Close closes the file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
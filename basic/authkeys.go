@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/forgekeys"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// forgeKeys admits keys users have published on GitHub and the like, nil unless --forge-keys
+var forgeKeys *forgekeys.Keys
+
+// forgeUserKey holds, in a connection's ssh.Context, the forgekeys.Identity
+// each key the client offered was admitted as, by fingerprint
+// Clients can offer keys they don't have, which are admitted before they
+// fail to sign, so only the key the session authenticated with counts
+type forgeUserKey struct{}
+
+// forgeUser returns who the session's key was admitted as, if it came from a forge
+func forgeUser(s ssh.Session) (forgekeys.Identity, bool) {
+	pk := s.PublicKey()
+	if pk == nil {
+		return forgekeys.Identity{}, false
+	}
+	ids, _ := s.Context().Value(forgeUserKey{}).(map[string]forgekeys.Identity)
+	id, ok := ids[gossh.FingerprintSHA256(pk)]
+	return id, ok
+}
+
+// admitForgeKey remembers who key was admitted as, for forgeUser once authentication is over
+func admitForgeKey(ctx ssh.Context, key ssh.PublicKey, id forgekeys.Identity) {
+	ids, _ := ctx.Value(forgeUserKey{}).(map[string]forgekeys.Identity)
+	ids = maps.Clone(ids)
+	if ids == nil {
+		ids = map[string]forgekeys.Identity{}
+	}
+	ids[gossh.FingerprintSHA256(key)] = id
+	ctx.SetValue(forgeUserKey{}, ids)
+}
+
+// userName is who the session logged in as, for a key from a forge it's the
+// user there, without the FORGE: the login may have had
+// Names are drawn in other users' terminals, in chat and the admin view,
+// so control characters in them are replaced
+func userName(s ssh.Session) string {
+	if id, ok := forgeUser(s); ok {
+		return user.CleanName(id.User)
+	}
+	return user.CleanName(s.User())
+}
+
+// authorizedKeys admits only the public keys listed in an OpenSSH authorized_keys file
+// The file is read again whenever it changes, so keys can be added without a restart
+type authorizedKeys struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keys    map[string]bool // by SHA256 fingerprint
+}
+
+func newAuthorizedKeys(path string) *authorizedKeys {
+	return &authorizedKeys{path: path}
+}
+
+// load reads the file if it changed since the last read; callers must hold a.mu
+func (a *authorizedKeys) load() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	if a.keys != nil && info.ModTime().Equal(a.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	keys := map[string]bool{}
+	for line := 1; len(bytes.TrimSpace(data)) > 0; line++ {
+		// ParseAuthorizedKey skips comments and blank lines itself
+		key, _, _, rest, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: key %d: %w", a.path, line, err)
+		}
+		keys[gossh.FingerprintSHA256(key)] = true
+		data = rest
+	}
+	a.keys, a.modTime = keys, info.ModTime()
+	return nil
+}
+
+// allowed reports whether key is in the file
+// If the file can't be read, the keys from the last good read are used
+func (a *authorizedKeys) allowed(key ssh.PublicKey) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.load(); err != nil {
+		log.Error("Could not read authorized keys, using the last good copy", "error", err)
+	}
+	return a.keys[gossh.FingerprintSHA256(key)]
+}
+
+// Check makes sure the file exists and every key in it parses
+func (a *authorizedKeys) Check() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = nil
+	return a.load()
+}
+
+// Options installs the allowlist as the server's authentication
+// Handoff tokens are let in without a key, the token itself is the secret, see handoff
+// With --guests, everyone else is let in too, as a guest
+func (a *authorizedKeys) Options() []ssh.Option {
+	return []ssh.Option{
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			ok := a.allowed(key)
+			// Handoff tokens are secrets, so they're never sent off to a forge as a user name
+			if !ok && forgeKeys != nil && !handoffs.Valid(ctx.User()) {
+				var id forgekeys.Identity
+				if id, ok = forgeKeys.Match(ctx, ctx.User(), key); ok {
+					admitForgeKey(ctx, key, id)
+				}
+			}
+			if !ok {
+				log.Info("Public key not authorized",
+					"user", ctx.User(), "remote", ctx.RemoteAddr(), "key", gossh.FingerprintSHA256(key))
+			}
+			return ok
+		}),
+		// Clients fall back to this once none of their keys were accepted
+		wish.WithKeyboardInteractiveAuth(func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+			if handoffs.Valid(ctx.User()) {
+				return true
+			}
+			// Users with a password are left for password auth to let in, not taken as guests
+			if passwords != nil && passwords.listed(ctx.User()) {
+				return false
+			}
+			if guests != nil {
+				ctx.SetValue(guestKey{}, true)
+				return true
+			}
+			return false
+		}),
+	}
+}
+
+// openAuth lets everyone in while still asking clients for their public key
+// Without any auth handler the server skips authentication entirely and never
+// learns the key, so user profiles and key-only features wouldn't work
+func openAuth() []ssh.Option {
+	return []ssh.Option{
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+		// Clients without a key fall through to this, which asks them nothing
+		wish.WithKeyboardInteractiveAuth(func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+			return true
+		}),
+	}
+}
+
+// loopback reports whether host only accepts local connections
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,122 @@
+// Package avatar draws a small deterministic picture for a user.
+//
+// It uses the same "drunken bishop" walk as OpenSSH's randomart, so for a
+// SHA256 key fingerprint the picture matches what `ssh-keygen -lv` prints.
+package avatar
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+const (
+	width  = 17
+	height = 9
+	// symbols are picked by how many times the bishop visited a cell
+	symbols = " .o+=*BOX@%&#/^"
+)
+
+// Generate returns the randomart for a fingerprint such as "SHA256:abc..."
+// Any other string is hashed first, an empty one, for a user without a key,
+// gets a blank frame so nobody can take someone's picture by using their name
+func Generate(fingerprint string) string {
+	if fingerprint == "" {
+		return blank()
+	}
+	return draw(digest(fingerprint))
+}
+
+// quadrants are the block characters for each set of a cell's four quarters
+const quadrants = " ▘▝▀▖▌▞▛▗▚▐▜▄▙▟█"
+
+// Badge is a one line avatar small enough to go next to a chat message,
+// three block characters from the same hash Generate walks
+// An empty fingerprint gets shading instead
+func Badge(fingerprint string) string {
+	if fingerprint == "" {
+		return "░░░"
+	}
+	blocks := []rune(quadrants)
+	var sb strings.Builder
+	for _, b := range digest(fingerprint)[:3] {
+		// The empty cell is skipped, it would look like a gap
+		sb.WriteRune(blocks[1+int(b)%(len(blocks)-1)])
+	}
+	return sb.String()
+}
+
+// blank is an empty frame saying there's no key to draw
+func blank() string {
+	border := "+" + strings.Repeat("-", width) + "+"
+	empty := "|" + strings.Repeat(" ", width) + "|"
+	label := "no key"
+	pad := (width - len(label)) / 2
+	middle := "|" + strings.Repeat(" ", pad) + label + strings.Repeat(" ", width-pad-len(label)) + "|"
+	rows := []string{border}
+	for row := range height {
+		if row == height/2 {
+			rows = append(rows, middle)
+		} else {
+			rows = append(rows, empty)
+		}
+	}
+	return strings.Join(append(rows, border), "\n")
+}
+
+// digest turns the fingerprint back into the raw hash bytes when possible
+func digest(fingerprint string) []byte {
+	if b64, ok := strings.CutPrefix(fingerprint, "SHA256:"); ok {
+		if raw, err := base64.RawStdEncoding.DecodeString(b64); err == nil {
+			return raw
+		}
+	}
+	sum := sha256.Sum256([]byte(fingerprint))
+	return sum[:]
+}
+
+// draw walks the bishop over the field, two bits per step, starting in the middle
+func draw(data []byte) string {
+	var field [height][width]int
+	x, y := width/2, height/2
+	startX, startY := x, y
+
+	for _, b := range data {
+		for i := 0; i < 4; i++ {
+			if b&0x1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if b&0x2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = min(max(x, 0), width-1)
+			y = min(max(y, 0), height-1)
+			field[y][x]++
+			b >>= 2
+		}
+	}
+
+	border := "+" + strings.Repeat("-", width) + "+"
+	var sb strings.Builder
+	sb.WriteString(border + "\n")
+	for row := 0; row < height; row++ {
+		sb.WriteString("|")
+		for col := 0; col < width; col++ {
+			switch {
+			case col == startX && row == startY:
+				sb.WriteByte('S')
+			case col == x && row == y:
+				sb.WriteByte('E')
+			default:
+				sb.WriteByte(symbols[min(field[row][col], len(symbols)-1)])
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(border)
+	return sb.String()
+}
@@ -0,0 +1,169 @@
+// Package breaker stops calling an integration that keeps failing, so a
+// dead SMTP server or webhook costs a quick error instead of a timeout on
+// every call.
+//
+// A Breaker starts closed and lets every call through. After Threshold
+// failures in a row it opens and refuses calls for Cooldown. Then it's half
+// open: one call goes through as a probe, and its result closes the breaker
+// again or opens it for another Cooldown.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is where a breaker is in its cycle
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// ErrOpen is what calls get while the breaker is open, see OpenError
+var ErrOpen = errors.New("circuit open")
+
+// OpenError says which breaker refused a call and when it lets a probe through
+type OpenError struct {
+	Name    string
+	RetryAt time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %v, not trying until %s", e.Name, ErrOpen, e.RetryAt.Format(time.TimeOnly))
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Status is a breaker as it was when asked
+type Status struct {
+	Name     string
+	State    State
+	Failures int       // in a row
+	Since    time.Time // when it got to State
+	RetryAt  time.Time // when an open breaker lets a probe through
+	LastErr  string
+}
+
+// Breaker guards one integration, it's safe to share
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	// changed, if set, hears about every change of state
+	// It's called with the breaker locked, so it mustn't call the breaker
+	changed func(Status)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	since    time.Time
+	probing  bool // a half-open breaker's probe is out
+	lastErr  string
+}
+
+// New returns a closed breaker that opens after threshold failures in a row
+// and tries again after cooldown
+func New(name string, threshold int, cooldown time.Duration, changed func(Status)) *Breaker {
+	return &Breaker{name: name, threshold: max(threshold, 1), cooldown: cooldown, changed: changed, since: time.Now()}
+}
+
+// Do calls fn unless the breaker is open, and counts its result
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.done(err)
+	return err
+}
+
+// Available reports whether a call would go through now, for showing a
+// fallback before trying
+func (b *Breaker) Available() bool {
+	return b.Status().State != Open
+}
+
+// Status returns where the breaker is now
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status()
+}
+
+// status must be called with b.mu held
+func (b *Breaker) status() Status {
+	s := Status{Name: b.name, State: b.state, Failures: b.failures, Since: b.since, LastErr: b.lastErr}
+	if b.state == Open {
+		s.RetryAt = b.since.Add(b.cooldown)
+		// The next call is the probe, it just hasn't come yet
+		if !time.Now().Before(s.RetryAt) {
+			s.State = HalfOpen
+		}
+	}
+	return s
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		retryAt := b.since.Add(b.cooldown)
+		if time.Now().Before(retryAt) {
+			return &OpenError{Name: b.name, RetryAt: retryAt}
+		}
+		b.set(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		// Only the probe goes through, the rest wait to hear how it went
+		if b.probing {
+			return &OpenError{Name: b.name, RetryAt: time.Now().Add(b.cooldown)}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures, b.lastErr = 0, ""
+		if b.state != Closed {
+			b.set(Closed)
+		}
+		return
+	}
+	b.failures++
+	b.lastErr = err.Error()
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.set(Open)
+	}
+}
+
+// set must be called with b.mu held
+func (b *Breaker) set(s State) {
+	b.state, b.since = s, time.Now()
+	if b.changed != nil {
+		b.changed(b.status())
+	}
+}
@@ -0,0 +1,47 @@
+package breaker
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set makes and keeps a breaker per integration, with the same settings for all
+type Set struct {
+	threshold int
+	cooldown  time.Duration
+	changed   func(Status)
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet returns an empty set, see New for the settings
+func NewSet(threshold int, cooldown time.Duration, changed func(Status)) *Set {
+	return &Set{threshold: threshold, cooldown: cooldown, changed: changed, breakers: map[string]*Breaker{}}
+}
+
+// Get returns the breaker for name, making it the first time
+func (s *Set) Get(name string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok {
+		b = New(name, s.threshold, s.cooldown, s.changed)
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// All returns every breaker's status, by name
+func (s *Set) All() []Status {
+	s.mu.Lock()
+	all := make([]Status, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		all = append(all, b.Status())
+	}
+	s.mu.Unlock()
+	slices.SortFunc(all, func(a, b Status) int { return strings.Compare(a.Name, b.Name) })
+	return all
+}
@@ -0,0 +1,99 @@
+// Package broadcast sends a message to every running Bubble Tea program,
+// e.g. a banner warning everyone that the server is about to restart.
+package broadcast
+
+import (
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/bubbletea"
+)
+
+// Banner is shown at the top of every session until a Banner with no Text replaces it
+// At is when it was sent, left zero for banners that keep updating, like a countdown
+type Banner struct {
+	Text string
+	At   time.Time
+}
+
+// backlog is how many messages a program can be behind before more are dropped for it
+const backlog = 8
+
+// Broadcaster keeps the programs of every running session, with who each is for
+type Broadcaster struct {
+	mu       sync.Mutex
+	programs map[*tea.Program]recipient
+}
+
+// recipient is a program's audience and the messages waiting to be sent to it
+type recipient struct {
+	audience Audience
+	queue    chan tea.Msg
+}
+
+// New returns a broadcaster with no programs
+func New() *Broadcaster {
+	return &Broadcaster{programs: map[*tea.Program]recipient{}}
+}
+
+// Handler builds each session's program from h, the same way bubbletea.Middleware does,
+// and keeps it until the session ends, along with the session's audience for targeting
+// Use it with bubbletea.MiddlewareWithProgramHandler
+func (b *Broadcaster) Handler(h bubbletea.Handler, audience func(ssh.Session) Audience) bubbletea.ProgramHandler {
+	return func(s ssh.Session) *tea.Program {
+		m, opts := h(s)
+		if m == nil {
+			return nil
+		}
+		p := tea.NewProgram(m, append(opts, bubbletea.MakeOptions(s)...)...)
+		r := recipient{audience: audience(s), queue: make(chan tea.Msg, backlog)}
+
+		b.mu.Lock()
+		b.programs[p] = r
+		b.mu.Unlock()
+		// One goroutine per program sends its messages in order until the session ends
+		go func() {
+			defer func() {
+				b.mu.Lock()
+				delete(b.programs, p)
+				b.mu.Unlock()
+			}()
+			for {
+				select {
+				case msg := <-r.queue:
+					p.Send(msg)
+				case <-s.Context().Done():
+					return
+				}
+			}
+		}()
+		return p
+	}
+}
+
+// Send delivers msg to every program and returns how many there were
+func (b *Broadcaster) Send(msg tea.Msg) int {
+	return b.SendTo(msg, Target{})
+}
+
+// SendTo delivers msg to the programs whose audience t matches and returns how many took it
+// Each program gets it from its own goroutine, so one that is stuck
+// can't hold up the rest; one that's backlog messages behind misses it
+func (b *Broadcaster) SendTo(msg tea.Msg, t Target) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, r := range b.programs {
+		if !t.Matches(r.audience) {
+			continue
+		}
+		select {
+		case r.queue <- msg:
+			n++
+		default:
+		}
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package broadcast
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Roles a session can have, see Audience
+const (
+	RoleUser  = "user"
+	RoleGuest = "guest"
+	RoleAdmin = "admin"
+)
+
+// Audience is what targeting knows about a session, worked out when it starts
+type Audience struct {
+	Role   string
+	Locale string // as the client sent it, e.g. de_DE.UTF-8
+	// LastSeen is when the user was last here before this session, zero if never
+	LastSeen time.Time
+	// Bucket is 0-99, the same for a user every time, to reach a slice of them
+	Bucket int
+}
+
+// Bucket places key, e.g. a key fingerprint, in one of 100 buckets
+func Bucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
+
+// Target picks the sessions a message is for, every rule that's set must match
+// The zero Target matches everyone
+type Target struct {
+	Roles []string
+	// Locales are language or language_REGION prefixes, e.g. de or pt_BR
+	Locales []string
+	// SeenBefore and SeenAfter compare against Audience.LastSeen,
+	// users who have never been here count as seen before any date
+	SeenBefore time.Time
+	SeenAfter  time.Time
+	// Buckets is a range of Audience.Bucket, from Buckets[0] to Buckets[1] inclusive,
+	// only used when Bucketed is set
+	Buckets  [2]int
+	Bucketed bool
+}
+
+// ParseTarget reads rules like "role=user,guest;locale=de;seen-before=2026-09-01;bucket=0-9"
+// Dates are UTC, an empty spec matches everyone
+func ParseTarget(spec string) (Target, error) {
+	var t Target
+	for _, rule := range strings.Split(spec, ";") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(rule, "=")
+		if !ok {
+			return Target{}, fmt.Errorf("rule %q: want key=value", rule)
+		}
+		var err error
+		switch key {
+		case "role":
+			t.Roles = strings.Split(value, ",")
+			for _, r := range t.Roles {
+				if r != RoleUser && r != RoleGuest && r != RoleAdmin {
+					return Target{}, fmt.Errorf("rule %q: unknown role %q", rule, r)
+				}
+			}
+		case "locale":
+			t.Locales = strings.Split(value, ",")
+		case "seen-before":
+			t.SeenBefore, err = time.Parse(time.DateOnly, value)
+		case "seen-after":
+			t.SeenAfter, err = time.Parse(time.DateOnly, value)
+		case "bucket":
+			from, to, _ := strings.Cut(value, "-")
+			if to == "" {
+				to = from
+			}
+			t.Buckets[0], err = strconv.Atoi(from)
+			if err == nil {
+				t.Buckets[1], err = strconv.Atoi(to)
+			}
+			if err == nil && (t.Buckets[0] < 0 || t.Buckets[1] > 99 || t.Buckets[0] > t.Buckets[1]) {
+				err = fmt.Errorf("want a range within 0-99")
+			}
+			t.Bucketed = true
+		default:
+			return Target{}, fmt.Errorf("rule %q: unknown key %q", rule, key)
+		}
+		if err != nil {
+			return Target{}, fmt.Errorf("rule %q: %w", rule, err)
+		}
+	}
+	return t, nil
+}
+
+// Matches reports whether a session with audience a gets messages sent to t
+func (t Target) Matches(a Audience) bool {
+	if len(t.Roles) > 0 && !slices.Contains(t.Roles, a.Role) {
+		return false
+	}
+	if len(t.Locales) > 0 && !slices.ContainsFunc(t.Locales, func(l string) bool { return localeMatches(a.Locale, l) }) {
+		return false
+	}
+	if !t.SeenBefore.IsZero() && !a.LastSeen.Before(t.SeenBefore) {
+		return false
+	}
+	if !t.SeenAfter.IsZero() && !a.LastSeen.After(t.SeenAfter) {
+		return false
+	}
+	if t.Bucketed && (a.Bucket < t.Buckets[0] || a.Bucket > t.Buckets[1]) {
+		return false
+	}
+	return true
+}
+
+// localeMatches reports whether locale, e.g. de_DE.UTF-8, is in prefix, e.g. de or de_DE
+func localeMatches(locale, prefix string) bool {
+	locale, _, _ = strings.Cut(locale, ".")
+	if !strings.HasPrefix(locale, prefix) {
+		return false
+	}
+	// "de" shouldn't match a language like "dev"
+	rest := locale[len(prefix):]
+	return rest == "" || rest[0] == '_' || rest[0] == '@'
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+)
+
+// openBrowse shows everyone's submissions, starting with the newest page
+func (m model) openBrowse() (model, tea.Cmd) {
+	m.count("screen.browse")
+	m.nav = m.nav.Push(screens.NewBrowse(m.format, m.theme.Name, m.theme.Hint))
+	return m, loadPage(0, 0)
+}
+
+// loadPage reads page of everyone's submissions up to submission top for the Browse screen
+func loadPage(top int64, page int) tea.Cmd {
+	return func() tea.Msg {
+		msg := screens.BrowseMsg{At: now(), Top: top, Page: page}
+		rows, total, err := submissionStore.Page(top, page*screens.PageSize, screens.PageSize)
+		if err != nil {
+			log.Error("Could not load submissions", "page", page, "error", err)
+			msg.Err = "couldn't load that page, please try again"
+			return msg
+		}
+		// The first page pins the newest submission, later pages count from it
+		if top == 0 && len(rows) > 0 {
+			msg.Top = rows[0].ID
+		}
+		msg.Rows, msg.Total = rows, total
+		return msg
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// channelPolicy decides which SSH features besides the TUI session a client may use
+// Everything is denied by default: port forwarding, agent forwarding, X11, and any
+// other channel type. Every attempt is logged so probing shows up in the logs
+type channelPolicy struct {
+	// forwards lists the host:port destinations each key may local-forward to, by fingerprint
+	// Usernames are whatever the client says, and with open auth or forge keys
+	// anyone can log in as anyone, so only the key counts
+	forwards map[string][]string
+}
+
+// parseForwardRules reads a list like "SHA256:abc=localhost:8080,SHA256:abc=db:5432"
+func parseForwardRules(spec string) (channelPolicy, error) {
+	p := channelPolicy{forwards: map[string][]string{}}
+	for _, rule := range strings.Split(spec, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		fp, dest, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok || !strings.HasPrefix(fp, "SHA256:") {
+			return p, fmt.Errorf("forward rule %q: want SHA256:fingerprint=host:port", rule)
+		}
+		if _, _, err := net.SplitHostPort(dest); err != nil {
+			return p, fmt.Errorf("forward rule %q: %w", rule, err)
+		}
+		p.forwards[fp] = append(p.forwards[fp], dest)
+	}
+	return p, nil
+}
+
+// Option installs the policy on the server
+func (p channelPolicy) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		s.ChannelHandlers = map[string]ssh.ChannelHandler{
+			"session": ssh.DefaultSessionHandler,
+			// Only reached for destinations the callback below allows
+			"direct-tcpip": ssh.DirectTCPIPHandler,
+			"default":      rejectChannel,
+		}
+		s.RequestHandlers = map[string]ssh.RequestHandler{
+			"tcpip-forward":        denyRemoteForward,
+			"cancel-tcpip-forward": denyRemoteForward,
+		}
+		s.LocalPortForwardingCallback = p.allowLocalForward
+		s.ReversePortForwardingCallback = func(ctx ssh.Context, host string, port uint32) bool {
+			return false
+		}
+		return nil
+	}
+}
+
+// allowLocalForward checks a direct-tcpip request against the rules for the
+// key the client authenticated with, sessions without one get no forwards
+func (p channelPolicy) allowLocalForward(ctx ssh.Context, host string, port uint32) bool {
+	dest := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	fp := ""
+	if pk, ok := ctx.Value(ssh.ContextKeyPublicKey).(ssh.PublicKey); ok {
+		fp = gossh.FingerprintSHA256(pk)
+	}
+	allowed := fp != "" && slices.Contains(p.forwards[fp], dest)
+	log.Warn("Port forward attempt",
+		"user", ctx.User(), "key", fp, "remote", ctx.RemoteAddr(), "dest", dest, "allowed", allowed)
+	return allowed
+}
+
+// rejectChannel logs and refuses channel types we don't support (x11, agent, ...)
+func rejectChannel(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+	log.Warn("Channel denied",
+		"user", ctx.User(), "remote", ctx.RemoteAddr(), "type", newChan.ChannelType())
+	newChan.Reject(gossh.Prohibited, "channel type not allowed")
+}
+
+// denyRemoteForward logs and refuses remote (-R) port forwarding
+func denyRemoteForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	log.Warn("Remote port forward denied",
+		"user", ctx.User(), "remote", ctx.RemoteAddr(), "request", req.Type)
+	return false, nil
+}
+
+// agentForwardMiddleware logs sessions that asked for agent forwarding
+// The request itself is accepted by the ssh library, but we never open an
+// agent channel back to the client, so the forwarded agent is never usable
+func agentForwardMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if ssh.AgentRequested(s) {
+				log.Warn("Agent forwarding denied", "user", s.User(), "remote", s.RemoteAddr())
+			}
+			next(s)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// chaos injects faults for resilience testing, set by --chaos
+// Never turn it on in production, it disconnects real users
+var chaos chaosSettings
+
+// chaosSettings are the faults to inject, zero values turn a fault off
+type chaosSettings struct {
+	// latency delays the start of each session by up to this long
+	latency time.Duration
+	// disconnect drops each session's connection after a random time averaging this long
+	disconnect time.Duration
+	// storage delays every write to the data files by up to this long
+	storage time.Duration
+}
+
+// parseChaos reads a list like "latency=2s,disconnect=5m,storage=500ms"
+func parseChaos(spec string) (chaosSettings, error) {
+	var c chaosSettings
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		fault, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return c, fmt.Errorf("chaos %q: want fault=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return c, fmt.Errorf("chaos %q: %w", pair, err)
+		}
+		switch strings.TrimSpace(fault) {
+		case "latency":
+			c.latency = d
+		case "disconnect":
+			c.disconnect = d
+		case "storage":
+			c.storage = d
+		default:
+			return c, fmt.Errorf("chaos %q: unknown fault %q (want latency, disconnect or storage)", pair, fault)
+		}
+	}
+	return c, nil
+}
+
+// jitter returns a random duration up to max
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
+// slowStorage stalls the caller like a slow disk would
+// The model only writes from commands, so the stall never holds up Update
+func (c chaosSettings) slowStorage() {
+	time.Sleep(jitter(c.storage))
+}
+
+// Middleware delays sessions and drops their connections at random
+// It only does anything when listed in --middleware and given faults with --chaos
+func (c chaosSettings) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			time.Sleep(jitter(c.latency))
+			if c.disconnect > 0 {
+				// Exponential lifetimes, so most drops come early and a few sessions last long
+				after := time.Duration(rand.ExpFloat64() * float64(c.disconnect))
+				timer := time.AfterFunc(after, func() {
+					// Closing the connection itself looks like a network drop to both sides
+					if conn, ok := s.Context().Value(ssh.ContextKeyConn).(gossh.Conn); ok {
+						log.Warn("Chaos: dropping connection", "user", s.User(), "remote", s.RemoteAddr(), "after", after)
+						conn.Close()
+					}
+				})
+				defer timer.Stop()
+			}
+			next(s)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/avatar"
+	"github.com/jwc20/wish-bubbletea-tests/basic/chat"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+)
+
+// openChat joins the room as the user and shows it, they leave when the
+// screen closes or the session ends
+// Guests only watch, they have no name of their own to talk under,
+// nor do admins viewing as someone read-only
+func (m model) openChat() (model, tea.Cmd) {
+	var member *chat.Member
+	var history []chat.Message
+	var ok bool
+	if m.guest || m.readOnly {
+		member, history, ok = room.Watch(m.done)
+	} else {
+		member, history, ok = room.Join(m.name, avatar.Badge(m.fingerprint), m.done)
+	}
+	if !ok {
+		// The server is shutting down
+		return m, nil
+	}
+	m.count("screen.chat")
+	c := screens.NewChat(member, history, m.format, m.theme.Name, m.theme.Hint, m.width, m.height)
+	m.nav = m.nav.Push(c)
+	return m, tea.Batch(c.Listen(), textinput.Blink)
+}
@@ -0,0 +1,185 @@
+// Package chat is a room every session can talk in.
+//
+// A Hub goroutine owns the room: members join and leave through it and
+// everything said goes through it, so the member list needs no lock. Each
+// member gets messages on its own buffered channel, and a member that stops
+// reading misses messages rather than holding up everyone else.
+package chat
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kind is what a Message is about
+type Kind int
+
+const (
+	Said Kind = iota
+	Joined
+	Left
+)
+
+// Message is something said in the room, or someone coming or going
+type Message struct {
+	At   time.Time
+	Kind Kind
+	From string
+	// Badge is From's avatar.Badge
+	Badge string
+	Text  string // empty for Joined and Left
+	// Here is how many were in the room once it happened
+	Here int
+}
+
+const (
+	// History is how many recent messages someone joining sees
+	History = 50
+	// buffered is how far a member can fall behind before missing messages
+	buffered = 64
+)
+
+// Member is one session in the room
+type Member struct {
+	Name  string
+	Badge string
+	// Watching is true for members who only read, see Hub.Watch
+	Watching bool
+	// C has what happens in the room, it's closed once the member has left
+	C chan Message
+
+	hub  *Hub
+	once sync.Once
+	gone chan struct{}
+}
+
+type joining struct {
+	m       *Member
+	history chan []Message
+}
+
+// Hub runs the room, start it with Run
+type Hub struct {
+	join    chan joining
+	leave   chan *Member
+	say     chan Message
+	stopped chan struct{}
+}
+
+// NewHub returns an empty room
+func NewHub() *Hub {
+	return &Hub{
+		join:    make(chan joining),
+		leave:   make(chan *Member),
+		say:     make(chan Message),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run handles the room until ctx is done, when every member's channel is closed
+func (h *Hub) Run(ctx context.Context) {
+	defer close(h.stopped)
+	// members maps everyone in the room to whether they talk, see Watch
+	members := map[*Member]bool{}
+	var recent []Message
+	send := func(msg Message) {
+		msg.Here = 0
+		for _, talks := range members {
+			if talks {
+				msg.Here++
+			}
+		}
+		for m := range members {
+			select {
+			case m.C <- msg:
+			default:
+			}
+		}
+		recent = append(recent, msg)
+		if len(recent) > History {
+			recent = recent[len(recent)-History:]
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for m := range members {
+				close(m.C)
+			}
+			return
+		case j := <-h.join:
+			// A copy, recent keeps changing after this
+			j.history <- append([]Message(nil), recent...)
+			members[j.m] = !j.m.Watching
+			if !j.m.Watching {
+				send(Message{At: time.Now(), Kind: Joined, From: j.m.Name, Badge: j.m.Badge})
+			}
+		case m := <-h.leave:
+			if talks, ok := members[m]; ok {
+				delete(members, m)
+				close(m.C)
+				if talks {
+					send(Message{At: time.Now(), Kind: Left, From: m.Name, Badge: m.Badge})
+				}
+			}
+		case msg := <-h.say:
+			send(msg)
+		}
+	}
+}
+
+// Join adds name to the room with their badge, returning the member and what was said
+// recently, oldest first
+// The member leaves when done is closed, e.g. the session's context ends,
+// if they haven't already; ok is false when the room has closed
+func (h *Hub) Join(name, badge string, done <-chan struct{}) (m *Member, history []Message, ok bool) {
+	return h.add(&Member{Name: name, Badge: badge}, done)
+}
+
+// Watch is Join for someone who only reads: nobody is told they came or
+// went, they aren't counted as here, and what they Say goes nowhere
+func (h *Hub) Watch(done <-chan struct{}) (m *Member, history []Message, ok bool) {
+	return h.add(&Member{Watching: true}, done)
+}
+
+func (h *Hub) add(m *Member, done <-chan struct{}) (*Member, []Message, bool) {
+	m.C, m.hub, m.gone = make(chan Message, buffered), h, make(chan struct{})
+	j := joining{m: m, history: make(chan []Message, 1)}
+	select {
+	case h.join <- j:
+	case <-h.stopped:
+		return nil, nil, false
+	}
+	go func() {
+		select {
+		case <-done:
+			m.Leave()
+		case <-m.gone:
+		}
+	}()
+	return m, <-j.history, true
+}
+
+// Say sends text to everyone in the room, the member included
+func (m *Member) Say(text string) {
+	if m.Watching {
+		return
+	}
+	select {
+	case m.hub.say <- Message{At: time.Now(), Kind: Said, From: m.Name, Badge: m.Badge, Text: text}:
+	case <-m.gone:
+	case <-m.hub.stopped:
+	}
+}
+
+// Leave takes the member out of the room, it's safe to call more than once
+func (m *Member) Leave() {
+	m.once.Do(func() {
+		close(m.gone)
+		select {
+		case m.hub.leave <- m:
+		case <-m.hub.stopped:
+		}
+	})
+}
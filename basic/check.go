@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/admin"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// checkProblem is a failed startup check with a hint on how to fix it
+type checkProblem struct {
+	what string
+	err  error
+	fix  string
+}
+
+func (p checkProblem) Error() string {
+	return fmt.Sprintf("%s: %v (%s)", p.what, p.err, p.fix)
+}
+
+// runChecks validates everything the server needs before it can accept sessions
+// It is used by the `check` subcommand and again at startup, so both agree on what "healthy" means
+// Checks of the app's data are in dataChecks, startup runs those while already accepting
+// The port is checked separately since startup retries a busy port instead of failing
+// hostKeyPath is empty when the key comes from a secret, hostKeyErr is the result of loading it
+// secretsErr is the result of opening --secrets and loading the other secrets from it
+func runChecks(hostKeyPath string, hostKeyErr, secretsErr error) []error {
+	var problems []error
+	if secretsErr != nil {
+		problems = append(problems, checkProblem{
+			what: "secrets",
+			err:  secretsErr,
+			fix:  "check --secrets and the *-secret flags and that the provider is reachable",
+		})
+	}
+	if hostKeyErr != nil {
+		problems = append(problems, checkProblem{
+			what: "host key",
+			err:  hostKeyErr,
+			fix:  "check the --host-key-* and --secrets flags and that the provider or agent is reachable",
+		})
+	}
+	if hostKeyPath != "" {
+		if err := checkHostKey(hostKeyPath); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if authKeys != nil {
+		if err := authKeys.Check(); err != nil {
+			problems = append(problems, checkProblem{
+				what: "authorized keys",
+				err:  err,
+				fix:  "fix the file or point --authorized-keys at the right one",
+			})
+		}
+	}
+	if passwords != nil {
+		if err := passwords.Check(); err != nil {
+			problems = append(problems, checkProblem{
+				what: "passwords",
+				err:  err,
+				fix:  "fix the file or point --passwords at the right one, `hash-password NAME` makes its lines",
+			})
+		}
+	}
+	if err := admin.CheckDirs(adminFiles); err != nil {
+		problems = append(problems, checkProblem{
+			what: "admin files",
+			err:  err,
+			fix:  "create the directories or fix --admin-files",
+		})
+	}
+	if err := checkRecordDir(); err != nil {
+		problems = append(problems, checkProblem{
+			what: "session recordings",
+			err:  err,
+			fix:  "make the directory writable or point --record-sessions somewhere else",
+		})
+	}
+	return problems
+}
+
+// checkHostKey makes sure the host key is usable
+// A missing key is fine because wish generates one on startup
+func checkHostKey(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// wish will create the directory too, but only if nothing else is in the way
+		if info, err := os.Stat(filepath.Dir(path)); err == nil && !info.IsDir() {
+			return checkProblem{
+				what: "host key " + path,
+				err:  fmt.Errorf("%s is not a directory", filepath.Dir(path)),
+				fix:  "move that file out of the way so the key directory can be created",
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return checkProblem{what: "host key " + path, err: err, fix: "check the file permissions"}
+	}
+	if _, err := gossh.ParsePrivateKey(data); err != nil {
+		return checkProblem{
+			what: "host key " + path,
+			err:  err,
+			fix:  "use an unencrypted private key, or delete it to have a new one generated",
+		}
+	}
+	return nil
+}
+
+// checkPort makes sure nothing else is already listening on addr
+func checkPort(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return checkProblem{
+			what: "listen address " + addr,
+			err:  err,
+			fix:  "stop whatever is using the port or pick another one",
+		}
+	}
+	return ln.Close()
+}
+
+// checkCommand implements `basic check` and returns the process exit code
+func checkCommand(hostKeyPath string, hostKeyErr, secretsErr error, addr, dbPath string) int {
+	problems := runChecks(hostKeyPath, hostKeyErr, secretsErr)
+	for _, step := range dataChecks(dbPath) {
+		if err := step.run(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if err := checkPort(addr); err != nil {
+		problems = append(problems, err)
+	}
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, "✗", p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println("✓ all checks passed")
+	return 0
+}
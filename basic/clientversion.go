@@ -0,0 +1,119 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// maxClientVersions is how many versions are counted separately, the version
+// string is whatever the client sends, so the rest are counted together as
+// otherClientVersions rather than growing the counts without end
+const maxClientVersions = 100
+
+const otherClientVersions = "other"
+
+// clients is set up in main and shared with the runtime controls for stats
+var clients *clientPolicy
+
+// clientPolicy blocks or warns about SSH clients by their version string
+// (e.g. "SSH-2.0-OpenSSH_9.6") and counts which versions connect
+type clientPolicy struct {
+	// deny and warn are glob patterns such as "SSH-2.0-libssh*"
+	deny []string
+	warn []string
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// splitPatterns turns a comma separated flag value into patterns
+func splitPatterns(spec string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(spec, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		// Catch typos in the pattern at startup rather than on the first connection
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func newClientPolicy(deny, warn string) (*clientPolicy, error) {
+	d, err := splitPatterns(deny)
+	if err != nil {
+		return nil, err
+	}
+	w, err := splitPatterns(warn)
+	if err != nil {
+		return nil, err
+	}
+	return &clientPolicy{deny: d, warn: w, counts: map[string]int{}}, nil
+}
+
+// matches reports whether version matches any of the patterns
+func matches(patterns []string, version string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, version); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware counts every client version and applies the deny and warn lists
+func (c *clientPolicy) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			version := s.Context().ClientVersion()
+			c.count(version)
+
+			switch {
+			case matches(c.deny, version):
+				log.Warn("Client version denied", "user", s.User(), "remote", s.RemoteAddr(), "version", version)
+				wish.Fatalln(s, "Your SSH client ("+version+") is not supported, please upgrade it and try again.")
+				return
+			case matches(c.warn, version):
+				log.Warn("Client version flagged", "user", s.User(), "remote", s.RemoteAddr(), "version", version)
+				// Printed before the alt screen starts, so it's still there after the app exits
+				wish.Errorln(s, "Warning: your SSH client ("+version+") has known problems, consider upgrading.")
+			}
+			next(s)
+		}
+	}
+}
+
+// count adds a session to version's count
+func (c *clientPolicy) count(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counts[version]; !ok && len(c.counts) >= maxClientVersions {
+		version = otherClientVersions
+	}
+	c.counts[version]++
+}
+
+// LogStats logs how many sessions each client version opened, most common first
+func (c *clientPolicy) LogStats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := make([]string, 0, len(c.counts))
+	for v := range c.counts {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return c.counts[versions[i]] > c.counts[versions[j]] })
+	for _, v := range versions {
+		log.Info("Client version", "version", v, "sessions", c.counts[v])
+	}
+}
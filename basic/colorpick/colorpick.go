@@ -0,0 +1,181 @@
+// Package colorpick is a color picker: a palette grid, a hex entry box, and a
+// swatch previewing the color as the client's terminal will actually show it.
+//
+// Picked colors are clamped to the session's color profile, so a theme built
+// on a 256 color terminal stores the colors the user really saw.
+package colorpick
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+const columns = 8
+
+// palette is a starting point, anything else can be typed as hex
+var palette = []string{
+	"#000000", "#800000", "#008000", "#808000", "#000080", "#800080", "#008080", "#c0c0c0",
+	"#808080", "#ff0000", "#00ff00", "#ffff00", "#0000ff", "#ff00ff", "#00ffff", "#ffffff",
+	"#ff5f87", "#ff8700", "#ffd75f", "#87d75f", "#5fd7ff", "#5f87ff", "#af87ff", "#d787d7",
+	"#3a3a3a", "#585858", "#767676", "#949494", "#b2b2b2", "#d0d0d0", "#e4e4e4", "#eeeeee",
+}
+
+var hexColor = regexp.MustCompile(`^#?[0-9a-fA-F]{6}$`)
+
+// PickedMsg carries the chosen color, already clamped to the session's profile
+type PickedMsg struct {
+	Color lipgloss.Color
+}
+
+// ClosedMsg is sent when the picker is dismissed without picking
+type ClosedMsg struct{}
+
+// Model is the picker
+type Model struct {
+	r       *lipgloss.Renderer
+	hex     textinput.Model
+	cursor  int
+	editing bool // true while the hex box has focus instead of the grid
+
+	selected lipgloss.Style
+}
+
+// New creates a picker rendering through r, whose color profile the colors are clamped to
+func New(r *lipgloss.Renderer) Model {
+	hex := textinput.New()
+	hex.Placeholder = "#rrggbb"
+	hex.CharLimit = 7
+	hex.Width = 8
+	return Model{
+		r:        r,
+		hex:      hex,
+		selected: r.NewStyle().Bold(true),
+	}
+}
+
+// Open shows the picker starting from current, which may be empty
+func (m Model) Open(current lipgloss.Color) Model {
+	m.editing = false
+	m.hex.Blur()
+	m.hex.SetValue(string(current))
+	for i, c := range palette {
+		if strings.EqualFold(c, string(current)) {
+			m.cursor = i
+		}
+	}
+	return m
+}
+
+// value is the hex color currently chosen, or "" if the typed one isn't valid
+func (m Model) value() string {
+	if !m.editing {
+		return palette[m.cursor]
+	}
+	v := strings.TrimSpace(m.hex.Value())
+	if !hexColor.MatchString(v) {
+		return ""
+	}
+	return "#" + strings.ToLower(strings.TrimPrefix(v, "#"))
+}
+
+// Clamp returns the nearest color the profile can display, as hex
+// Terminals without color get "", which lipgloss treats as no color
+func Clamp(p termenv.Profile, hex string) lipgloss.Color {
+	switch c := p.Color(hex).(type) {
+	case nil, termenv.NoColor:
+		return ""
+	default:
+		return lipgloss.Color(termenv.ConvertToRGB(c).Hex())
+	}
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			return m, func() tea.Msg { return ClosedMsg{} }
+		case "enter":
+			v := m.value()
+			if v == "" {
+				return m, nil
+			}
+			c := Clamp(m.r.ColorProfile(), v)
+			return m, func() tea.Msg { return PickedMsg{Color: c} }
+		case "tab":
+			// Switch between the grid and the hex box, carrying the color across
+			m.editing = !m.editing
+			if m.editing {
+				m.hex.SetValue(palette[m.cursor])
+				m.hex.CursorEnd()
+				return m, m.hex.Focus()
+			}
+			m.hex.Blur()
+			return m, nil
+		}
+		if !m.editing {
+			switch key.String() {
+			case "left":
+				m.cursor = max(m.cursor-1, 0)
+			case "right":
+				m.cursor = min(m.cursor+1, len(palette)-1)
+			case "up":
+				m.cursor = max(m.cursor-columns, 0)
+			case "down":
+				m.cursor = min(m.cursor+columns, len(palette)-1)
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.hex, cmd = m.hex.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View() string {
+	var sb strings.Builder
+	for i, c := range palette {
+		cell := m.r.NewStyle().Background(lipgloss.Color(c)).Render("    ")
+		if i == m.cursor && !m.editing {
+			cell = m.selected.Render("[") + cell + m.selected.Render("]")
+		} else {
+			cell = " " + cell + " "
+		}
+		sb.WriteString(cell)
+		if (i+1)%columns == 0 {
+			sb.WriteString("\n")
+		}
+	}
+
+	sb.WriteString("\nhex " + m.hex.View() + "\n\n")
+
+	v := m.value()
+	if v == "" {
+		sb.WriteString("not a color, use #rrggbb")
+	} else {
+		// The swatch is drawn with the clamped color, so what you see is what you get
+		shown := Clamp(m.r.ColorProfile(), v)
+		swatch := m.r.NewStyle().Background(shown).Render("        ")
+		sb.WriteString(fmt.Sprintf("%s %s", swatch, v))
+		if !strings.EqualFold(string(shown), v) {
+			sb.WriteString(fmt.Sprintf(" (shown as %s on this terminal)", displayName(shown)))
+		}
+	}
+
+	sb.WriteString("\n\narrows to move • tab for hex • enter to use • esc to close")
+	return sb.String()
+}
+
+// displayName describes a clamped color for the preview line
+func displayName(c lipgloss.Color) string {
+	if c == "" {
+		return "no color"
+	}
+	return string(c)
+}
@@ -0,0 +1,102 @@
+// Package config reads server settings from a YAML file, with environment
+// variables taking precedence over the file.
+//
+// A file looks like:
+//
+//	profile: prod
+//	host: 0.0.0.0
+//	port: 2222
+//	host_key: /var/lib/basic/host_key
+//	log_level: info
+//	middleware: [logging, clients, maintenance, drain, scanners, activeterm, bubbletea]
+//	banner: Oat milk is back
+//	admins: [SHA256:q3gP3k2…]
+//	rate_limit: 20
+//	rate_window: 1m
+//	ban_for: 1h
+//
+// Every field is optional, anything left out keeps the profile's value.
+// The same binary can then run in dev and prod with different files.
+//
+// The banner, admins, rate limits and log level can also change while the
+// server runs: it reads the file again on SIGHUP.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override the file,
+// e.g. BASIC_PORT=2222
+const EnvPrefix = "BASIC_"
+
+// File is what a config file can set
+// Empty fields mean "not set", so the caller keeps its own default
+type File struct {
+	Profile    string   `yaml:"profile"`
+	Host       string   `yaml:"host"`
+	Port       string   `yaml:"port"`
+	HostKey    string   `yaml:"host_key"`
+	LogLevel   string   `yaml:"log_level"`
+	Middleware []string `yaml:"middleware"`
+	// Banner is shown at the top of every session, empty for none
+	Banner string   `yaml:"banner"`
+	Admins []string `yaml:"admins"`
+	// RateLimit, RateWindow and BanFor are as the --rate-limit flags, e.g. "20", "1m", "1h"
+	RateLimit  string `yaml:"rate_limit"`
+	RateWindow string `yaml:"rate_window"`
+	BanFor     string `yaml:"ban_for"`
+}
+
+// Load reads the file at path, or nothing if path is empty, then applies
+// BASIC_* environment variables on top
+func Load(path string) (File, error) {
+	var f File
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return f, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		// Misspelled keys are errors rather than silently ignored settings
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+			return f, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	f.applyEnv(os.LookupEnv)
+	return f, nil
+}
+
+// applyEnv overrides fields from the environment, lookup is os.LookupEnv
+func (f *File) applyEnv(lookup func(string) (string, bool)) {
+	for name, field := range map[string]*string{
+		"PROFILE":     &f.Profile,
+		"HOST":        &f.Host,
+		"PORT":        &f.Port,
+		"HOST_KEY":    &f.HostKey,
+		"LOG_LEVEL":   &f.LogLevel,
+		"BANNER":      &f.Banner,
+		"RATE_LIMIT":  &f.RateLimit,
+		"RATE_WINDOW": &f.RateWindow,
+		"BAN_FOR":     &f.BanFor,
+	} {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*field = v
+		}
+	}
+	// Lists are comma separated in the environment
+	if v, ok := lookup(EnvPrefix + "MIDDLEWARE"); ok {
+		f.Middleware = strings.Split(v, ",")
+	}
+	if v, ok := lookup(EnvPrefix + "ADMINS"); ok {
+		f.Admins = strings.Split(v, ",")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/overlay"
+	"github.com/jwc20/wish-bubbletea-tests/basic/prompt"
+)
+
+// builtinContent is the default content compiled into the binary,
+// so the server runs without a content directory next to it
+//
+//go:embed content
+var builtinContent embed.FS
+
+// contentFS is the content sessions see: files in contentDir override the built-in ones
+// It is cheap to build, so it's made per use and always reflects the current --content
+func contentFS() fs.FS {
+	builtin, err := fs.Sub(builtinContent, "content")
+	if err != nil {
+		// The embed pattern above guarantees the directory exists
+		panic(err)
+	}
+	return overlay.New(os.DirFS(contentDir), builtin)
+}
+
+// content tells running sessions when the content directory changes
+var content = newContentWatcher()
+
+// contentWatcher polls the content directory and broadcasts changes to sessions
+// Every session waits on the same channel, which is closed on a change and
+// replaced with a fresh one for the next change
+type contentWatcher struct {
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+func newContentWatcher() *contentWatcher {
+	return &contentWatcher{changed: make(chan struct{})}
+}
+
+// wait returns a channel that is closed the next time the content changes
+func (w *contentWatcher) wait() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.changed
+}
+
+// notify wakes every waiting session
+func (w *contentWatcher) notify() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// watch polls dir every interval until ctx is done
+// Polling keeps this dependency free and works the same on every OS
+// and on network filesystems, where change notifications are unreliable
+func (w *contentWatcher) watch(ctx context.Context, dir string, interval time.Duration) {
+	last := snapshot(dir)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		now := snapshot(dir)
+		if now == last {
+			continue
+		}
+		last = now
+		// Half-edited files would break every session, so only broadcast content that loads
+		if err := prompt.Check(contentFS()); err != nil {
+			log.Error("Content changed but doesn't load, keeping the old content", "error", err)
+			continue
+		}
+		log.Info("Content changed, refreshing sessions", "dir", dir)
+		w.notify()
+	}
+}
+
+// snapshot summarizes the names, sizes and modification times under dir
+// Two equal snapshots mean nothing changed
+func snapshot(dir string) string {
+	var sb strings.Builder
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return sb.String()
+}
+
+// contentMsg tells the model the content directory changed
+type contentMsg struct{}
+
+// waitForContent is a command that blocks until the content changes
+func waitForContent(changed <-chan struct{}) tea.Cmd {
+	return func() tea.Msg {
+		<-changed
+		return contentMsg{}
+	}
+}
+
+// loadPrompt renders the prompt and placeholder for a session
+// Problems are logged and the built-in text is used instead
+func loadPrompt(locale, user string) (text, placeholder string) {
+	tmpl, err := prompt.Load(contentFS(), locale)
+	if err != nil {
+		log.Error("Could not load prompt", "error", err)
+	}
+	text, placeholder, err = tmpl.Render(prompt.Vars{User: user, Now: time.Now()})
+	if err != nil {
+		log.Error("Could not render prompt", "error", err)
+		text, placeholder = tmpl.Prompt, tmpl.Placeholder
+	}
+	return text, placeholder
+}
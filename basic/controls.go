@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+)
+
+// maintenance is toggled at runtime by operators (see controls_unix.go)
+// While it's on, new sessions get a short notice instead of the app
+var maintenance atomic.Bool
+
+// maintenanceMiddleware turns new sessions away while maintenance mode is on
+// Sessions that are already running are left alone
+func maintenanceMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if maintenance.Load() {
+				wish.Fatalln(s, "The server is down for maintenance, please try again in a few minutes.")
+				return
+			}
+			next(s)
+		}
+	}
+}
+
+// setMaintenance switches maintenance mode and logs the change
+func setMaintenance(on bool) {
+	maintenance.Store(on)
+	log.Info("Maintenance mode changed", "on", on)
+}
+
+// toggleDebug flips the log level between debug and info
+func toggleDebug() {
+	level := log.DebugLevel
+	if log.GetLevel() == log.DebugLevel {
+		level = log.InfoLevel
+	}
+	log.SetLevel(level)
+	log.Info("Log level changed", "to", level.String())
+}
+
+// dumpStacks writes every goroutine's stack to stderr without stopping the server
+// Unlike SIGQUIT, which prints the same thing and then exits
+func dumpStacks() {
+	log.Info("Dumping goroutine stacks")
+	if err := pprof.Lookup("goroutine").WriteTo(os.Stderr, 2); err != nil {
+		log.Error("Could not dump goroutine stacks", "error", err)
+	}
+}
+
+// logBans logs every ban in force and how many connections were turned away
+func logBans() {
+	bans := rateLimits.Bans(time.Now())
+	for _, b := range bans {
+		log.Info("Ban", "host", b.Host, "until", b.Until.Format(time.RFC3339))
+	}
+	throttled, refused := rateLimits.Stats()
+	log.Info("Rate limit stats", "banned", len(bans), "throttled", throttled, "refused", refused)
+}
+
+// logSessions logs every connected session, with the ID kick takes
+func logSessions() {
+	list := connected.List()
+	for _, info := range list {
+		log.Info("Session", "id", info.ID, "user", info.User, "remote", info.Remote,
+			"connected", info.Connected.Format(time.RFC3339), "size", fmt.Sprintf("%dx%d", info.Width, info.Height))
+	}
+	log.Info("Sessions connected", "count", len(list))
+}
+
+// runControl executes one operator command, e.g. from the control FIFO
+//
+//	log-level debug|info|warn|error
+//	maintenance on|off
+//	stacks
+//	scanners
+//	clients
+//	queue
+//	bans
+//	unban HOST
+//	sessions
+//	kick ID
+//	broadcast [TEXT...]   (no text clears the banner)
+//	broadcast-to RULES [TEXT...]   (only sessions matching RULES, see broadcast.ParseTarget)
+//	breakers
+//	reload   (read --config again, as SIGHUP does)
+//	record [USER on|off]   (who --record-sessions records, from their next session)
+func runControl(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	switch cmd, args := fields[0], fields[1:]; {
+	case cmd == "log-level" && len(args) == 1:
+		level, err := log.ParseLevel(args[0])
+		if err != nil {
+			return err
+		}
+		log.SetLevel(level)
+		log.Info("Log level changed", "to", level.String())
+	case cmd == "maintenance" && len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		setMaintenance(args[0] == "on")
+	case cmd == "stacks" && len(args) == 0:
+		dumpStacks()
+	case cmd == "scanners" && len(args) == 0 && scanners != nil:
+		scanners.LogStats()
+	case cmd == "clients" && len(args) == 0 && clients != nil:
+		clients.LogStats()
+	case cmd == "queue" && len(args) == 0 && admissions != nil:
+		admissions.LogStats()
+	case cmd == "bans" && len(args) == 0 && rateLimits != nil:
+		logBans()
+	case cmd == "unban" && len(args) == 1 && rateLimits != nil:
+		lifted, err := rateLimits.Unban(args[0])
+		if err != nil {
+			return fmt.Errorf("unban: %w", err)
+		}
+		if !lifted {
+			return fmt.Errorf("unban: %s isn't banned", args[0])
+		}
+		log.Info("Ban lifted", "host", args[0])
+	case cmd == "sessions" && len(args) == 0:
+		logSessions()
+	case cmd == "breakers" && len(args) == 0:
+		logBreakers()
+	case cmd == "reload" && len(args) == 0:
+		return reloadConfig()
+	case cmd == "record" && len(args) == 0:
+		logRecording()
+	case cmd == "record" && len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+		recordUsers.set(args[0], args[1] == "on")
+		log.Info("Session recording changed", "user", args[0], "on", args[1] == "on", "dir", recordDir)
+	case cmd == "kick" && len(args) == 1:
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("kick: %q is not a session ID", args[0])
+		}
+		if !connected.Kill(id, "an operator closed this session") {
+			return fmt.Errorf("kick: no session %d", id)
+		}
+		log.Info("Session kicked", "id", id)
+	case cmd == "broadcast-to" && len(args) > 0:
+		target, err := broadcast.ParseTarget(args[0])
+		if err != nil {
+			return fmt.Errorf("broadcast-to: %w", err)
+		}
+		text := strings.Join(args[1:], " ")
+		n := broadcaster.SendTo(broadcast.Banner{Text: text, At: time.Now()}, target)
+		log.Info("Banner sent", "text", text, "to", args[0], "sessions", n)
+	case cmd == "broadcast":
+		text := strings.Join(args, " ")
+		n := broadcaster.Send(broadcast.Banner{Text: text, At: time.Now()})
+		log.Info("Banner sent", "text", text, "sessions", n)
+	default:
+		return fmt.Errorf("unknown control command %q", line)
+	}
+	return nil
+}
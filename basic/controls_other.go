@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import "github.com/charmbracelet/log"
+
+// watchControls is unix only, there are no SIGUSR signals or FIFOs elsewhere
+func watchControls(fifo string) {
+	if fifo != "" {
+		log.Warn("Control FIFO is not supported on this platform", "path", fifo)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build unix
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+)
+
+// watchControls lets operators change the running server without a restart
+//
+//	SIGUSR1  toggle debug logging
+//	SIGUSR2  toggle maintenance mode
+//	SIGHUP   read --config again, see reloadConfig
+//
+// If fifo is set, the same commands as runControl are also read from that named pipe,
+// e.g. echo "maintenance on" > control.fifo
+func watchControls(fifo string) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	go func() {
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGUSR1:
+				toggleDebug()
+			case syscall.SIGUSR2:
+				setMaintenance(!maintenance.Load())
+			case syscall.SIGHUP:
+				if err := reloadConfig(); err != nil {
+					log.Error("Could not reload --config, nothing changed", "error", err)
+				}
+			}
+		}
+	}()
+
+	if fifo == "" {
+		return
+	}
+	if err := syscall.Mkfifo(fifo, 0600); err != nil && !errors.Is(err, os.ErrExist) {
+		log.Error("Could not create control FIFO", "path", fifo, "error", err)
+		return
+	}
+	go readControlFIFO(fifo)
+}
+
+// readControlFIFO runs commands written to the FIFO, one per line
+// Opening blocks until a writer shows up, and each writer closing ends the read loop,
+// so the FIFO is simply reopened for the next one
+func readControlFIFO(fifo string) {
+	for {
+		f, err := os.Open(fifo)
+		if err != nil {
+			log.Error("Could not open control FIFO", "path", fifo, "error", err)
+			return
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if err := runControl(scanner.Text()); err != nil {
+				log.Warn("Control command failed", "error", err)
+			}
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/theme"
+)
+
+// maxInputLength caps how much a user can type, set by --max-length
+var maxInputLength = 64
+
+// counterStyles colour the character counter as the input nears its limit
+type counterStyles struct {
+	normal lipgloss.Style
+	warn   lipgloss.Style
+	full   lipgloss.Style
+}
+
+// newCounterStyles takes the colours from the session's theme
+func newCounterStyles(t theme.Theme) counterStyles {
+	return counterStyles{
+		normal: t.Hint,
+		warn:   t.Warn,
+		full:   t.Error,
+	}
+}
+
+// render shows "12/64" with f's digits, switching to a warning colour in the last 10%
+func (c counterStyles) render(f l10n.Formatter, n, limit int) string {
+	text := f.Int(n) + "/" + f.Int(limit)
+	switch {
+	case n >= limit:
+		return c.full.Render(text)
+	case n*10 >= limit*9:
+		return c.warn.Render(text)
+	default:
+		return c.normal.Render(text)
+	}
+}
+
+// validateInput checks a submission again before it is saved
+// The text input already stops typing at the limit, but the server shouldn't rely on that
+func validateInput(value string) error {
+	if n := utf8.RuneCountInString(value); n > maxInputLength {
+		return fmt.Errorf("that's %d characters, the limit is %d", n, maxInputLength)
+	}
+	return nil
+}
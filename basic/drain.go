@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+)
+
+// drainPolicy decides what happens to a session when the server shuts down
+type drainPolicy string
+
+const (
+	// drainImmediate closes the session as soon as shutdown starts
+	drainImmediate drainPolicy = "immediate"
+	// drainIdle lets the session finish what it's doing and closes it once idle
+	drainIdle drainPolicy = "wait-for-idle"
+	// drainDeadline leaves the session alone until the drain timeout runs out
+	drainDeadline drainPolicy = "hard-deadline"
+)
+
+// Session kinds are named after the screen the session is on
+const (
+	kindTOS    = "tos"
+	kindPrompt = "prompt"
+)
+
+// Ways a session can end while draining, used for the shutdown summary
+const (
+	endedLeft   = "left"   // the user quit on their own
+	endedClosed = "closed" // the policy closed it
+	endedCut    = "cut"    // still running when the drain timeout hit
+)
+
+// parseDrainPolicies reads a list like "prompt=wait-for-idle,tos=immediate"
+func parseDrainPolicies(spec string) (map[string]drainPolicy, error) {
+	policies := map[string]drainPolicy{}
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kind, policy, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("drain policy %q: want kind=policy", pair)
+		}
+		switch p := drainPolicy(strings.TrimSpace(policy)); p {
+		case drainImmediate, drainIdle, drainDeadline:
+			policies[strings.TrimSpace(kind)] = p
+		default:
+			return nil, fmt.Errorf("drain policy %q: unknown policy %q", pair, policy)
+		}
+	}
+	return policies, nil
+}
+
+// liveSession is what the drainer knows about one running session
+// The model updates kind and busy from its own goroutine, hence the atomics
+type liveSession struct {
+	kind   atomic.Value // string
+	busy   atomic.Bool
+	closed atomic.Bool // set when the drainer closed it rather than the user
+	cut    atomic.Bool // set when it was still open at the drain timeout
+
+	// stop is closed to ask the model to quit, see waitForDrain
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// requestStop asks the session's program to quit
+// Quitting from inside the program restores the client's terminal properly
+func (l *liveSession) requestStop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// drainMsg tells the model the server is draining its session
+type drainMsg struct{}
+
+// waitForDrain is a command that blocks until the drainer stops the session
+func waitForDrain(l *liveSession) tea.Cmd {
+	return func() tea.Msg {
+		<-l.stop
+		return drainMsg{}
+	}
+}
+
+// track records what the session is currently doing
+func (l *liveSession) track(kind string, busy bool) {
+	l.kind.Store(kind)
+	l.busy.Store(busy)
+}
+
+// liveSessionKey stores the *liveSession in the ssh context for teaHandler
+type liveSessionKey struct{}
+
+// drainer keeps the set of running sessions and closes them on shutdown
+// according to the policy for each session's kind
+type drainer struct {
+	policies map[string]drainPolicy
+	fallback drainPolicy
+
+	mu       sync.Mutex
+	sessions map[*liveSession]struct{}
+	draining bool
+	// ended counts how sessions ended during the drain, per policy and outcome
+	ended map[drainPolicy]map[string]int
+}
+
+func newDrainer(policies map[string]drainPolicy) *drainer {
+	return &drainer{
+		policies: policies,
+		fallback: drainDeadline,
+		sessions: map[*liveSession]struct{}{},
+		ended:    map[drainPolicy]map[string]int{},
+	}
+}
+
+// policy returns the drain policy for a session based on its current kind
+func (d *drainer) policy(l *liveSession) drainPolicy {
+	kind, _ := l.kind.Load().(string)
+	if p, ok := d.policies[kind]; ok {
+		return p
+	}
+	return d.fallback
+}
+
+// Middleware registers every session so it can be drained later
+// It must run before the bubbletea middleware so teaHandler can find the liveSession
+func (d *drainer) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			l := &liveSession{stop: make(chan struct{})}
+			l.track(kindPrompt, false)
+			s.Context().SetValue(liveSessionKey{}, l)
+
+			d.mu.Lock()
+			d.sessions[l] = struct{}{}
+			d.mu.Unlock()
+
+			next(s)
+
+			d.mu.Lock()
+			delete(d.sessions, l)
+			// Cut sessions were already counted when the timeout hit
+			if d.draining && !l.cut.Load() {
+				outcome := endedLeft
+				if l.closed.Load() {
+					outcome = endedClosed
+				}
+				d.count(d.policy(l), outcome)
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// count bumps a drain outcome; callers must hold d.mu
+func (d *drainer) count(p drainPolicy, outcome string) {
+	if d.ended[p] == nil {
+		d.ended[p] = map[string]int{}
+	}
+	d.ended[p][outcome]++
+}
+
+// Drain applies the policies until every session is gone or ctx expires
+// Sessions still open at that point are cut and counted as such,
+// the caller closes their connections if they don't quit in time
+func (d *drainer) Drain(ctx context.Context) {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		d.mu.Lock()
+		remaining := len(d.sessions)
+		for l := range d.sessions {
+			switch d.policy(l) {
+			case drainImmediate:
+				d.close(l)
+			case drainIdle:
+				if !l.busy.Load() {
+					d.close(l)
+				}
+			}
+		}
+		d.mu.Unlock()
+
+		if remaining == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			d.mu.Lock()
+			for l := range d.sessions {
+				l.cut.Store(true)
+				d.count(d.policy(l), endedCut)
+				l.requestStop()
+			}
+			d.mu.Unlock()
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// close ends a session on behalf of its policy; callers must hold d.mu
+func (d *drainer) close(l *liveSession) {
+	if l.closed.CompareAndSwap(false, true) {
+		l.requestStop()
+	}
+}
+
+// LogSummary logs how sessions ended for each policy
+func (d *drainer) LogSummary() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for p, outcomes := range d.ended {
+		log.Info("Drained sessions", "policy", p,
+			endedLeft, outcomes[endedLeft],
+			endedClosed, outcomes[endedClosed],
+			endedCut, outcomes[endedCut])
+	}
+}
+
+// countdown tells every session how long it has left until deadline,
+// updating the banner each second until ctx ends
+func countdown(ctx context.Context, deadline time.Time) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		left := time.Until(deadline).Round(time.Second)
+		broadcaster.Send(broadcast.Banner{
+			Text: fmt.Sprintf("The server is restarting, this session closes in %s. Please finish up.", left),
+		})
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package emoji
+
+// Emoji is one pickable character
+type Emoji struct {
+	Char string
+	Name string
+	// Fallback is inserted instead of Char on terminals that can't draw emoji
+	Fallback string
+}
+
+// all is kept to single code point emoji that terminals draw two cells wide,
+// skipping ZWJ sequences and variation selectors whose width terminals disagree on
+var all = []Emoji{
+	{"😀", "grinning", ":D"},
+	{"😂", "joy", ":'D"},
+	{"😊", "blush", ":)"},
+	{"😉", "wink", ";)"},
+	{"😍", "heart eyes", "<3_<3"},
+	{"😎", "sunglasses", "B)"},
+	{"🤔", "thinking", ":-/"},
+	{"😐", "neutral", ":|"},
+	{"😢", "cry", ":'("},
+	{"😡", "angry", ">:("},
+	{"😴", "sleeping", "-_-zz"},
+	{"🤯", "mind blown", "*_*"},
+	{"👍", "thumbs up", "(+1)"},
+	{"👎", "thumbs down", "(-1)"},
+	{"👋", "wave", "o/"},
+	{"👏", "clap", "*clap*"},
+	{"🙏", "pray thanks", "_/\\_"},
+	{"💪", "strong", "(flex)"},
+	{"👀", "eyes", "o_o"},
+	{"💯", "hundred", "100"},
+	{"🔥", "fire", "(fire)"},
+	{"🎉", "party tada", "\\o/"},
+	{"🚀", "rocket", "(rocket)"},
+	{"💡", "idea bulb", "(idea)"},
+	{"💀", "skull", "x_x"},
+	{"🌟", "star", "*"},
+	{"🌈", "rainbow", "(rainbow)"},
+	{"🍕", "pizza", "(pizza)"},
+	{"🍩", "donut", "(donut)"},
+	{"🍺", "beer", "(beer)"},
+	{"🐛", "bug", "(bug)"},
+	{"🐱", "cat", "=^.^="},
+	{"🐶", "dog", "(dog)"},
+	{"💻", "computer laptop", "[pc]"},
+	{"📦", "package box", "[box]"},
+	{"🔒", "lock", "[lock]"},
+	{"🔑", "key", "[key]"},
+	{"🔔", "bell", "(bell)"},
+	{"📌", "pin", "(pin)"},
+	{"🛒", "cart shopping", "(cart)"},
+}
@@ -0,0 +1,172 @@
+// Package emoji is a small emoji picker: a search box over a grid, with the
+// user's recently picked emoji shown first.
+//
+// The parent opens it, forwards messages to it, and gets a PickedMsg (or
+// ClosedMsg) back when the user is done.
+package emoji
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	columns   = 8
+	maxRecent = columns
+	// cellWidth fits a two cell emoji, or a fallback like "(rocket)", plus padding
+	cellWidth = 10
+)
+
+// PickedMsg carries the text to insert, already swapped for the fallback if needed
+type PickedMsg struct {
+	Text string
+}
+
+// ClosedMsg is sent when the picker is dismissed without picking
+type ClosedMsg struct{}
+
+// Supported guesses whether the client can draw emoji
+// Font support can't be detected over SSH, so this looks for a UTF-8 locale
+// and a terminal other than the Linux console, which has no emoji glyphs
+func Supported(locale, term string) bool {
+	locale = strings.ToLower(locale)
+	utf8 := strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+	return utf8 && term != "linux" && term != "dumb"
+}
+
+// Model is the picker
+type Model struct {
+	search   textinput.Model
+	results  []Emoji
+	cursor   int
+	recent   []Emoji
+	fallback bool
+
+	selected lipgloss.Style
+}
+
+// New creates a picker; with fallback set, emoji are shown and inserted as text
+func New(r *lipgloss.Renderer, fallback bool) Model {
+	search := textinput.New()
+	search.Placeholder = "search emoji"
+	search.Width = 30
+	m := Model{
+		search:   search,
+		fallback: fallback,
+		selected: r.NewStyle().Reverse(true),
+	}
+	m.filter()
+	return m
+}
+
+// Open focuses the search box and clears the last search
+// Recently used emoji are kept for the life of the model
+func (m Model) Open() (Model, tea.Cmd) {
+	m.search.SetValue("")
+	m.filter()
+	return m, m.search.Focus()
+}
+
+// filter recomputes the results for the current search
+// With no search the recent emoji come first, then everything else
+func (m *Model) filter() {
+	query := strings.ToLower(strings.TrimSpace(m.search.Value()))
+	m.results = m.results[:0]
+	if query == "" {
+		m.results = append(m.results, m.recent...)
+	}
+	for _, e := range all {
+		if query == "" && slices.Contains(m.recent, e) {
+			continue
+		}
+		if strings.Contains(e.Name, query) {
+			m.results = append(m.results, e)
+		}
+	}
+	m.cursor = min(m.cursor, max(len(m.results)-1, 0))
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			return m, func() tea.Msg { return ClosedMsg{} }
+		case "enter":
+			if len(m.results) == 0 {
+				return m, nil
+			}
+			e := m.results[m.cursor]
+			m.remember(e)
+			text := e.Char
+			if m.fallback {
+				text = e.Fallback
+			}
+			return m, func() tea.Msg { return PickedMsg{Text: text} }
+		case "left":
+			m.cursor = max(m.cursor-1, 0)
+			return m, nil
+		case "right":
+			m.cursor = min(m.cursor+1, max(len(m.results)-1, 0))
+			return m, nil
+		case "up":
+			m.cursor = max(m.cursor-columns, 0)
+			return m, nil
+		case "down":
+			m.cursor = min(m.cursor+columns, max(len(m.results)-1, 0))
+			return m, nil
+		}
+	}
+
+	// Everything else is typing in the search box
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	m.filter()
+	return m, cmd
+}
+
+// remember moves e to the front of the recent list
+func (m *Model) remember(e Emoji) {
+	m.recent = slices.DeleteFunc(m.recent, func(r Emoji) bool { return r == e })
+	m.recent = append([]Emoji{e}, m.recent...)
+	if len(m.recent) > maxRecent {
+		m.recent = m.recent[:maxRecent]
+	}
+}
+
+func (m Model) View() string {
+	var sb strings.Builder
+	sb.WriteString(m.search.View() + "\n\n")
+
+	if len(m.results) == 0 {
+		sb.WriteString("no matches\n")
+	}
+	for i, e := range m.results {
+		text := e.Char
+		if m.fallback {
+			text = e.Fallback
+		}
+		// Pad by display width, not bytes, so emoji and fallbacks line up in columns
+		cell := text + strings.Repeat(" ", max(cellWidth-lipgloss.Width(text), 0))
+		if i == m.cursor {
+			cell = m.selected.Render(cell)
+		}
+		sb.WriteString(cell)
+		if (i+1)%columns == 0 {
+			sb.WriteString("\n")
+		}
+	}
+
+	name := ""
+	if len(m.results) > 0 {
+		name = m.results[m.cursor].Name
+		if len(m.recent) > 0 && m.search.Value() == "" && m.cursor < len(m.recent) {
+			name += " (recent)"
+		}
+	}
+	sb.WriteString("\n\n" + name + "\n\narrows to move • enter to insert • esc to close")
+	return sb.String()
+}
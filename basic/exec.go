@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// keyRetention is how long idempotency keys are remembered, a retry after
+// that is saved again
+const keyRetention = 24 * time.Hour
+
+// execMiddleware runs a command given on the ssh command line instead of the
+// app, for scripts:
+//
+//	ssh -p 3000 host submit --name Jae --email jae@example.com --coffee latte --idempotency-key 5f0c…
+//	ssh -p 3000 host order 12 paid --idempotency-key 9a1e…   (admins only)
+//
+// Results are printed as JSON. A request sent again with the same
+// --idempotency-key gets the first one's result back instead of doing it twice
+// Sessions without a command go on to the app
+func execMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if len(s.Command()) == 0 {
+				next(s)
+				return
+			}
+			_ = s.Exit(runExec(s))
+		}
+	}
+}
+
+// runExec runs the session's command and returns its exit status
+func runExec(s ssh.Session) int {
+	_, _, impersonating := parseImpersonation(s.User())
+	switch {
+	case isGuest(s.Context()):
+		fmt.Fprintln(s.Stderr(), "guests can't save anything, register an SSH key first")
+		return exitError
+	case impersonating || handoffs.Valid(s.User()):
+		fmt.Fprintln(s.Stderr(), "commands run as the key's own user, connect without as: or a handoff token")
+		return exitError
+	case hasTOTP(s):
+		// There's nowhere to ask for the code, so the key alone can't do anything here
+		fmt.Fprintln(s.Stderr(), "your account has a second factor, use the app instead")
+		return exitError
+	}
+	select {
+	case <-warm.done:
+	case <-s.Context().Done():
+		return exitError
+	}
+	if warm.err != nil {
+		fmt.Fprintln(s.Stderr(), "the server isn't ready, try again later")
+		return exitError
+	}
+
+	args := s.Command()
+	var err error
+	switch args[0] {
+	case "submit":
+		err = execSubmit(s, args[1:])
+	case "order":
+		err = execOrder(s, args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q (want submit or order)", args[0])
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(s.Stderr(), "✗", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// execSubmit saves a submission, like the form does
+func execSubmit(s ssh.Session, args []string) error {
+	fs := execFlags("submit", s.Stderr())
+	name := fs.String("name", "", "your name")
+	email := fs.String("email", "", "address for the receipt")
+	coffee := fs.String("coffee", "", "your favorite coffee")
+	key := fs.String("idempotency-key", "", "unique name for this submission, sending it again returns the first result")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	checks := []struct {
+		flag string
+		err  error
+	}{{"--name", validateName(*name)}, {"--email", validateEmail(*email)}, {"--coffee", validateCoffee(*coffee)}}
+	for _, c := range checks {
+		if c.err != nil {
+			return fmt.Errorf("%s: %w", c.flag, c.err)
+		}
+	}
+
+	// The app doesn't let anyone submit before they've accepted the Terms, nor does this
+	accepted, err := tosStore.Current(userName(s))
+	if err != nil {
+		return err
+	}
+	if !accepted {
+		return errors.New("accept the Terms of Service in the app first, connect without a command")
+	}
+
+	sub := storage.Submission{User: userName(s), Owner: fingerprint(s), Value: *name, Email: *email, Coffee: *coffee}
+	respond := func(id int64) string {
+		return toJSON(map[string]any{"id": id, "order": id, "state": orders.Created})
+	}
+	if *key == "" {
+		id, err := submissionStore.Save(sub, notifications)
+		if err != nil {
+			return err
+		}
+		return written(s, "submit", respond(id), false)
+	}
+	once := storage.Once{Owner: fingerprint(s), Key: *key, Fingerprint: requestFingerprint("submit", *name, *email, *coffee)}
+	response, replayed, err := submissionStore.SaveOnce(once, sub, notifications, respond)
+	if err != nil {
+		return err
+	}
+	return written(s, "submit", response, replayed)
+}
+
+// execOrder adds an event to an order, like the admin view does
+func execOrder(s ssh.Session, args []string) error {
+	if !isAdmin(s) {
+		return errors.New("only admins can move orders along")
+	}
+	fs := execFlags("order ID EVENT", s.Stderr())
+	key := fs.String("idempotency-key", "", "unique name for this change, sending it again returns the first result")
+	// The order and event come first, flags after them
+	if len(args) < 2 {
+		fs.Usage()
+		return errors.New("want an order ID and an event, e.g. order 12 paid")
+	}
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q isn't an order ID", args[0])
+	}
+	t := orders.Type(args[1])
+	// Audited by key, names are whatever the client asked for
+	actor := fingerprint(s)
+	next := func(o orders.Order) (orders.Event, error) {
+		return o.NewEvent(t, actor, time.Now())
+	}
+	respond := func(e orders.Event) string {
+		return toJSON(map[string]any{"order": e.OrderID, "seq": e.Seq, "state": e.Type})
+	}
+
+	var response string
+	replayed := false
+	if *key == "" {
+		var e orders.Event
+		if e, err = orderEvent(id, next); err == nil {
+			err = submissionStore.Append(e)
+			response = respond(e)
+		}
+	} else {
+		once := storage.Once{Owner: fingerprint(s), Key: *key, Fingerprint: requestFingerprint("order", args[0], args[1])}
+		response, replayed, err = submissionStore.AppendOnce(once, id, next, respond)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("no order %d", id)
+	}
+	if err != nil {
+		return err
+	}
+	if !replayed {
+		recordAudit(actor, "order."+string(t), "", args[0])
+	}
+	return written(s, "order", response, replayed)
+}
+
+// orderEvent builds the next event for order id as it's stored now
+func orderEvent(id int64, next func(orders.Order) (orders.Event, error)) (orders.Event, error) {
+	events, err := submissionStore.Events(id)
+	if err != nil {
+		return orders.Event{}, err
+	}
+	all, _ := orders.Project(events)
+	if len(all) == 0 {
+		return orders.Event{}, fmt.Errorf("no order %d", id)
+	}
+	return next(all[0])
+}
+
+// written prints a command's result, saying on stderr when it's a replay
+func written(s ssh.Session, command, response string, replayed bool) error {
+	// Anything it put in the outbox goes now
+	notifier.Wake()
+	if replayed {
+		fmt.Fprintln(s.Stderr(), "already done, this is the first result")
+		log.Info("Replayed idempotent command", "command", command, "user", s.User())
+	}
+	_, err := fmt.Fprintln(s, response)
+	return err
+}
+
+// execFlags parses a command's flags, writing problems and help to w
+func execFlags(usage string, w io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(usage, flag.ContinueOnError)
+	fs.SetOutput(w)
+	return fs
+}
+
+// requestFingerprint sums up a request, so a reused key is told apart from a retry
+func requestFingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func toJSON(v any) string {
+	// Only maps of numbers and strings are passed in, which always marshal
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/jwc20/wish-bubbletea-tests/basic/form"
+	"github.com/jwc20/wish-bubbletea-tests/basic/theme"
+)
+
+// The form's fields, in the order they're asked and saved
+const (
+	fieldName = iota
+	fieldEmail
+	fieldCoffee
+)
+
+// maxEmailLength is the longest address SMTP allows
+const maxEmailLength = 254
+
+// maxCoffeeLength is plenty for "oat milk flat white, extra hot"
+const maxCoffeeLength = 40
+
+// coffees are suggested as the user types, anything else is fine too
+var coffees = []string{
+	"americano", "cappuccino", "cold brew", "cortado", "drip",
+	"espresso", "flat white", "latte", "macchiato", "mocha",
+}
+
+// newForm asks for a name under label, then an email and a favorite coffee
+func newForm(label, placeholder string) form.Model {
+	name := newInput(placeholder, maxInputLength)
+	email := newInput("jae@example.com", maxEmailLength)
+	coffee := newInput("flat white", maxCoffeeLength)
+	coffee.ShowSuggestions = true
+	coffee.SetSuggestions(coffees)
+	// Tab moves between fields, so suggestions are taken with → instead
+	coffee.KeyMap.AcceptSuggestion = key.NewBinding(key.WithKeys("right"))
+	return form.New(form.Styles{},
+		form.Field{Label: label, Input: name, Validate: validateName},
+		form.Field{Label: "Email", Input: email, Validate: validateEmail},
+		form.Field{Label: "Favorite coffee", Input: coffee, Validate: validateCoffee},
+	)
+}
+
+func newInput(placeholder string, limit int) textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = placeholder
+	// Width must be set for placeholder to display correctly
+	ti.Width = 20
+	// CharLimit stops input at the limit, the counter in View shows how close we are
+	ti.CharLimit = limit
+	return ti
+}
+
+// formStyles draws the form in the session's theme
+func formStyles(t theme.Theme) form.Styles {
+	return form.Styles{
+		Focused: t.Prompt,
+		Input:   t.Input,
+		Blurred: t.Field,
+		Error:   t.Error,
+	}
+}
+
+func validateName(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("we need something to call you")
+	}
+	if err := validatePrintable(value); err != nil {
+		return err
+	}
+	return validateInput(value)
+}
+
+func validateEmail(value string) error {
+	if value == "" {
+		return errors.New("we need an address for the receipt")
+	}
+	// ParseAddress also takes "Jae <jae@example.com>", only the bare address is wanted
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || len(value) > maxEmailLength {
+		return errors.New("that doesn't look like an email address")
+	}
+	return nil
+}
+
+func validateCoffee(value string) error {
+	switch n := utf8.RuneCountInString(strings.TrimSpace(value)); {
+	case n == 0:
+		return errors.New("pick one, even if it's tea")
+	case n > maxCoffeeLength:
+		return errors.New("that's a long order, keep it under 40 characters")
+	}
+	return validatePrintable(value)
+}
+
+// validatePrintable refuses control characters, which would be drawn in
+// everyone's terminal wherever the submission is shown
+// The text input never lets them in, but commands over ssh can send anything
+func validatePrintable(value string) error {
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return errors.New("that has control characters in it")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package forgekeys admits SSH keys that users have published on a code forge.
+//
+// GitHub and GitLab serve each user's public keys as an authorized_keys file
+// at /<user>.keys, so someone with an account there can log in with the key
+// they already use for git, as that user, without registering it here first.
+// The keys are cached for a while so logging in doesn't wait on the forge
+// every time, and the last good copy is used while the forge is unreachable.
+package forgekeys
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/lru"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Forge is where a user's keys are fetched from
+type Forge struct {
+	Name string
+	// URL has {user} where the user name goes
+	URL string
+}
+
+// Known are the forges that can be named without a URL
+var Known = map[string]string{
+	"github": "https://github.com/{user}.keys",
+	"gitlab": "https://gitlab.com/{user}.keys",
+}
+
+// cached is how many users' keys are kept
+const cached = 1024
+
+// maxKeys is the most of a user's keys file that's read, forges send a few KB at most
+const maxKeys = 256 << 10
+
+// validName is what forges allow in user names, it also keeps names from
+// reaching into other paths on the forge
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+
+// Parse reads comma separated forges, each a name from Known or
+// name=URL with {user} in the URL, e.g. "github,work=https://git.example.com/{user}.keys"
+func Parse(spec string) ([]Forge, error) {
+	var forges []Forge
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, u, custom := strings.Cut(part, "=")
+		if !custom {
+			if u = Known[name]; u == "" {
+				return nil, fmt.Errorf("%q: want one of %s, or name=URL", part, strings.Join(slices.Sorted(maps.Keys(Known)), ", "))
+			}
+		}
+		// Logins are FORGE:NAME, so a forge can't look like the as: of impersonation
+		if !validName.MatchString(name) || name == "as" || name == "as-rw" {
+			return nil, fmt.Errorf("%q: %q can't be a forge's name", part, name)
+		}
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" && parsed.Scheme != "http" || !strings.Contains(u, "{user}") {
+			return nil, fmt.Errorf("%q: want an http(s) URL with {user} in it", part)
+		}
+		if slices.ContainsFunc(forges, func(f Forge) bool { return f.Name == name }) {
+			return nil, fmt.Errorf("%q: %s is listed twice", part, name)
+		}
+		forges = append(forges, Forge{Name: name, URL: u})
+	}
+	if len(forges) == 0 {
+		return nil, errors.New("no forges listed")
+	}
+	return forges, nil
+}
+
+// Identity is who a key was admitted as
+type Identity struct {
+	Forge string
+	User  string
+}
+
+// Keys fetches and caches users' keys from the forges
+type Keys struct {
+	forges []Forge
+	ttl    time.Duration
+	client *http.Client
+	cache  *lru.Cache[Identity, entry]
+}
+
+type entry struct {
+	keys    map[string]bool // by SHA256 fingerprint
+	fetched time.Time
+}
+
+// New fetches keys from forges with client, keeping each user's for ttl
+func New(forges []Forge, ttl time.Duration, client *http.Client) *Keys {
+	return &Keys{forges: forges, ttl: ttl, client: client, cache: lru.New[Identity, entry](cached)}
+}
+
+// Match reports who key belongs to for the login name, which is a user on
+// the first forge or FORGE:USER for any of them
+func (k *Keys) Match(ctx context.Context, login string, key gossh.PublicKey) (Identity, bool) {
+	id := Identity{Forge: k.forges[0].Name, User: login}
+	if forge, name, ok := strings.Cut(login, ":"); ok {
+		id = Identity{Forge: forge, User: name}
+	}
+	i := slices.IndexFunc(k.forges, func(f Forge) bool { return f.Name == id.Forge })
+	if i < 0 || !validName.MatchString(id.User) {
+		return id, false
+	}
+	keys, err := k.keys(ctx, k.forges[i], id)
+	if err != nil {
+		log.Warn("Could not fetch keys", "forge", id.Forge, "user", id.User, "error", err)
+	}
+	return id, keys[gossh.FingerprintSHA256(key)]
+}
+
+// keys returns id's keys, fetching them again once they're older than the ttl
+// A fetch that fails returns the last good copy along with the error
+func (k *Keys) keys(ctx context.Context, forge Forge, id Identity) (map[string]bool, error) {
+	cached, ok := k.cache.Get(id)
+	if ok && time.Since(cached.fetched) < k.ttl {
+		return cached.keys, nil
+	}
+	keys, err := k.fetch(ctx, forge, id.User)
+	if err != nil {
+		return cached.keys, err
+	}
+	k.cache.Add(id, entry{keys: keys, fetched: time.Now()})
+	return keys, nil
+}
+
+// fetch reads user's keys file from forge, a user the forge doesn't know has none
+func (k *Keys) fetch(ctx context.Context, forge Forge, user string) (map[string]bool, error) {
+	u := strings.ReplaceAll(forge.URL, "{user}", url.PathEscape(user))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return map[string]bool{}, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeys))
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for line := range bytes.Lines(data) {
+		// Lines the forge added that aren't keys are skipped rather than failing the rest
+		if key, _, _, _, err := gossh.ParseAuthorizedKey(line); err == nil {
+			keys[gossh.FingerprintSHA256(key)] = true
+		}
+	}
+	return keys, nil
+}
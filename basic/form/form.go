@@ -0,0 +1,237 @@
+// Package form is a column of labelled text inputs with validation.
+//
+// Tab and enter move to the next field, shift+tab to the one before. Each
+// field is checked when it's left, and Submit checks them all and lists
+// whatever is wrong under the form.
+package form
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Field is one input of the form
+type Field struct {
+	Label string
+	Input textinput.Model
+	// Validate says what's wrong with the value, nil when it's fine or there's nothing to check
+	Validate func(string) error
+}
+
+// Styles draw the form, the zero value is plain text
+type Styles struct {
+	Label   lipgloss.Style
+	Focused lipgloss.Style // the label of the field being typed in
+	Input   lipgloss.Style // around the input being typed in, e.g. a border
+	Blurred lipgloss.Style // around the other inputs
+	Error   lipgloss.Style
+}
+
+// Model is the form
+type Model struct {
+	fields []Field
+	errs   []error // per field, from the last time it was checked
+	focus  int
+	styles Styles
+	// submitted is set by Submit, the summary only shows after a try
+	submitted bool
+}
+
+// New builds a form of fields, the first one focused
+func New(styles Styles, fields ...Field) Model {
+	m := Model{fields: fields, errs: make([]error, len(fields)), styles: styles}
+	for i := range m.fields {
+		m.fields[i].Input.Blur()
+	}
+	if len(m.fields) > 0 {
+		m.fields[0].Input.Focus()
+	}
+	return m
+}
+
+// Update moves between fields and passes everything else to the focused input
+// enter on the last field is left to the caller, who calls Submit
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	m = m.clone()
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "tab":
+			return m.move(1)
+		case "enter":
+			if !m.Last() {
+				return m.move(1)
+			}
+		case "shift+tab":
+			return m.move(-1)
+		}
+	}
+	var cmd tea.Cmd
+	m.fields[m.focus].Input, cmd = m.fields[m.focus].Input.Update(msg)
+	// A fixed mistake stops showing as soon as it's fixed
+	if m.errs[m.focus] != nil {
+		m.errs[m.focus] = m.check(m.focus)
+	}
+	return m, cmd
+}
+
+// move focuses the field by steps away, wrapping around, and checks the one left
+func (m Model) move(by int) (Model, tea.Cmd) {
+	m = m.clone()
+	m.errs[m.focus] = m.check(m.focus)
+	m.fields[m.focus].Input.Blur()
+	m.focus = (m.focus + by + len(m.fields)) % len(m.fields)
+	return m, m.fields[m.focus].Input.Focus()
+}
+
+// clone copies the fields before a change, so earlier models (e.g. time travel
+// frames) keep the form they had
+func (m Model) clone() Model {
+	m.fields = slices.Clone(m.fields)
+	m.errs = slices.Clone(m.errs)
+	return m
+}
+
+func (m Model) check(i int) error {
+	f := m.fields[i]
+	if f.Validate == nil {
+		return nil
+	}
+	return f.Validate(f.Input.Value())
+}
+
+// Submit checks every field, focusing the first one that's wrong
+// It reports whether they were all fine
+func (m Model) Submit() (Model, bool) {
+	m = m.clone()
+	m.submitted = true
+	ok := true
+	for i := range m.fields {
+		m.errs[i] = m.check(i)
+		if m.errs[i] != nil && ok {
+			ok = false
+			m.fields[m.focus].Input.Blur()
+			m.focus = i
+			m.fields[i].Input.Focus()
+		}
+	}
+	return m, ok
+}
+
+// Errors are the problems Submit found that haven't been fixed yet, one per field
+func (m Model) Errors() []string {
+	var errs []string
+	for i, err := range m.errs {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", m.Labels()[i], err))
+		}
+	}
+	return errs
+}
+
+// Last reports whether the last field is focused
+func (m Model) Last() bool {
+	return m.focus == len(m.fields)-1
+}
+
+// Values are the fields' values in order
+func (m Model) Values() []string {
+	values := make([]string, len(m.fields))
+	for i, f := range m.fields {
+		values[i] = f.Input.Value()
+	}
+	return values
+}
+
+// Labels are the fields' labels in order, without a trailing question mark
+// or colon, for lists like the error summary
+func (m Model) Labels() []string {
+	labels := make([]string, len(m.fields))
+	for i, f := range m.fields {
+		labels[i] = strings.TrimRight(f.Label, "?:")
+	}
+	return labels
+}
+
+// SetValue sets field i's value
+func (m Model) SetValue(i int, value string) Model {
+	m = m.clone()
+	m.fields[i].Input.SetValue(value)
+	return m
+}
+
+// SetLabel changes field i's label, e.g. when the content it comes from changes
+func (m Model) SetLabel(i int, label string) Model {
+	m = m.clone()
+	m.fields[i].Label = label
+	return m
+}
+
+// Focused is the input being typed in, change it with SetFocused
+func (m Model) Focused() textinput.Model {
+	return m.fields[m.focus].Input
+}
+
+// SetFocused replaces the input being typed in
+func (m Model) SetFocused(input textinput.Model) Model {
+	m = m.clone()
+	m.fields[m.focus].Input = input
+	return m
+}
+
+// SetWidth sets how wide every input is
+func (m Model) SetWidth(width int) Model {
+	m = m.clone()
+	for i := range m.fields {
+		m.fields[i].Input.Width = width
+	}
+	return m
+}
+
+// WithStyles draws the form with styles from now on
+func (m Model) WithStyles(styles Styles) Model {
+	m.styles = styles
+	return m
+}
+
+// SetPlaceholder changes field i's placeholder
+func (m Model) SetPlaceholder(i int, placeholder string) Model {
+	m = m.clone()
+	m.fields[i].Input.Placeholder = placeholder
+	return m
+}
+
+// Empty reports whether nothing has been typed in any field
+func (m Model) Empty() bool {
+	for _, f := range m.fields {
+		if f.Input.Value() != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Model) View() string {
+	var b strings.Builder
+	for i, f := range m.fields {
+		label, input := m.styles.Label.Render(f.Label), m.styles.Blurred.Render(f.Input.View())
+		if i == m.focus {
+			label, input = m.styles.Focused.Render(f.Label), m.styles.Input.Render(f.Input.View())
+		}
+		fmt.Fprintf(&b, "%s\n%s\n", label, input)
+		if m.errs[i] != nil {
+			b.WriteString(m.styles.Error.Render("✗ "+m.errs[i].Error()) + "\n")
+		}
+	}
+	if errs := m.Errors(); m.submitted && len(errs) > 0 {
+		fmt.Fprintf(&b, "\n%s\n", m.styles.Error.Render(fmt.Sprintf("%d to fix before saving:", len(errs))))
+		for _, err := range errs {
+			b.WriteString(m.styles.Error.Render("• "+err) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,285 @@
+// Package grid is a table of rows of any type: columns can be sorted and
+// resized, the table scrolls sideways when the terminal is narrower than
+// its columns, and one row is selected.
+//
+// One column has the focus, ←/→ move it and scroll it into view, s sorts by
+// it (again to reverse) and +/- widen and narrow it. ↑/↓, pgup/pgdown and
+// home/end move the selection.
+package grid
+
+import (
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Widths a column can be resized between
+const (
+	minWidth = 3
+	maxWidth = 60
+)
+
+// Column is how one column shows a row
+type Column[T any] struct {
+	Title string
+	Width int
+	Cell  func(T) string
+	// Less orders rows by the column, nil if it can't be sorted by
+	Less func(a, b T) bool
+}
+
+// Styles are for the session's renderer, the zero value draws plain text
+type Styles struct {
+	Header   lipgloss.Style
+	Focused  lipgloss.Style // the focused column's header
+	Selected lipgloss.Style
+	Faint    lipgloss.Style // the scroll and sort markers
+}
+
+// Model is the table, build it with New
+type Model[T any] struct {
+	columns []Column[T]
+	rows    []T
+	// key identifies a row across SetRows, so the selection stays on it
+	key    func(T) string
+	styles Styles
+
+	order  []int // rows in the order shown
+	sortBy int   // -1 when unsorted
+	desc   bool
+	cursor int // position in order of the selected row
+	top    int // first position shown
+	focus  int // focused column
+	left   int // first column shown
+
+	width, height int
+}
+
+// New returns an empty table showing up to height rows, key names a row so
+// it stays selected when the rows are reloaded or sorted, nil to go by its cells
+func New[T any](columns []Column[T], key func(T) string, height int, styles Styles) Model[T] {
+	return Model[T]{columns: columns, key: key, styles: styles, sortBy: -1, height: max(height, 1)}
+}
+
+// SetRows replaces the rows, keeping their sort and the selected row if it's still there
+func (m Model[T]) SetRows(rows []T) Model[T] {
+	selected, had := m.Selected()
+	m.rows = rows
+	m.sort()
+	m.cursor = min(m.cursor, max(len(m.order)-1, 0))
+	if had {
+		m = m.selectRow(selected)
+	}
+	return m.scroll()
+}
+
+// SetSize fits the table to width columns of text and height rows, a width
+// of 0 never scrolls sideways
+func (m Model[T]) SetSize(width, height int) Model[T] {
+	m.width, m.height = width, max(height, 1)
+	return m.scroll()
+}
+
+// Selected returns the selected row, false when there are none
+func (m Model[T]) Selected() (T, bool) {
+	if m.cursor >= len(m.order) {
+		var zero T
+		return zero, false
+	}
+	return m.rows[m.order[m.cursor]], true
+}
+
+// Len is how many rows there are
+func (m Model[T]) Len() int {
+	return len(m.rows)
+}
+
+// SortBy orders rows by column col, descending if desc
+func (m Model[T]) SortBy(col int, desc bool) Model[T] {
+	if col < 0 || col >= len(m.columns) || m.columns[col].Less == nil {
+		return m
+	}
+	selected, had := m.Selected()
+	m.sortBy, m.desc = col, desc
+	m.sort()
+	if had {
+		m = m.selectRow(selected)
+	}
+	return m.scroll()
+}
+
+func (m *Model[T]) sort() {
+	m.order = make([]int, len(m.rows))
+	for i := range m.order {
+		m.order[i] = i
+	}
+	if m.sortBy < 0 {
+		return
+	}
+	less := m.columns[m.sortBy].Less
+	slices.SortStableFunc(m.order, func(a, b int) int {
+		x, y := m.rows[a], m.rows[b]
+		if m.desc {
+			x, y = y, x
+		}
+		switch {
+		case less(x, y):
+			return -1
+		case less(y, x):
+			return 1
+		}
+		return 0
+	})
+}
+
+// selectRow moves the selection to row, found by key, or by the cell text without one
+func (m Model[T]) selectRow(row T) Model[T] {
+	same := func(r int) bool { return m.rowText(m.rows[r]) == m.rowText(row) }
+	if m.key != nil {
+		same = func(r int) bool { return m.key(m.rows[r]) == m.key(row) }
+	}
+	if i := slices.IndexFunc(m.order, same); i >= 0 {
+		m.cursor = i
+	}
+	return m
+}
+
+func (m Model[T]) rowText(row T) string {
+	cells := make([]string, len(m.columns))
+	for i, c := range m.columns {
+		cells[i] = c.Cell(row)
+	}
+	return strings.Join(cells, "\x00")
+}
+
+// Update handles the table's keys, reporting whether msg was one of them
+func (m Model[T]) Update(msg tea.KeyMsg) (Model[T], bool) {
+	switch msg.String() {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(m.order)-1, 0))
+	case "pgup":
+		m.cursor = max(m.cursor-m.height, 0)
+	case "pgdown":
+		m.cursor = min(m.cursor+m.height, max(len(m.order)-1, 0))
+	case "home":
+		m.cursor = 0
+	case "end":
+		m.cursor = max(len(m.order)-1, 0)
+	case "left", "h":
+		m.focus = max(m.focus-1, 0)
+	case "right", "l":
+		m.focus = min(m.focus+1, len(m.columns)-1)
+	case "s":
+		return m.SortBy(m.focus, m.sortBy == m.focus && !m.desc), true
+	case "+", "=":
+		m = m.resize(1)
+	case "-":
+		m = m.resize(-1)
+	default:
+		return m, false
+	}
+	return m.scroll(), true
+}
+
+// resize changes the focused column's width by n characters
+func (m Model[T]) resize(n int) Model[T] {
+	m.columns = slices.Clone(m.columns)
+	c := &m.columns[m.focus]
+	c.Width = min(max(c.Width+n, minWidth), maxWidth)
+	return m
+}
+
+// scroll brings the selected row and the focused column into view
+func (m Model[T]) scroll() Model[T] {
+	m.top = min(m.top, m.cursor)
+	if m.cursor >= m.top+m.height {
+		m.top = m.cursor - m.height + 1
+	}
+	m.left = min(m.left, m.focus)
+	for m.left < m.focus && !m.fits(m.left, m.focus) {
+		m.left++
+	}
+	return m
+}
+
+// fits reports whether columns from through to fit in the width
+func (m Model[T]) fits(from, to int) bool {
+	if m.width <= 0 {
+		return true
+	}
+	w := 0
+	for _, c := range m.columns[from : to+1] {
+		w += c.Width + 1
+	}
+	// Room for the scroll markers either side
+	return w+2 <= m.width
+}
+
+// shown is the columns that fit from left on
+func (m Model[T]) shown() []int {
+	cols := []int{m.left}
+	for i := m.left + 1; i < len(m.columns) && m.fits(m.left, i); i++ {
+		cols = append(cols, i)
+	}
+	return cols
+}
+
+func (m Model[T]) View() string {
+	cols := m.shown()
+	more := cols[len(cols)-1] < len(m.columns)-1
+	var b strings.Builder
+	b.WriteString(m.marker(m.left > 0, "‹"))
+	for _, i := range cols {
+		c := m.columns[i]
+		title := c.Title
+		// The arrow is kept when the title is cut short, it's what says the column is sorted
+		switch {
+		case i == m.sortBy && m.desc:
+			title = ansi.Truncate(title, c.Width-2, "…") + " ↓"
+		case i == m.sortBy:
+			title = ansi.Truncate(title, c.Width-2, "…") + " ↑"
+		}
+		style := m.styles.Header
+		if i == m.focus {
+			style = m.styles.Focused
+		}
+		b.WriteString(style.Render(cell(title, c.Width)) + " ")
+	}
+	b.WriteString(m.marker(more, "›"))
+
+	for p := m.top; p < min(m.top+m.height, len(m.order)); p++ {
+		row := m.rows[m.order[p]]
+		cells := make([]string, len(cols))
+		for j, i := range cols {
+			cells[j] = cell(m.columns[i].Cell(row), m.columns[i].Width)
+		}
+		line := strings.Join(cells, " ")
+		if p == m.cursor {
+			line = m.styles.Selected.Render(line)
+		}
+		b.WriteString("\n " + line)
+	}
+	if m.top+m.height < len(m.order) {
+		b.WriteString("\n " + m.styles.Faint.Render("↓ more"))
+	}
+	return b.String()
+}
+
+// marker is s in faint when there's more to scroll to that way, else a space
+func (m Model[T]) marker(on bool, s string) string {
+	if !on {
+		return " "
+	}
+	return m.styles.Faint.Render(s)
+}
+
+// cell pads or cuts text to exactly width
+func cell(text string, width int) string {
+	text = ansi.Truncate(strings.ReplaceAll(text, "\n", " "), width, "…")
+	return text + strings.Repeat(" ", max(width-ansi.StringWidth(text), 0))
+}
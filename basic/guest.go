@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/hyperlink"
+)
+
+// guests limits how often guest sessions can start, nil unless --guests is set
+// Guests are clients without a key in --authorized-keys, they can look around
+// but can't submit or save anything
+var guests *guestLimiter
+
+// guestContact tells guests where to send their key, set by --guest-contact
+var guestContact string
+
+// guestKey marks a connection as a guest in its ssh.Context
+type guestKey struct{}
+
+// isGuest reports whether the connection was let in as a guest
+func isGuest(ctx ssh.Context) bool {
+	guest, _ := ctx.Value(guestKey{}).(bool)
+	return guest
+}
+
+// guestLimiter allows each address a few guest sessions per window
+type guestLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	recent map[string][]time.Time // session starts within the window, by host
+}
+
+func newGuestLimiter(limit int, window time.Duration) *guestLimiter {
+	return &guestLimiter{limit: limit, window: window, recent: map[string][]time.Time{}}
+}
+
+// allow records a guest session from host and reports whether it's within the limit
+func (g *guestLimiter) allow(host string, at time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	kept := g.recent[host][:0]
+	for _, t := range g.recent[host] {
+		if at.Sub(t) < g.window {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= g.limit {
+		g.recent[host] = kept
+		return false
+	}
+	g.recent[host] = append(kept, at)
+	// Forget hosts that have gone quiet so the map doesn't grow forever
+	for h, starts := range g.recent {
+		if len(starts) > 0 && at.Sub(starts[len(starts)-1]) >= g.window {
+			delete(g.recent, h)
+		}
+	}
+	return true
+}
+
+// guestsMiddleware turns guests away once their address has started too many sessions
+// Key holders are never limited
+func guestsMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if guests == nil || !isGuest(s.Context()) {
+				next(s)
+				return
+			}
+			host, _, _ := net.SplitHostPort(s.RemoteAddr().String())
+			if !guests.allow(host, time.Now()) {
+				log.Info("Guest rate limited", "remote", s.RemoteAddr())
+				wish.Fatalf(s, "Too many guest sessions from your address, try again in %s\n", guests.window)
+				return
+			}
+			next(s)
+		}
+	}
+}
+
+// upgradeView explains how a guest becomes a key holder
+func (m model) upgradeView() string {
+	contact := "whoever runs this server"
+	switch {
+	// An address to write to is linked as one, so a click opens the mail client
+	case strings.Contains(guestContact, "@") && !strings.Contains(guestContact, ":"):
+		contact = hyperlink.Link("mailto:"+guestContact, guestContact, m.links)
+	case guestContact != "":
+		contact = hyperlink.Bare(guestContact, m.links)
+	}
+	host, port, err := net.SplitHostPort(m.addr)
+	if err != nil {
+		host, port = m.addr, "22"
+	}
+	return fmt.Sprintf(`You're browsing as a guest
+
+Guests can look around, but submitting and saving need a registered SSH key.
+
+  1. Make a key, if you don't have one:   ssh-keygen -t ed25519
+  2. Send your public key (~/.ssh/id_ed25519.pub) to %s
+  3. Once it's added, connect again:       ssh -p %s %s
+
+any key to close`, contact, port, host)
+}
@@ -0,0 +1,113 @@
+// Package handoff moves a session to another device, such as a phone running
+// Termius or Blink, without setting up keys there first.
+//
+// The session issues a one-time token shown as a QR code. Connecting with the
+// token as the username picks up the original user and their session state.
+// Tokens expire after a short TTL and can only be redeemed once.
+package handoff
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Prefix starts every token, so usernames that happen to look random aren't redeemed
+const Prefix = "handoff-"
+
+// State is what carries over to the new session
+type State struct {
+	User   string
+	Input  string
+	Avatar string
+	// Name, Fingerprint and Accent carry over the user's profile, if they have one
+	Name        string
+	Fingerprint string
+	Accent      string
+}
+
+type ticket struct {
+	state   State
+	expires time.Time
+}
+
+// Registry holds the tokens that haven't been redeemed or expired yet
+// Tokens only live in memory, a restart invalidates them all
+type Registry struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+// NewRegistry returns a registry whose tokens are valid for ttl
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{ttl: ttl, tickets: map[string]ticket{}}
+}
+
+// Issue stores state under a new token
+func (r *Registry) Issue(state State) (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// Lower case base32 survives being typed on a phone keyboard
+	token := Prefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	// Drop expired tokens here rather than running a separate sweeper
+	for t, tk := range r.tickets {
+		if now.After(tk.expires) {
+			delete(r.tickets, t)
+		}
+	}
+	r.tickets[token] = ticket{state: state, expires: now.Add(r.ttl)}
+	return token, nil
+}
+
+// Redeem returns the state for token and forgets it
+func (r *Registry) Redeem(token string) (State, bool) {
+	if !strings.HasPrefix(token, Prefix) {
+		return State{}, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tk, ok := r.tickets[token]
+	delete(r.tickets, token)
+	if !ok || time.Now().After(tk.expires) {
+		return State{}, false
+	}
+	return tk.state, true
+}
+
+// Valid reports whether token could be redeemed, without using it up
+func (r *Registry) Valid(token string) bool {
+	if !strings.HasPrefix(token, Prefix) {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tk, ok := r.tickets[token]
+	return ok && time.Now().Before(tk.expires)
+}
+
+// TTL is how long issued tokens stay valid
+func (r *Registry) TTL() time.Duration {
+	return r.ttl
+}
+
+// QR draws an ssh:// link for token at addr as a QR code made of half blocks
+// Mobile SSH clients open ssh:// links straight from the camera
+func QR(token, addr string) (string, error) {
+	q, err := qrcode.New("ssh://"+token+"@"+addr, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+	return q.ToSmallString(false), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/kms"
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// hostKeySource says where the server's host key comes from
+// Only one of secret, agent and kms should be set, with none the key file is used
+type hostKeySource struct {
+	// path is the key file, generated on first start if it doesn't exist
+	path string
+	// secret names a PEM held by the --secrets provider
+	secret string
+	// agent signs with a key held by the ssh-agent at $SSH_AUTH_SOCK
+	// The agent can front an HSM or KMS (PKCS#11, YubiKey, cloud KMS agents),
+	// so the private key never touches this machine's disk
+	agent bool
+	// fingerprint picks one of the agent's keys, e.g. "SHA256:abc..."
+	fingerprint string
+	// kms is the URI of a key held in a KMS or HSM, see the kms package
+	kms string
+}
+
+// onDisk reports whether the key is read from (or generated at) path
+func (src hostKeySource) onDisk() bool {
+	return src.secret == "" && !src.agent && src.kms == ""
+}
+
+// hostKeyOption builds the server option that installs the host key from src
+func hostKeyOption(ctx context.Context, src hostKeySource) (ssh.Option, error) {
+	set := 0
+	for _, on := range []bool{src.secret != "", src.agent, src.kms != ""} {
+		if on {
+			set++
+		}
+	}
+	switch {
+	case set > 1:
+		return nil, errors.New("use only one of --host-key-secret, --host-key-agent and --host-key-kms")
+	case src.kms != "":
+		return kmsHostKey(ctx, src.kms)
+	case src.agent:
+		return agentHostKey(src.fingerprint)
+	case src.secret != "":
+		return secretHostKey(ctx, src.secret)
+	default:
+		// Wrapped so the key is only generated when the server is actually built
+		return func(s *ssh.Server) error {
+			return wish.WithHostKeyPath(src.path)(s)
+		}, nil
+	}
+}
+
+// secretHostKey reads the host key PEM from the --secrets provider
+func secretHostKey(ctx context.Context, name string) (ssh.Option, error) {
+	pem, err := secret(ctx, "--host-key-secret", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gossh.ParsePrivateKey([]byte(pem)); err != nil {
+		return nil, fmt.Errorf("host key secret %q: %w", name, err)
+	}
+	return wish.WithHostKeyPEM([]byte(pem)), nil
+}
+
+// kmsHostKey signs handshakes with a key held in a KMS or HSM
+func kmsHostKey(ctx context.Context, uri string) (ssh.Option, error) {
+	key, err := kms.Open(ctx, uri, outboundPolicies.Get(outbound.KMS).Client())
+	if err != nil {
+		return nil, err
+	}
+	signer, err := kms.SSHSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	return hostSigner(signer), nil
+}
+
+// agentHostKey signs handshakes through the ssh-agent instead of a local key
+// The agent connection stays open for the life of the server
+func agentHostKey(fingerprint string) (ssh.Option, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("--host-key-agent needs SSH_AUTH_SOCK pointing at an ssh-agent")
+	}
+	conn, signers, err := dialAgent(sock)
+	if err != nil {
+		return nil, err
+	}
+	for _, signer := range signers {
+		if fingerprint == "" || gossh.FingerprintSHA256(signer.PublicKey()) == fingerprint {
+			return hostSigner(&agentSigner{sock: sock, conn: conn, signer: signer}), nil
+		}
+	}
+	conn.Close()
+	if fingerprint != "" {
+		return nil, fmt.Errorf("ssh-agent has no key with fingerprint %s", fingerprint)
+	}
+	return nil, errors.New("ssh-agent has no keys, add one with ssh-add")
+}
+
+// dialAgent connects to the ssh-agent at sock and lists its keys
+func dialAgent(sock string) (net.Conn, []gossh.Signer, error) {
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("ssh-agent: %w", err)
+	}
+	return conn, signers, nil
+}
+
+// agentSigner signs with one of the ssh-agent's keys, dialling the agent
+// again when signing fails, so a restarted agent doesn't stop handshakes
+type agentSigner struct {
+	sock string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	signer gossh.Signer
+}
+
+func (a *agentSigner) PublicKey() gossh.PublicKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.signer.PublicKey()
+}
+
+func (a *agentSigner) Sign(rand io.Reader, data []byte) (*gossh.Signature, error) {
+	return a.SignWithAlgorithm(rand, data, "")
+}
+
+// SignWithAlgorithm lets RSA keys sign with SHA-2, as the agent's own signers do
+func (a *agentSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*gossh.Signature, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sig, err := signWith(a.signer, rand, data, algorithm)
+	if err == nil {
+		return sig, nil
+	}
+	log.Warn("ssh-agent could not sign with the host key, dialling it again", "error", err)
+	if err := a.redial(); err != nil {
+		return nil, err
+	}
+	return signWith(a.signer, rand, data, algorithm)
+}
+
+// redial replaces the agent connection, the key has to still be there
+func (a *agentSigner) redial() error {
+	conn, signers, err := dialAgent(a.sock)
+	if err != nil {
+		return err
+	}
+	want := a.signer.PublicKey().Marshal()
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), want) {
+			a.conn.Close()
+			a.conn, a.signer = conn, signer
+			return nil
+		}
+	}
+	conn.Close()
+	return fmt.Errorf("ssh-agent no longer has the host key %s", gossh.FingerprintSHA256(a.signer.PublicKey()))
+}
+
+// signWith signs with algorithm, or the key's default when it's empty
+func signWith(signer gossh.Signer, rand io.Reader, data []byte, algorithm string) (*gossh.Signature, error) {
+	if as, ok := signer.(gossh.AlgorithmSigner); ok && algorithm != "" {
+		return as.SignWithAlgorithm(rand, data, algorithm)
+	}
+	return signer.Sign(rand, data)
+}
+
+// hostSigner installs any ssh.Signer as the host key
+func hostSigner(signer gossh.Signer) ssh.Option {
+	return func(s *ssh.Server) error {
+		s.AddHostKey(signer)
+		return nil
+	}
+}
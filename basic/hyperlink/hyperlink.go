@@ -0,0 +1,87 @@
+// Package hyperlink makes links in the app's text clickable in terminals
+// that support OSC 8 hyperlinks, and leaves the address showing elsewhere.
+//
+// A terminal that doesn't know OSC 8 may print the escape sequence as
+// garbage, so links are only drawn when the client's terminal is one that's
+// known to support them, see Supported.
+package hyperlink
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// bare matches addresses written out in text, stopping before punctuation
+// that usually ends a sentence rather than the address
+var bare = regexp.MustCompile(`(?:https?://|mailto:)[^\s<>()\[\]"'\x00-\x1f\x7f]*[^\s<>()\[\]"'.,;:!?\x00-\x1f\x7f]`)
+
+// labeled matches markdown links, [label](address), allowing one level of
+// parentheses in the address, as Wikipedia's have
+var labeled = regexp.MustCompile(`\[([^\]\n]+)\]\(((?:https?://|mailto:)(?:[^\s()\x00-\x1f\x7f]|\([^\s()\x00-\x1f\x7f]*\))+)\)`)
+
+// terms are TERM values of terminals that support OSC 8
+var terms = []string{"xterm-kitty", "xterm-ghostty", "wezterm", "foot", "foot-extra", "alacritty", "contour"}
+
+// programs are TERM_PROGRAM values of terminals that support OSC 8
+var programs = []string{"iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper", "Tabby"}
+
+// Supported guesses whether the client's terminal draws OSC 8 links
+// TERM always comes over SSH, the rest of environ only when the client sends
+// it (SendEnv), and FORCE_HYPERLINK=1 or 0 settles it either way
+func Supported(term string, environ []string) bool {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	if force, ok := env["FORCE_HYPERLINK"]; ok {
+		return force != "" && force != "0"
+	}
+	if vte, err := strconv.Atoi(env["VTE_VERSION"]); err == nil && vte >= 5000 {
+		return true
+	}
+	return slices.Contains(terms, term) || slices.Contains(programs, env["TERM_PROGRAM"]) || env["WT_SESSION"] != ""
+}
+
+// Link is text linking to address, or just text when on is false
+func Link(address, text string, on bool) string {
+	if !on || strings.ContainsAny(address, "\x1b\x07") {
+		return text
+	}
+	return "\x1b]8;;" + address + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// Bare makes the addresses written out in text into links, which is safe for
+// text users wrote, since the link always says where it goes
+func Bare(text string, on bool) string {
+	if !on {
+		return text
+	}
+	return bare.ReplaceAllStringFunc(text, func(address string) string {
+		return Link(address, address, true)
+	})
+}
+
+// Markdown makes markdown links and written out addresses in text into links
+// Where links can't be drawn, a markdown link shows its address after the
+// label, so it can still be copied. Only for the app's own text: a label
+// could say one address and link to another
+func Markdown(text string, on bool) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range labeled.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(Bare(text[last:m[0]], on))
+		label, address := text[m[2]:m[3]], text[m[4]:m[5]]
+		if on {
+			b.WriteString(Link(address, label, true))
+		} else {
+			b.WriteString(label + " (" + strings.TrimPrefix(address, "mailto:") + ")")
+		}
+		last = m[1]
+	}
+	b.WriteString(Bare(text[last:], on))
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+)
+
+// idleTimeout is how long a session can sit without a keypress before it's
+// closed, set by --idle-timeout, zero keeps sessions open forever
+// Sessions left open hold a goroutine, a PTY and a connection each
+var idleTimeout = 30 * time.Minute
+
+// idleWarning is how long before the timeout the user is warned
+const idleWarning = time.Minute
+
+// idleMsg is sent by idleTick to check how long the session has been idle
+// The field is exported so message logs can record it
+type idleMsg struct {
+	At time.Time
+}
+
+// idleTick checks for inactivity again after d
+func idleTick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg { return idleMsg{At: t} })
+}
+
+// checkIdle warns the user a minute before idleTimeout and ends the session at it,
+// scheduling the next check for when either could next happen
+func (m model) checkIdle(msg idleMsg) (model, tea.Cmd) {
+	warnAt := max(idleTimeout-idleWarning, 0)
+	idle := msg.At.Sub(m.lastActive)
+	switch {
+	case idle >= idleTimeout:
+		log.Info("Closing idle session", "user", m.user, "idle", idle.Round(time.Second))
+		return m, tea.Quit
+	case idle >= warnAt:
+		m.idleWarned = true
+		return m, idleTick(idleTimeout - idle)
+	}
+	return m, idleTick(warnAt - idle)
+}
+
+// idleView replaces the screen while the user is being warned
+func idleView() string {
+	return "still there?\n\nthis session closes in a minute if nothing is pressed\n\npress any key to stay • ctrl+c to leave"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/jwc20/wish-bubbletea-tests/basic/audit"
+	"github.com/jwc20/wish-bubbletea-tests/basic/avatar"
+	"github.com/jwc20/wish-bubbletea-tests/basic/emoji"
+	"github.com/jwc20/wish-bubbletea-tests/basic/hyperlink"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// auditLog records privileged actions like impersonation, opened from --audit-log
+var auditLog *audit.Log
+
+// impersonateFor is how long an admin can view the app as someone else, set by --impersonate-for
+var impersonateFor = 15 * time.Minute
+
+// Admins view the app as another user, for support, by connecting with their
+// admin key and the username as:NAME, or as-rw:NAME to also save as them
+const (
+	impersonatePrefix         = "as:"
+	impersonateWritablePrefix = "as-rw:"
+)
+
+// parseImpersonation returns who a username asks to view the app as
+func parseImpersonation(username string) (target string, writable, ok bool) {
+	if target, ok := strings.CutPrefix(username, impersonateWritablePrefix); ok && target != "" {
+		return target, true, true
+	}
+	if target, ok := strings.CutPrefix(username, impersonatePrefix); ok && target != "" {
+		return target, false, true
+	}
+	return "", false, false
+}
+
+// impersonateHandler runs the app as target for an admin: with their name,
+// preferences and data, under a banner, until impersonateFor runs out
+// Everything is recorded in the audit log, start and end included
+func impersonateHandler(s ssh.Session, target string, writable bool) (tea.Model, []tea.ProgramOption) {
+	admin := fingerprint(s)
+	profile, found, err := userStore.FindByName(target)
+	if errors.Is(err, user.ErrAmbiguous) {
+		// Anyone can take a name with a new key, so which one is meant can't be guessed
+		log.Warn("Refused to impersonate a name several keys have", "admin", admin, "user", target, "error", err)
+		fmt.Fprintf(s.Stderr(), "more than one key connects as %q, so it isn't clear whose app to show: %v\n", target, err)
+		return nil, nil
+	}
+	if err != nil {
+		log.Error("Could not load user profiles", "error", err)
+		fmt.Fprintln(s.Stderr(), "could not load user profiles, see the server log")
+		return nil, nil
+	}
+	if !found {
+		fmt.Fprintf(s.Stderr(), "no user named %q\n", target)
+		return nil, nil
+	}
+
+	mode := "read-only"
+	if writable {
+		mode = "read-write"
+	}
+	until := time.Now().Add(impersonateFor)
+	log.Warn("Admin impersonating user", "admin", admin, "user", target, "mode", mode, "until", until.Format(time.RFC3339))
+	recordAudit(admin, "impersonate.start", target, mode+" until "+until.UTC().Format(time.RFC3339))
+	go func() {
+		<-s.Context().Done()
+		recordAudit(admin, "impersonate.end", target, "")
+	}()
+
+	text, placeholder := loadPrompt(sessionLocale(s), profile.Name)
+	accepted, err := tosStore.Current(target)
+	if err != nil {
+		log.Error("Could not read ToS acceptances", "error", err)
+	}
+	pty, _, _ := s.Pty()
+	setup := sessionSetup{
+		User:        target,
+		Name:        user.CleanName(profile.Name),
+		Fingerprint: profile.Fingerprint,
+		Accent:      profile.Prefs.Accent,
+		// The user's locale isn't saved, so it's the admin's
+		Locale:        sessionLocale(s),
+		TimeZone:      sessionZone(s, profile.Prefs.TimeZone),
+		Prompt:        text,
+		Placeholder:   placeholder,
+		Avatar:        avatar.Generate(profile.Fingerprint),
+		Addr:          s.LocalAddr().String(),
+		NeedsTOS:      !accepted,
+		EmojiFallback: !emoji.Supported(sessionLocale(s), pty.Term),
+		Hyperlinks:    hyperlink.Supported(pty.Term, s.Environ()),
+		Inline:        inline,
+		Width:         pty.Window.Width,
+		Height:        pty.Window.Height,
+		Warming:       !warm.ready(),
+		Started:       time.Now(),
+
+		Prefs:          profile.Prefs,
+		ProfileVersion: profile.Version,
+
+		Impersonator:     admin,
+		ReadOnly:         !writable,
+		ImpersonateUntil: until,
+	}
+	m, opts := startApp(s, setup)
+	m.conn.SetUser(target + " (admin)")
+	return m, opts
+}
+
+// recordAudit writes an audit entry, logging rather than failing if it can't
+func recordAudit(actor, action, target, detail string) {
+	err := auditLog.Record(audit.Entry{Actor: actor, Action: action, Target: target, Detail: detail})
+	if err != nil {
+		log.Error("Could not write audit log", "action", action, "error", err)
+	}
+}
+
+// audit records what an impersonating admin did, it does nothing in normal sessions
+func (m model) audit(action, detail string) {
+	if m.impersonator != "" {
+		recordAudit(m.impersonator, action, m.user, detail)
+	}
+}
+
+// blockedWhileImpersonating says why key isn't allowed, empty when it is
+// Handoffs would give the admin a session as the user without the banner or
+// time limit, so they're never allowed
+// ctrl+o and ctrl+r are blocked on every screen, the rest only save from the prompt
+func (m model) blockedWhileImpersonating(key string) string {
+	readOnly := "read-only while viewing as " + m.user + ", connect as " + impersonateWritablePrefix + m.user + " to save"
+	switch {
+	case m.impersonator == "":
+		return ""
+	case key == "ctrl+o":
+		return "handoff is off while viewing as " + m.user
+	case m.readOnly && key == "ctrl+r":
+		return readOnly
+	case m.readOnly && m.onPrompt() && slices.Contains([]string{"enter", "ctrl+t", "ctrl+z", "ctrl+y"}, key):
+		return readOnly
+	}
+	return ""
+}
+
+// impersonationOverMsg ends the session when impersonateFor runs out
+type impersonationOverMsg struct{}
+
+func impersonationTimer(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(time.Time) tea.Msg { return impersonationOverMsg{} })
+}
+
+// impersonationView is the banner above everything while an admin views as someone else
+func (m model) impersonationView() string {
+	mode := "read-only"
+	if !m.readOnly {
+		mode = "CAN SAVE"
+	}
+	left := max(m.impersonateUntil.Sub(now()), 0).Round(time.Second)
+	return m.theme.Notice.Render(
+		fmt.Sprintf(" ADMIN VIEWING AS %s • %s • ends in %s ", m.user, mode, left))
+}
@@ -0,0 +1,180 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcpEndpoint is the Cloud KMS API
+var gcpEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+// gcpMetadata hands out the access token of the instance's service account
+// on Compute Engine, GKE and Cloud Run
+var gcpMetadata = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpKey is a Cloud KMS asymmetric signing key version
+// The access token is GOOGLE_OAUTH_ACCESS_TOKEN when set, otherwise the
+// service account's from the metadata server
+type gcpKey struct {
+	name   string
+	client *http.Client
+	public crypto.PublicKey
+	hash   crypto.Hash
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// gcpHashes are the digests of the Cloud KMS algorithms SSH can use
+var gcpHashes = map[string]crypto.Hash{
+	"EC_SIGN_P256_SHA256":        crypto.SHA256,
+	"EC_SIGN_P384_SHA384":        crypto.SHA384,
+	"EC_SIGN_ED25519":            0,
+	"RSA_SIGN_PKCS1_2048_SHA256": crypto.SHA256,
+	"RSA_SIGN_PKCS1_3072_SHA256": crypto.SHA256,
+	"RSA_SIGN_PKCS1_4096_SHA256": crypto.SHA256,
+	"RSA_SIGN_PKCS1_4096_SHA512": crypto.SHA512,
+}
+
+func openGCP(ctx context.Context, uri *url.URL, client *http.Client) (Signer, error) {
+	k := &gcpKey{name: strings.Trim(uri.Host+uri.Path, "/"), client: client}
+	var body struct {
+		PEM       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := k.call(ctx, http.MethodGet, k.name+"/publicKey", nil, &body); err != nil {
+		return nil, err
+	}
+	hash, ok := gcpHashes[body.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("gcpkms: %s is %s, SSH can't use it", k.name, body.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(body.PEM))
+	if block == nil {
+		return nil, fmt.Errorf("gcpkms: %s has no PEM public key", k.name)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: %s: %w", k.name, err)
+	}
+	k.public, k.hash = public, hash
+	return k, nil
+}
+
+func (k *gcpKey) Public() crypto.PublicKey { return k.public }
+
+func (k *gcpKey) Hash() crypto.Hash { return k.hash }
+
+// Sign has Cloud KMS sign digest, or the message itself for Ed25519
+func (k *gcpKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != k.hash {
+		return nil, fmt.Errorf("gcpkms: %s signs %v digests, not %v", k.name, k.hash, opts.HashFunc())
+	}
+	// The API takes bytes as base64, which is how encoding/json sends []byte
+	req := map[string]any{}
+	switch k.hash {
+	case 0:
+		req["data"] = digest
+	case crypto.SHA256:
+		req["digest"] = map[string][]byte{"sha256": digest}
+	case crypto.SHA384:
+		req["digest"] = map[string][]byte{"sha384": digest}
+	case crypto.SHA512:
+		req["digest"] = map[string][]byte{"sha512": digest}
+	}
+	var body struct {
+		Signature []byte `json:"signature"`
+	}
+	// crypto.Signer has no context, the client's timeout bounds the call
+	if err := k.call(context.Background(), http.MethodPost, k.name+":asymmetricSign", req, &body); err != nil {
+		return nil, err
+	}
+	return body.Signature, nil
+}
+
+// call makes a Cloud KMS API call, JSON in and out
+func (k *gcpKey) call(ctx context.Context, method, path string, in, out any) error {
+	token, err := k.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	var payload io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, gcpEndpoint+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcpkms: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gcpkms: %s returned %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("gcpkms: %w", err)
+	}
+	return nil
+}
+
+// accessToken is the token calls are made with, the metadata server's is
+// kept until a minute before it expires
+func (k *gcpKey) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.token != "" && time.Now().Before(k.expires) {
+		return k.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadata, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gcpkms: no GOOGLE_OAUTH_ACCESS_TOKEN and the metadata server can't be reached: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcpkms: metadata server returned %s", resp.Status)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("gcpkms: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("gcpkms: metadata server gave no access token")
+	}
+	k.token = body.AccessToken
+	k.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - time.Minute)
+	return k.token, nil
+}
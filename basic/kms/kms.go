@@ -0,0 +1,108 @@
+// Package kms signs with keys held in a key management service or an HSM,
+// so the private key never sits on this machine's disk.
+//
+// A key is picked with a URI whose scheme says where it's held:
+//
+//	gcpkms://projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/1
+//
+// Each store is an Opener returning a Signer, a crypto.Signer that also says
+// which digest the key signs. Register adds stores, e.g. one around a PKCS#11
+// module or a cloud SDK; keys behind a PKCS#11 module can also be reached
+// through an ssh-agent with `ssh-add -s`.
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Signer is a key held somewhere else
+type Signer interface {
+	crypto.Signer
+	// Hash is the digest the key signs, 0 for keys that sign the message
+	// itself like Ed25519
+	Hash() crypto.Hash
+}
+
+// Opener opens the key at uri, client makes the calls to stores with an HTTP API
+type Opener func(ctx context.Context, uri *url.URL, client *http.Client) (Signer, error)
+
+var (
+	mu      sync.Mutex
+	openers = map[string]Opener{
+		"gcpkms": openGCP,
+	}
+)
+
+// Register adds the store for URIs with scheme
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[scheme] = open
+}
+
+// Open returns the key at uri
+func Open(ctx context.Context, uri string, client *http.Client) (Signer, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("kms uri %q: %w", uri, err)
+	}
+	mu.Lock()
+	open, ok := openers[u.Scheme]
+	schemes := slices.Sorted(maps.Keys(openers))
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("kms uri %q: unknown store %q (want %s)", uri, u.Scheme, strings.Join(schemes, " or "))
+	}
+	return open(ctx, u, client)
+}
+
+// SSHSigner adapts s for SSH, offering only the signature algorithms that
+// use the digest the key signs
+func SSHSigner(s Signer) (gossh.Signer, error) {
+	signer, err := gossh.NewSignerFromSigner(s)
+	if err != nil {
+		return nil, err
+	}
+	var want crypto.Hash
+	switch pub := s.Public().(type) {
+	case *rsa.PublicKey:
+		// RSA keys can sign with more than one digest, so SSH is told which
+		algorithm := map[crypto.Hash]string{
+			crypto.SHA256: gossh.KeyAlgoRSASHA256,
+			crypto.SHA512: gossh.KeyAlgoRSASHA512,
+		}[s.Hash()]
+		if algorithm == "" {
+			return nil, fmt.Errorf("kms: SSH can't use an RSA key that signs %v digests", s.Hash())
+		}
+		return gossh.NewSignerWithAlgorithms(signer.(gossh.AlgorithmSigner), []string{algorithm})
+	case *ecdsa.PublicKey:
+		// The curve picks the digest in SSH
+		switch pub.Curve.Params().BitSize {
+		case 256:
+			want = crypto.SHA256
+		case 384:
+			want = crypto.SHA384
+		default:
+			want = crypto.SHA512
+		}
+	case ed25519.PublicKey:
+		want = 0
+	}
+	if s.Hash() != want {
+		return nil, fmt.Errorf("kms: SSH signs with %s keys using %v digests, this key uses %v", signer.PublicKey().Type(), want, s.Hash())
+	}
+	return signer, nil
+}
@@ -0,0 +1,144 @@
+// Package l10n formats numbers, money and times the way a user's locale writes them,
+// e.g. 1.234,5 and 16.10.2026 for de_DE, 1,234.5 and Oct 16, 2026 for en_US.
+//
+// Numbers and money come from golang.org/x/text. It has no date formatting,
+// so dates use a small table of the usual numeric layouts per language.
+package l10n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Formatter formats for one user: in their locale, with times in their zone
+// Build it with New, the zero value isn't usable
+type Formatter struct {
+	p     *message.Printer
+	zone  *time.Location
+	date  string // layout for the date
+	clock string // layout for the time of day
+}
+
+// New returns a formatter for locale, as a POSIX locale like "de_DE.UTF-8",
+// showing times in zone
+// Empty, C and POSIX locales, and ones that can't be parsed, get US English
+func New(locale string, zone *time.Location) Formatter {
+	tag := parse(locale)
+	date, clock := layouts(tag)
+	return Formatter{p: message.NewPrinter(tag), zone: zone, date: date, clock: clock}
+}
+
+// parse turns "es_MX.UTF-8@euro" into es-MX
+func parse(locale string) language.Tag {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return language.AmericanEnglish
+	}
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return language.AmericanEnglish
+	}
+	return tag
+}
+
+// layouts picks the date and clock layouts for tag
+func layouts(tag language.Tag) (date, clock string) {
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+	switch base.String() {
+	case "en":
+		if region.String() == "US" {
+			return "Jan _2, 2006", "3:04 PM"
+		}
+		return "_2 Jan 2006", "15:04"
+	case "de", "ru", "pl", "cs", "fi", "nb", "da", "tr", "uk":
+		return "02.01.2006", "15:04"
+	case "fr", "es", "it", "pt", "el", "vi", "id":
+		return "02/01/2006", "15:04"
+	case "nl":
+		return "02-01-2006", "15:04"
+	case "ja", "zh", "ko":
+		return "2006/01/02", "15:04"
+	}
+	return "2006-01-02", "15:04"
+}
+
+// Zone is the time zone times are shown in
+func (f Formatter) Zone() *time.Location {
+	return f.zone
+}
+
+// Int formats n with the locale's digit grouping, e.g. 1,234 or 1.234
+func (f Formatter) Int(n int) string {
+	return f.p.Sprint(number.Decimal(n))
+}
+
+// Decimal formats x with exactly digits digits after the decimal separator
+func (f Formatter) Decimal(x float64, digits int) string {
+	return f.p.Sprint(number.Decimal(x, number.MinFractionDigits(digits), number.MaxFractionDigits(digits)))
+}
+
+// Percent formats a fraction, 0.25 is 25%
+func (f Formatter) Percent(x float64) string {
+	return f.p.Sprint(number.Percent(x))
+}
+
+// Money formats amount in the currency with the ISO 4217 code, e.g. EUR
+func (f Formatter) Money(amount float64, code string) (string, error) {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", fmt.Errorf("currency %q: %w", code, err)
+	}
+	return f.p.Sprint(currency.Symbol(unit.Amount(amount))), nil
+}
+
+// Date formats t's date in the user's zone
+func (f Formatter) Date(t time.Time) string {
+	return t.In(f.zone).Format(f.date)
+}
+
+// Time formats t's time of day and zone, e.g. "14:03 CEST"
+func (f Formatter) Time(t time.Time) string {
+	return t.In(f.zone).Format(f.clock + " MST")
+}
+
+// When formats t for a list or banner, leaving out the date when it's today
+// in the user's zone and adding how long before now it was,
+// e.g. "14:03 CEST, 5 minutes ago"
+func (f Formatter) When(t, now time.Time) string {
+	at := f.Time(t)
+	if t.In(f.zone).YearDay() != now.In(f.zone).YearDay() || t.Year() != now.Year() {
+		at = f.Date(t) + " " + at
+	}
+	return at + ", " + Ago(t, now)
+}
+
+// Ago says how long before now t was, e.g. "just now" or "3 hours ago"
+func Ago(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		// Includes small clock differences that put t a moment ahead of now
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	default:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
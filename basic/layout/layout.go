@@ -0,0 +1,71 @@
+// Package layout fits screens to the client's terminal: centered when there's
+// room to spare, wrapped when it's narrow, clipped when it's short.
+package layout
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// MaxWidth is the longest line text is wrapped to, even on wide terminals,
+// longer lines get hard to read
+const MaxWidth = 72
+
+// Wrap breaks text at word boundaries to fit width, or MaxWidth if that's less
+// A width of zero or less means the size isn't known yet, and leaves text alone
+func Wrap(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	return ansi.Wrap(text, min(width, MaxWidth), "")
+}
+
+// Fit wraps view to width only if it's wider, for whole screens whose lines
+// were laid out for a roomier terminal
+func Fit(view string, width int) string {
+	if width <= 0 || lipgloss.Width(view) <= width {
+		return view
+	}
+	return ansi.Wrap(view, width, "")
+}
+
+// Center places view in the middle of a width by height terminal
+// Views that don't fit, and unknown sizes, are left where they are
+func Center(view string, width, height int) string {
+	if width <= 0 || height <= 0 {
+		return view
+	}
+	w, h := lipgloss.Size(view)
+	if w > width || h > height {
+		return view
+	}
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, block(view, w))
+}
+
+// CenterHorizontally moves view to the middle of a width wide terminal, for
+// inline sessions, which draw below the shell prompt and shouldn't fill the height
+func CenterHorizontally(view string, width int) string {
+	w := lipgloss.Width(view)
+	if width <= 0 || w > width {
+		return view
+	}
+	return lipgloss.PlaceHorizontal(width, lipgloss.Center, block(view, w))
+}
+
+// block pads every line of view to width, so placing it moves the block as a
+// whole and lines keep their alignment with each other
+func block(view string, width int) string {
+	return lipgloss.NewStyle().Width(width).Render(view)
+}
+
+// ClipTop drops lines from the top of view so it fits in height lines,
+// the same lines the terminal would scroll away, zero height keeps everything
+func ClipTop(view string, height int) string {
+	lines := strings.Split(view, "\n")
+	if height <= 0 || len(lines) <= height {
+		return view
+	}
+	return strings.Join(lines[len(lines)-height:], "\n")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+)
+
+// limiter caps how many sessions use the app at once, nil unless --max-sessions is set
+var limiter *sessionLimiter
+
+// sessionLimiter lets up to max sessions into the app and keeps the next few
+// waiting on a queue screen, which lets them in by itself when a slot frees
+// Past the queue's size sessions are turned away with a message
+type sessionLimiter struct {
+	max      int
+	queueMax int
+
+	mu     sync.Mutex
+	active int
+	queue  []*sessionSlot // waiting, first in line first
+}
+
+// sessionSlot is one session's place, kept in its ssh.Context
+type sessionSlot struct {
+	admitted chan struct{} // closed once the session is let in
+}
+
+type slotKey struct{}
+
+func newSessionLimiter(max, queueMax int) *sessionLimiter {
+	return &sessionLimiter{max: max, queueMax: queueMax}
+}
+
+// join gives the session a slot or a place in the queue, false when both are full
+func (l *sessionLimiter) join() (*sessionSlot, bool) {
+	slot := &sessionSlot{admitted: make(chan struct{})}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.active < l.max:
+		l.active++
+		close(slot.admitted)
+	case len(l.queue) < l.queueMax:
+		l.queue = append(l.queue, slot)
+	default:
+		return nil, false
+	}
+	return slot, true
+}
+
+// leave frees the slot for the next in line, or takes it out of the queue
+func (l *sessionLimiter) leave(slot *sessionSlot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !slot.isAdmitted() {
+		l.queue = slices.DeleteFunc(l.queue, func(s *sessionSlot) bool { return s == slot })
+		return
+	}
+	l.active--
+	if len(l.queue) > 0 {
+		next := l.queue[0]
+		l.queue = l.queue[1:]
+		l.active++
+		close(next.admitted)
+	}
+}
+
+// place is the slot's position in the queue, counting from 1, or 0 once it's let in
+func (l *sessionLimiter) place(slot *sessionSlot) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Index(l.queue, slot) + 1
+}
+
+func (s *sessionSlot) isAdmitted() bool {
+	select {
+	case <-s.admitted:
+		return true
+	default:
+		return false
+	}
+}
+
+// slotFromContext returns the session's slot, nil when sessions aren't limited
+func slotFromContext(ctx ssh.Context) *sessionSlot {
+	slot, _ := ctx.Value(slotKey{}).(*sessionSlot)
+	return slot
+}
+
+// limitMiddleware holds a slot for each session while it runs
+// Admins are never limited, so they can always get in to see what's going on
+func limitMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if limiter == nil || isAdmin(s) {
+				next(s)
+				return
+			}
+			slot, ok := limiter.join()
+			if !ok {
+				log.Info("Server full, turning session away", "user", s.User(), "remote", s.RemoteAddr())
+				wish.Fatalln(s, "The server is full and so is its queue, try again in a few minutes")
+				return
+			}
+			defer limiter.leave(slot)
+			s.Context().SetValue(slotKey{}, slot)
+			next(s)
+		}
+	}
+}
+
+// queueMsg tells a waiting session its place in the queue
+// The field is exported so message logs can record it
+type queueMsg struct {
+	Place int
+}
+
+// admittedMsg tells a waiting session it has been let in
+type admittedMsg struct{}
+
+// queueTick looks up the slot's place again after a second
+func queueTick(slot *sessionSlot) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return queueMsg{Place: limiter.place(slot)}
+	})
+}
+
+// waitForSlot is a command that blocks until the session is let in
+func waitForSlot(slot *sessionSlot) tea.Cmd {
+	return func() tea.Msg {
+		<-slot.admitted
+		return admittedMsg{}
+	}
+}
+
+// queueView is shown to sessions waiting for a slot
+func queueView(f l10n.Formatter, place int) string {
+	if place == 0 {
+		return "the server is full, waiting for a place in the queue…\n\nctrl+c to leave"
+	}
+	return fmt.Sprintf("the server is full, you are #%s in the queue\n\nyou'll be let in as soon as a place frees up\n\nctrl+c to leave", f.Int(place))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// lockAfter is how long a session can sit without a keypress before it locks,
+// set by --lock-after, zero turns locking off
+var lockAfter = 10 * time.Minute
+
+// lockMsg is sent by lockTick to check whether the session has gone idle
+// The field is exported so message logs can record it
+type lockMsg struct {
+	At time.Time
+}
+
+// lockTick checks for inactivity again after d
+func lockTick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg { return lockMsg{At: t} })
+}
+
+// checkLock locks the session once it has been idle for lockAfter
+// and schedules the next check for when that could next happen
+func (m model) checkLock(msg lockMsg) (model, tea.Cmd) {
+	idle := msg.At.Sub(m.lastActive)
+	if idle >= lockAfter {
+		m.locked = true
+		return m, lockTick(lockAfter)
+	}
+	return m, lockTick(lockAfter - idle)
+}
+
+// lockView replaces everything on screen while locked
+// so whatever the user was typing isn't left showing on an unattended terminal
+func lockView() string {
+	return "locked after inactivity\n\npress any key to resume • ctrl+c to leave"
+}
@@ -0,0 +1,84 @@
+// Package lru is a fixed size cache that evicts the least recently used entry.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache holds up to size entries, it's safe for concurrent use
+type Cache[K comparable, V any] struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List // front is the most recently used
+	items map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New returns an empty cache that holds up to size entries
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  max(size, 1),
+		order: list.New(),
+		items: map[K]*list.Element{},
+	}
+}
+
+// Get returns the value for key and marks it recently used
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*entry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add stores value for key, evicting the least recently used entry when full
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key, value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Remove drops key from the cache
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Purge drops every entry
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.items)
+}
+
+// Len returns how many entries are cached
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
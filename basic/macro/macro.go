@@ -0,0 +1,122 @@
+// Package macro stores recorded keystroke macros, one per user, in a small
+// JSON file so a macro outlives the session it was recorded in.
+//
+// Macros are keyed by the user's key fingerprint rather than their SSH
+// username, which any client can claim.
+//
+// The app records tea.Key values as they arrive and plays them back by
+// sending the same key messages through its own Update.
+package macro
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// MaxKeys caps how long a macro can be, so a forgotten recording doesn't grow forever
+const MaxKeys = 256
+
+// Store keeps each user's macro in a JSON file, by fingerprint
+// Every SSH session runs in its own goroutine, so access is guarded by a mutex
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStore returns a store that reads and writes the JSON file at path
+// The file is created on the first Save
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Get returns the macro recorded with fingerprint, nil if there isn't one
+func (s *Store) Get(fingerprint string) ([]tea.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return all[fingerprint], nil
+}
+
+// Save replaces fingerprint's macro, an empty one deletes it
+func (s *Store) Save(fingerprint string, keys []tea.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		delete(all, fingerprint)
+	} else {
+		all[fingerprint] = keys
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half a file behind
+	// Only the server's user can read it, macros are whatever the user typed
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// load reads the whole file; callers must hold s.mu
+func (s *Store) load() (map[string][]tea.Key, error) {
+	all := map[string][]tea.Key{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Check makes sure the macro file can be read and parsed
+// A missing file is fine, it just means nobody has recorded a macro yet
+func (s *Store) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.load()
+	return err
+}
+
+// Controls are the keys that start and stop recording and play the macro back,
+// they're never recorded, so a macro can't play itself over and over
+var Controls = []string{"ctrl+r", "ctrl+p"}
+
+// DoneMsg is sent after the last key Play sends
+type DoneMsg struct{}
+
+// Play is a command that sends keys back to the program one after another,
+// then DoneMsg; controls in macros saved before they were left out are skipped
+func Play(keys []tea.Key) tea.Cmd {
+	var cmds []tea.Cmd
+	for _, k := range keys {
+		if slices.Contains(Controls, tea.KeyMsg(k).String()) {
+			continue
+		}
+		cmds = append(cmds, func() tea.Msg { return tea.KeyMsg(k) })
+	}
+	cmds = append(cmds, func() tea.Msg { return DoneMsg{} })
+	return tea.Sequence(cmds...)
+}
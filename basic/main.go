@@ -9,69 +9,645 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"maps"
 	"net"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
+	// Release builds run where there may be no zoneinfo, so the zone database is built in
+	_ "time/tzdata"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	//"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
-	"github.com/charmbracelet/wish/activeterm"
 	"github.com/charmbracelet/wish/bubbletea"
-	"github.com/charmbracelet/wish/logging"
+	"github.com/jwc20/wish-bubbletea-tests/basic/admin"
+	"github.com/jwc20/wish-bubbletea-tests/basic/audit"
+	"github.com/jwc20/wish-bubbletea-tests/basic/avatar"
+	"github.com/jwc20/wish-bubbletea-tests/basic/breaker"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+	"github.com/jwc20/wish-bubbletea-tests/basic/chat"
+	"github.com/jwc20/wish-bubbletea-tests/basic/colorpick"
+	"github.com/jwc20/wish-bubbletea-tests/basic/config"
+	"github.com/jwc20/wish-bubbletea-tests/basic/emoji"
+	"github.com/jwc20/wish-bubbletea-tests/basic/forgekeys"
+	"github.com/jwc20/wish-bubbletea-tests/basic/form"
+	"github.com/jwc20/wish-bubbletea-tests/basic/handoff"
+	"github.com/jwc20/wish-bubbletea-tests/basic/hyperlink"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/layout"
+	"github.com/jwc20/wish-bubbletea-tests/basic/macro"
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+	"github.com/jwc20/wish-bubbletea-tests/basic/presence"
+	"github.com/jwc20/wish-bubbletea-tests/basic/ratelimit"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessionlog"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessions"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/telemetry"
+	"github.com/jwc20/wish-bubbletea-tests/basic/theme"
+	"github.com/jwc20/wish-bubbletea-tests/basic/tos"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	gossh "golang.org/x/crypto/ssh"
 )
 
-const (
-	// For production deployment, use 0.0.0.0 to listen on all interfaces
-	// localhost is good for development
-	host = "0.0.0.0"
-	// Port 22 is the default SSH port but requires elevated privileges
-	// Using port 3000 instead to avoid permission issues on macOS
-	port = "3000"
-)
+// tosStore remembers which users accepted which Terms of Service version
+// It is shared by every session, so it lives outside the model
+var tosStore = tos.NewStore("tos.json")
+
+// inline runs sessions without the alt screen, set by --inline
+// Whatever the app prints then stays in the client's own scrollback after it exits
+var inline bool
+
+// macroStore keeps each user's recorded keyboard macro between sessions
+var macroStore = macro.NewStore("macros.json")
+
+// handoffs holds the one-time tokens for moving a session to another device
+var handoffs = handoff.NewRegistry(5 * time.Minute)
+
+// usage reports anonymous usage counts for users who opted in,
+// nil unless --telemetry-endpoint is set
+var usage *telemetry.Reporter
+
+// usageConsents remembers who agreed to be counted and who declined
+var usageConsents = telemetry.NewConsents("telemetry.json")
+
+// userStore keeps a profile for every public key that has connected
+var userStore = user.NewStore("users.json")
+
+// submissionStore keeps every submitted value, opened from --db during warm-up, see openStorage
+var submissionStore *storage.Store
+
+// broadcaster reaches every running program, for announcements
+var broadcaster = broadcast.New()
+
+// room is the chat every session can join, see the chat package
+var room = chat.NewHub()
+
+// online counts the users in the app, every session is told when it changes
+var online = presence.New(func(o presence.Online) { broadcaster.Send(o) })
+
+// connected lists every running session, for operators and admin views
+var connected = sessions.NewRegistry()
+
+// sessionLog records what each session did as JSON lines, nil when --session-log is empty
+var sessionLog *sessionlog.Logger
+
+// rateLimits throttles and bans addresses that reconnect too fast, nil when --rate-limit is 0
+// Bans are kept in bans.json so they survive restarts
+var rateLimits *ratelimit.Limiter
+
+// authKeys is the public key allowlist, nil when everyone is let in
+var authKeys *authorizedKeys
+
+// contentDir holds editable text such as the prompt templates, set by --content
+// Files there override the defaults built into the binary, see contentFS
+var contentDir = "content"
 
 func main() {
+	// The address to listen on and other settings come from the --profile, see profile.go,
+	// then the --config file and BASIC_* environment variables, then the flags below
+	configPath := flag.String("config", "", "YAML file with settings that override the profile, see the config package")
+	profileName := flag.String("profile", "prod", "settings profile to start from ("+profileNames()+")")
+	host := flag.String("host", baseSettings.host, "address to listen on")
+	port := flag.String("port", baseSettings.port, "port to listen on")
+	hostKeyFile := flag.String("host-key", baseSettings.hostKey, "host key file, generated on first start if missing")
+	logLevel := flag.String("log-level", baseSettings.logLevel.String(), "least severe messages to log (debug, info, warn, error)")
+	listenRetries := flag.Int("listen-retries", baseSettings.listenRetries, "how many times to try binding the port before giving up")
+	listenBackoff := flag.Duration("listen-backoff", 500*time.Millisecond, "wait before the first bind retry, doubled after each attempt")
+	listenBackoffMax := flag.Duration("listen-backoff-max", 10*time.Second, "longest wait between bind retries")
+	drainSpec := flag.String("drain", baseSettings.drain, "shutdown policy per session kind (immediate, wait-for-idle, hard-deadline)")
+	drainTimeout := flag.Duration("drain-timeout", baseSettings.drainTimeout, "how long shutdown waits for sessions before cutting them")
+	middleware := flag.String("middleware", baseSettings.middleware, "session middleware in the order sessions pass through it, ending with bubbletea")
+	flag.StringVar(&secretsURI, "secrets", "", "where to load secrets from, e.g. vault://secret/basic or sops://secrets.enc.yaml")
+	hostKeySecret := flag.String("host-key-secret", "", "name of the secret holding the host key PEM, used instead of the key file")
+	hostKeyAgent := flag.Bool("host-key-agent", false, "sign with a host key held by the ssh-agent at $SSH_AUTH_SOCK (e.g. backed by an HSM or KMS)")
+	hostKeyFingerprint := flag.String("host-key-fingerprint", "", "which ssh-agent key to use, defaults to the first one")
+	hostKeyKMS := flag.String("host-key-kms", "", "sign with a host key held in a KMS, e.g. gcpkms://projects/P/locations/L/keyRings/R/cryptoKeys/K/cryptoKeyVersions/1")
+	allowForward := flag.String("allow-forward", "", "port forwards to allow, as SHA256:fingerprint=host:port pairs for the keys that may use them")
+	scannerThreshold := flag.Int("scanner-threshold", 5, "suspicious connections per address before it gets tarpitted (twice this drops it)")
+	scannerWindow := flag.Duration("scanner-window", 10*time.Minute, "how long suspicious connections are remembered")
+	scannerTarpit := flag.Duration("scanner-tarpit", 10*time.Second, "delay added to connections from tarpitted addresses")
+	rateLimit := flag.Int("rate-limit", 20, "connections allowed per address per --rate-window, twice as many bans it (0 for no limit)")
+	rateWindow := flag.Duration("rate-window", time.Minute, "window --rate-limit counts connections over")
+	banFor := flag.Duration("ban-for", time.Hour, "how long an address that hits twice --rate-limit stays banned")
+	maxConnections := flag.Int("max-connections", 0, "most connections at once, later ones wait in a queue (0 for no limit)")
+	acceptQueue := flag.Int("accept-queue", 32, "most connections waiting for a slot once --max-connections is reached, the rest are refused")
+	sessionLogPath := flag.String("session-log", "sessions.jsonl", "file to log each session's connect, disconnect, resizes and submissions to, as JSON lines (off when empty)")
+	sessionLogSize := flag.Int64("session-log-size", 10<<20, "bytes --session-log grows to before it's rotated")
+	sessionLogKeep := flag.Int("session-log-keep", 5, "rotated --session-log files to keep")
+	auditPath := flag.String("audit-log", "audit.jsonl", "file admin impersonation is recorded in, as JSON lines")
+	flag.DurationVar(&impersonateFor, "impersonate-for", impersonateFor, "how long an admin can view the app as another user before the session ends")
+	maxSessions := flag.Int("max-sessions", 0, "most sessions in the app at once, later ones wait on a queue screen (0 for no limit)")
+	sessionQueue := flag.Int("session-queue", 32, "most sessions waiting on the queue screen once --max-sessions is reached, the rest are turned away")
+	clientDeny := flag.String("client-deny", "", "comma separated SSH client version globs to turn away, e.g. SSH-2.0-libssh*")
+	clientWarn := flag.String("client-warn", "", "comma separated SSH client version globs to warn about")
+	flag.BoolVar(&inline, "inline", inline, "draw below the shell prompt instead of taking over the screen, keeping the terminal's scrollback")
+	flag.StringVar(&messageLogDir, "record-messages", messageLogDir, "directory to save each session's messages in, for `replay` (off when empty)")
+	flag.StringVar(&recordDir, "record-sessions", "", "directory to record terminal sessions in as asciicast files, for asciinema play (off when empty)")
+	recordUsersSpec := flag.String("record-users", "", "comma separated users whose sessions --record-sessions records (everyone when empty)")
+	flag.DurationVar(&recordRetention, "record-retention", recordRetention, "how long session recordings are kept")
+	flag.Int64Var(&recordMaxBytes, "record-max-bytes", recordMaxBytes, "most bytes session recordings take up together, the oldest are removed past it (0 for no limit)")
+	flag.BoolVar(&timeTravel, "time-travel", timeTravel, "record each session's history so f12 can step back through it (debugging only)")
+	flag.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "close sessions after this long without a keypress, with a warning a minute before (0 to never close)")
+	flag.DurationVar(&lockAfter, "lock-after", lockAfter, "lock idle sessions after this long without a keypress (0 to never lock)")
+	flag.IntVar(&maxInputLength, "max-length", maxInputLength, "most characters a user can submit")
+	flag.StringVar(&contentDir, "content", contentDir, "directory whose files override the built-in prompt templates and other text")
+	flag.StringVar(&motdNotice, "motd-notice", "", "file whose text is shown as the notice in the message of the day, add motd to --middleware (none when empty)")
+	flag.DurationVar(&motdHold, "motd-hold", motdHold, "how long the message of the day is shown before the app starts")
+	telemetryEndpoint := flag.String("telemetry-endpoint", "", "URL to POST anonymous usage counts to, for users who opt in (off when empty)")
+	telemetryInterval := flag.Duration("telemetry-interval", time.Hour, "how often usage counts are sent")
+	contentPoll := flag.Duration("content-poll", 2*time.Second, "how often to look for changes in the content directory (0 to never reload)")
+	chaosSpec := flag.String("chaos", "", "faults to inject for testing, e.g. latency=2s,disconnect=5m,storage=500ms (add chaos to --middleware too)")
+	passwordsPath := flag.String("passwords", "", "file of NAME:BCRYPT-HASH lines letting users without a key log in with a password, needs --authorized-keys")
+	forgeSpec := flag.String("forge-keys", "", "also admit keys users have published on a forge, logging in as USER or FORGE:USER, e.g. github,gitlab or work=https://git.example.com/{user}.keys, needs --authorized-keys")
+	forgeTTL := flag.Duration("forge-keys-ttl", 10*time.Minute, "how long a user's keys from --forge-keys are used before they're fetched again")
+	authorizedKeysPath := flag.String("authorized-keys", "", "OpenSSH authorized_keys file listing the only keys allowed in (everyone gets in when empty, outside --profile dev only on localhost)")
+	dbPath := flag.String("db", "submissions.db", "SQLite database for submitted values")
+	flag.StringVar(&webhookURL, "webhook", "", "URL to POST each submission to as JSON (off when empty)")
+	flag.StringVar(&slackWebhookURL, "slack-webhook", "", "Slack incoming webhook URL to announce each submission at (off when empty)")
+	flag.StringVar(&smtpAddr, "smtp", "", "SMTP server host:port to email submitters their receipt through (off when empty)")
+	flag.StringVar(&smtpFrom, "smtp-from", "coffee@localhost", "address receipts are sent from")
+	flag.StringVar(&smtpUser, "smtp-user", "", "SMTP login, the password is read from SMTP_PASSWORD")
+	flag.StringVar(&smtpPasswordSecret, "smtp-password-secret", "", "name of the secret holding the SMTP password, used instead of SMTP_PASSWORD")
+	breakerThreshold := flag.Int("breaker-threshold", 5, "failures in a row before calls to an integration (webhook, slack, email) are paused")
+	breakerCooldown := flag.Duration("breaker-cooldown", time.Minute, "how long calls to a failing integration are paused before one is tried again")
+	outboundSpec := flag.String("outbound", "", "timeout, attempts and backoff per integration, e.g. webhook=5s/3/1s,vault=20s ("+strings.Join(slices.Sorted(maps.Keys(outbound.Defaults)), ", ")+")")
+	outboxEvery := flag.Duration("outbox-every", 30*time.Second, "how often undelivered notifications are retried, new ones go straight away")
+	flag.DurationVar(&trashRetention, "trash-retention", trashRetention, "how long deleted submissions stay in the trash, where they can be restored, before they're purged")
+	guestsOn := flag.Bool("guests", false, "let clients without a key in --authorized-keys in as guests who can't save anything")
+	guestRate := flag.Int("guest-rate", 5, "guest sessions allowed per address per minute")
+	flag.StringVar(&guestContact, "guest-contact", "", "where guests should send their public key to register, e.g. an email address")
+	adminFilesSpec := flag.String("admin-files", "", "directories admins can look through read-only, as name=path pairs, e.g. content=content,recordings=recordings")
+	flag.StringVar(&adminFilesHint, "admin-files-hint", "", "where admins can download shared files, with {path} for the file, e.g. sftp://files.example.com/{path}")
+	adminKeys := flag.String("admins", "", "comma separated SHA256 key fingerprints that get the admin view instead of the app")
+	updateCheckURL := flag.String("update-check", "", "release URL to check for a newer version at startup, e.g. https://api.github.com/repos/OWNER/REPO/releases/latest (off when empty)")
+	controlFIFO := flag.String("control-fifo", "", "named pipe to read runtime control commands from (log-level, maintenance, stacks, scanners, clients, queue, bans, unban, sessions, kick, broadcast, broadcast-to, breakers, reload, record)")
+	flag.Parse()
+
+	// `version` prints the build info, it needs no configuration
+	if flag.Arg(0) == "version" {
+		os.Exit(versionCommand())
+	}
+
+	calls, err := outbound.Parse(*outboundSpec)
+	if err != nil {
+		log.Error("Invalid --outbound", "error", err)
+		os.Exit(exitConfig)
+	}
+	outboundPolicies = calls
+
+	if adminFiles, err = admin.ParseDirs(*adminFilesSpec); err != nil {
+		log.Error("Invalid --admin-files", "error", err)
+		os.Exit(exitConfig)
+	}
+	recordUsers = parseRecordUsers(*recordUsersSpec)
+
+	// `hash-password NAME` makes a line for --passwords
+	if flag.Arg(0) == "hash-password" {
+		os.Exit(hashPasswordCommand(flag.Args()[1:]))
+	}
+
+	// `self-update` installs the latest signed release over this binary
+	if flag.Arg(0) == "self-update" {
+		os.Exit(selfUpdateCommand(flag.Args()[1:], *updateCheckURL))
+	}
+
+	file, err := config.Load(*configPath)
+	if err != nil {
+		log.Error("Could not read --config", "error", err)
+		os.Exit(exitConfig)
+	}
+	// The config file can pick the profile, but --profile still wins
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "profile" {
+			file.Profile = *profileName
+		}
+	})
+	if file.Profile == "" {
+		file.Profile = *profileName
+	}
+	cfg, err := resolveProfile(file.Profile)
+	if err != nil {
+		log.Error("Invalid --profile", "error", err)
+		os.Exit(exitConfig)
+	}
+	profileLevel := cfg.logLevel
+	if err := applyConfig(&cfg, file); err != nil {
+		log.Error("Invalid --config", "error", err)
+		os.Exit(exitConfig)
+	}
+	// Flags given on the command line win over the profile and the config file
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.host = *host
+		case "port":
+			cfg.port = *port
+		case "host-key":
+			cfg.hostKey = *hostKeyFile
+		case "log-level":
+			cfg.logLevel, err = log.ParseLevel(*logLevel)
+		case "listen-retries":
+			cfg.listenRetries = *listenRetries
+		case "drain":
+			cfg.drain = *drainSpec
+		case "drain-timeout":
+			cfg.drainTimeout = *drainTimeout
+		case "middleware":
+			cfg.middleware = *middleware
+		}
+	})
+	if err != nil {
+		log.Error("Invalid --log-level", "error", err)
+		os.Exit(exitConfig)
+	}
+	if !cfg.integrations {
+		dropIntegrations(file.Profile, map[string]*string{
+			"webhook":            &webhookURL,
+			"slack-webhook":      &slackWebhookURL,
+			"smtp":               &smtpAddr,
+			"telemetry-endpoint": telemetryEndpoint,
+			"update-check":       updateCheckURL,
+		})
+	}
+
+	// Some settings can change on SIGHUP, see reload.go, the file is read the same way then
+	liveConfig = configSource{
+		path:    *configPath,
+		flagged: map[string]bool{},
+		base: liveSettings{
+			logLevel:   profileLevel,
+			admins:     parseAdmins(*adminKeys),
+			rateLimit:  *rateLimit,
+			rateWindow: *rateWindow,
+			banFor:     *banFor,
+		},
+		applied: file,
+	}
+	flag.Visit(func(f *flag.Flag) { liveConfig.flagged[f.Name] = true })
+	if liveConfig.flagged["log-level"] {
+		liveConfig.base.logLevel = cfg.logLevel
+	}
+	live, err := liveConfig.live(file)
+	if err != nil {
+		log.Error("Invalid --config", "error", err)
+		os.Exit(exitConfig)
+	}
+	log.SetLevel(live.logLevel)
+	banner.Store(&live.banner)
+
+	policies, err := parseDrainPolicies(cfg.drain)
+	if err != nil {
+		log.Error("Invalid --drain", "error", err)
+		os.Exit(exitConfig)
+	}
+	drain := newDrainer(policies)
+
+	chaos, err = parseChaos(*chaosSpec)
+	if err != nil {
+		log.Error("Invalid --chaos", "error", err)
+		os.Exit(exitConfig)
+	}
+	if *chaosSpec != "" {
+		log.Warn("Chaos mode is on, sessions will be slowed down and dropped", "chaos", *chaosSpec)
+	}
+
+	// A ticker can't tick every 0s, so this is caught here rather than when the first report is due
+	if *telemetryEndpoint != "" && *telemetryInterval <= 0 {
+		log.Error("Invalid --telemetry-interval, it must be more than 0", "interval", *telemetryInterval)
+		os.Exit(exitConfig)
+	}
+	usage = telemetry.NewReporter(*telemetryEndpoint, *telemetryInterval, outboundPolicies.Get(outbound.Telemetry).Client())
+
+	scanners = newScannerGuard(*scannerThreshold, *scannerWindow, *scannerTarpit)
+
+	if live.rateLimit > 0 {
+		rateLimits = ratelimit.New("bans.json", live.rateLimit, live.rateWindow, live.banFor)
+	}
+
+	if *maxConnections > 0 {
+		admissions = newAdmission(*maxConnections, *acceptQueue)
+	}
+
+	if *maxSessions > 0 {
+		limiter = newSessionLimiter(*maxSessions, *sessionQueue)
+	}
+
+	clients, err = newClientPolicy(*clientDeny, *clientWarn)
+	if err != nil {
+		log.Error("Invalid --client-deny or --client-warn", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	channels, err := parseForwardRules(*allowForward)
+	if err != nil {
+		log.Error("Invalid --allow-forward", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	// Subcommands don't serve sessions, so they don't create the log
+	if *sessionLogPath != "" && flag.NArg() == 0 {
+		if sessionLog, err = sessionlog.Open(*sessionLogPath, *sessionLogSize, *sessionLogKeep); err != nil {
+			log.Error("Could not open --session-log", "error", err)
+			os.Exit(exitConfig)
+		}
+	}
+
+	pipeline, err := buildPipeline(cfg.middleware, middlewareRegistry(drain, sessionLog))
+	if err != nil {
+		log.Error("Invalid --middleware", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	addr := net.JoinHostPort(cfg.host, cfg.port)
+
+	if *authorizedKeysPath != "" {
+		authKeys = newAuthorizedKeys(*authorizedKeysPath)
+	}
+	admins.set(live.admins)
+
+	if *passwordsPath != "" {
+		if authKeys == nil {
+			log.Warn("--passwords does nothing without --authorized-keys, everyone is already let in")
+		} else {
+			passwords = newPasswordFile(*passwordsPath)
+		}
+	}
+
+	if *forgeSpec != "" {
+		forges, err := forgekeys.Parse(*forgeSpec)
+		switch {
+		case err != nil:
+			log.Error("Invalid --forge-keys", "error", err)
+			os.Exit(exitConfig)
+		case authKeys == nil:
+			log.Warn("--forge-keys does nothing without --authorized-keys, everyone is already let in")
+		default:
+			forgeKeys = forgekeys.New(forges, *forgeTTL, outboundPolicies.Get(outbound.ForgeKeys).Client())
+		}
+	}
+
+	if *guestsOn {
+		if authKeys == nil {
+			log.Warn("--guests does nothing without --authorized-keys, everyone is already let in")
+		} else {
+			guests = newGuestLimiter(*guestRate, time.Minute)
+		}
+	}
+
+	src := hostKeySource{
+		path:        cfg.hostKey,
+		secret:      *hostKeySecret,
+		agent:       *hostKeyAgent,
+		fingerprint: *hostKeyFingerprint,
+		kms:         *hostKeyKMS,
+	}
+	// The host key file only matters when the key isn't coming from a secret, agent or KMS
+	keyPath := cfg.hostKey
+	if !src.onDisk() {
+		keyPath = ""
+	}
+
+	// `replay` runs recorded message logs against the current model, see messagelog.go
+	if flag.Arg(0) == "replay" {
+		args := flag.Args()[1:]
+		update := len(args) > 0 && args[0] == "-update"
+		if update {
+			args = args[1:]
+		}
+		os.Exit(replayCommand(args, update))
+	}
+
+	// `seed` adds demo data to a fresh deployment, see seed.go
+	if flag.Arg(0) == "seed" {
+		if err := openStorage(*dbPath); err != nil {
+			log.Error("Could not open --db", "error", err)
+			os.Exit(exitConfig)
+		}
+		os.Exit(seedCommand())
+	}
+
+	// `totp enable NAME` asks NAME for an authenticator code after their key, see totp.go
+	if flag.Arg(0) == "totp" {
+		os.Exit(totpCommand(flag.Args()[1:]))
+	}
+
+	// `orders` replays the order events and prints what they add up to, see orders.go
+	if flag.Arg(0) == "orders" {
+		if err := openStorage(*dbPath); err != nil {
+			log.Error("Could not open --db", "error", err)
+			os.Exit(exitConfig)
+		}
+		os.Exit(ordersCommand())
+	}
+
+	// ctx is cancelled on the first signal, which also stops bind retries and
+	// the secrets provider's background work
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Secrets are only loaded from here on, the commands above don't need them
+	secretsErr := openSecrets(ctx)
+	if secretsErr == nil {
+		secretsErr = loadSMTPPassword(ctx)
+	}
+	hostKey, hostKeyErr := hostKeyOption(ctx, src)
+
+	// `check` validates the setup and exits without starting the server
+	if flag.Arg(0) == "check" {
+		os.Exit(checkCommand(keyPath, hostKeyErr, secretsErr, addr, *dbPath))
+	}
+
+	// Run the same checks before starting so problems show up as clear messages
+	// instead of a half-started server
+	// The port is left out here, a busy port is retried by listen below
+	if problems := runChecks(keyPath, hostKeyErr, secretsErr); len(problems) > 0 {
+		for _, p := range problems {
+			log.Error("Startup check failed", "error", p)
+		}
+		os.Exit(exitConfig)
+	}
+
+	// Bans from the last run apply straight away, so they're loaded before listening
+	if rateLimits != nil {
+		if err := rateLimits.Load(); err != nil {
+			log.Error("Startup check failed", "error", checkProblem{
+				what: "ban list",
+				err:  err,
+				fix:  "fix or remove bans.json, removing it lifts every ban",
+			})
+			os.Exit(exitConfig)
+		}
+	}
+
+	// Admins can view the app as other users, which is recorded, see impersonate.go
+	if admins.count() > 0 {
+		if auditLog, err = audit.Open(*auditPath); err != nil {
+			log.Error("Could not open --audit-log", "error", err)
+			os.Exit(exitConfig)
+		}
+	}
+
 	// Wish handles all SSH security, user management, and shell restrictions
 	// This prevents users from gaining shell or root access to the server
-	s, err := wish.NewServer(
-		wish.WithAddress(net.JoinHostPort(host, port)),
-		// SSH keys will be stored in .ssh/id_ed25519
-		wish.WithHostKeyPath(".ssh/id_ed25519"),
-		wish.WithMiddleware(
-			// The bubbletea middleware connects our TUI app to SSH sessions
-			bubbletea.Middleware(teaHandler),
-			activeterm.Middleware(), // Bubble Tea apps usually require a PTY.
-			logging.Middleware(),
-		),
-	)
+	opts := []ssh.Option{
+		wish.WithAddress(addr),
+		hostKey,
+		// Deny port forwarding, agent forwarding and X11 unless explicitly allowed
+		channels.Option(),
+		// Slow down and then drop addresses that keep connecting like scanners
+		scanners.Option(),
+		// The session middleware comes from --middleware, see pipeline.go
+		wish.WithMiddleware(pipeline...),
+	}
+	if authKeys != nil {
+		// Only keys in --authorized-keys or --forge-keys get in, and users in --passwords
+		opts = append(opts, authKeys.Options()...)
+		if passwords != nil {
+			opts = append(opts, passwords.Option())
+		}
+	} else {
+		// Everyone gets in, but clients that offer a key are identified by it
+		opts = append(opts, openAuth()...)
+		if !loopback(cfg.host) {
+			if !cfg.openAuth {
+				log.Error("No --authorized-keys, the profile won't let anyone who can reach the port in; give one, listen on localhost or use --profile dev", "profile", file.Profile, "host", cfg.host)
+				os.Exit(exitConfig)
+			}
+			log.Warn("No --authorized-keys, anyone who can reach the port gets a session", "host", cfg.host)
+		}
+	}
+	if rateLimits != nil {
+		// Wraps the scanner guard, so addresses over the limit are refused before being tarpitted
+		opts = append(opts, rateLimits.Option())
+	}
+	if admissions != nil {
+		// Wraps the scanner guard and the auth handlers above, so it goes last
+		opts = append(opts, admissions.Option())
+	}
+	s, err := wish.NewServer(opts...)
+	if err != nil {
+		// Without a server there is nothing to run, so don't carry on with a nil s
+		log.Error("Could not start server", "error", err)
+		os.Exit(exitConfig)
+	}
+
+	// Usage counts are sent in the background and once more when ctx ends
+	usageDone := make(chan struct{})
+	go func() {
+		usage.Run(ctx)
+		close(usageDone)
+	}()
+
+	// Sessions pick up edits to the content directory without reconnecting
+	if *contentPoll > 0 {
+		go content.watch(ctx, contentDir, *contentPoll)
+	}
+
+	// Signals and the control FIFO let operators adjust the server while it runs
+	watchControls(*controlFIFO)
+
+	// Submissions in the trash past --trash-retention are removed for good
+	go purgeTrash(ctx)
+
+	// Session recordings past --record-retention or --record-max-bytes are removed
+	go pruneRecordings(ctx)
+
+	// The chat room closes with the server
+	go room.Run(ctx)
+
+	// Notifications saved with submissions are sent, and retried until they get through
+	breakers = breaker.NewSet(*breakerThreshold, *breakerCooldown, logBreaker)
+	setupNotifier(*outboxEvery)
+	if notifier.Enabled() {
+		go deliverNotifications(ctx)
+	}
+
+	if *updateCheckURL != "" {
+		go checkForUpdate(ctx, *updateCheckURL)
+	}
+
+	v, rev, _ := buildInfo()
+	log.Info("Starting SSH server", "version", v, "commit", rev, "profile", file.Profile, "host", cfg.host, "port", cfg.port)
+	// The database and data files get ready while the port is bound and sessions arrive
+	warmFailed := make(chan error, 1)
+	go func() {
+		if err := warm.run(dataChecks(*dbPath)); err != nil {
+			warmFailed <- err
+		}
+	}()
+	ln, err := listen(ctx, addr, retryPolicy{
+		attempts: cfg.listenRetries,
+		initial:  *listenBackoff,
+		max:      *listenBackoffMax,
+	})
 	if err != nil {
 		log.Error("Could not start server", "error", err)
+		os.Exit(exitCodeFor(err))
 	}
 
 	// Go routine (similar to multi-threading) to handle ssh server in parallel
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	log.Info("Starting SSH server", "host", host, "port", port)
+	serveErr := make(chan error, 1)
 	go func() {
-		if err = s.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
-			log.Error("Could not start server", "error", err)
-			done <- nil
+		if err := s.Serve(ln); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+			serveErr <- err
 		}
 	}()
 
-	<-done
+	code := exitOK
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		log.Error("Server stopped unexpectedly", "error", err)
+		code = exitError
+	case err := <-warmFailed:
+		log.Error("Warm-up failed, stopping", "error", err)
+		code = exitConfig
+	}
+
 	log.Info("Stopping SSH server")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.drainTimeout)
 	defer func() { cancel() }()
-	if err := s.Shutdown(ctx); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+	// Everyone still connected sees how long they have left,
+	// Shutdown stops accepting and waits for connections, Drain closes them per policy
+	deadline, _ := shutdownCtx.Deadline()
+	go countdown(shutdownCtx, deadline)
+	go drain.Drain(shutdownCtx)
+	if err := s.Shutdown(shutdownCtx); errors.Is(err, context.DeadlineExceeded) {
+		// Whatever is left past the deadline gets disconnected
+		log.Warn("Drain timeout reached, closing remaining connections")
+		s.Close()
+	} else if err != nil && !errors.Is(err, ssh.ErrServerClosed) {
 		log.Error("Could not stop server", "error", err)
 	}
+	drain.LogSummary()
+	<-usageDone
+	// Every session has ended, so nothing else writes to the database
+	if submissionStore != nil {
+		if err := submissionStore.Close(); err != nil {
+			log.Error("Could not close --db", "error", err)
+		}
+	}
+	if err := sessionLog.Close(); err != nil {
+		log.Error("Could not close --session-log", "error", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		log.Error("Could not close --audit-log", "error", err)
+	}
+	// Deferred cleanup is skipped by os.Exit, but the process is ending anyway
+	if code != exitOK {
+		os.Exit(code)
+	}
 }
 
 /* --------------------------------------------------------- */
@@ -84,38 +660,443 @@ func main() {
 // Instead, you return the model and options to the middleware
 // The middleware handles running, stopping, and managing the program
 func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+	// Admin keys get the server's admin view instead of the app,
+	// or the app as another user when they connect as as:NAME, see impersonate.go
+	// Their second factor is asked for first, as it is for everyone else
+	if isAdmin(s) {
+		var m tea.Model
+		var opts []tea.ProgramOption
+		if target, writable, ok := parseImpersonation(s.User()); ok {
+			m, opts = impersonateHandler(s, target, writable)
+		} else {
+			m, opts = adminHandler(s)
+		}
+		if m != nil && hasTOTP(s) {
+			m = newTOTPGate(s, m)
+		}
+		return m, opts
+	}
+
 	// PTY (pseudo-terminal) can provide info about client's terminal
-	// (terminal width, height, color scheme, etc.) but we're not using it here
-	s.Pty()
-	// WithAltScreen makes the app take over the entire terminal screen
-	// Similar to how terminal.shop creates a full-screen experience
-	return initialModel(), []tea.ProgramOption{tea.WithAltScreen()}
+	// (terminal width, height, color scheme, etc.), we use the terminal type for emoji support
+	// The size is passed along so the first frame fits, before a resize message arrives
+	pty, _, _ := s.Pty()
+
+	// A handoff token as the username continues another session as its user
+	username := userName(s)
+	handed, handedOff := handoffs.Redeem(username)
+	if handedOff {
+		log.Info("Session handed off", "user", handed.User, "remote", s.RemoteAddr())
+		username = handed.User
+	}
+
+	// Guests all share one name, so they can't read or write anyone's saved data
+	guest := isGuest(s.Context()) && !handedOff
+	if guest {
+		username = "guest"
+	}
+
+	// Key holders have a profile, its name is what the app calls them
+	name := username
+	profile, hasProfile := user.FromContext(s.Context())
+	if hasProfile {
+		name = user.CleanName(profile.Name)
+	}
+	if handedOff {
+		name = handed.Name
+	}
+
+	// The prompt text comes from the content directory in the client's language
+	text, placeholder := loadPrompt(sessionLocale(s), name)
+
+	// Only a key gets a picture, a name alone is anyone's to claim
+	var drawn string
+	if s.PublicKey() != nil {
+		drawn = fingerprint(s)
+	}
+
+	setup := sessionSetup{
+		User:        username,
+		Name:        name,
+		Locale:      sessionLocale(s),
+		Prompt:      text,
+		Placeholder: placeholder,
+		Avatar:      avatar.Generate(drawn),
+		Addr:        s.LocalAddr().String(),
+		// Clients that probably can't draw emoji get text fallbacks like ":)" instead
+		EmojiFallback: !emoji.Supported(sessionLocale(s), pty.Term),
+		Hyperlinks:    hyperlink.Supported(pty.Term, s.Environ()),
+		Inline:        inline,
+		Width:         pty.Window.Width,
+		Height:        pty.Window.Height,
+		Guest:         guest,
+		Warming:       !warm.ready(),
+		Started:       time.Now(),
+	}
+	slot := slotFromContext(s.Context())
+	setup.Queued = slot != nil && !slot.isAdmitted()
+	// Users must accept the current Terms of Service before they can use the app
+	// If we can't read the acceptance file, ask again rather than let them through
+	accepted, err := tosStore.Current(username)
+	if err != nil {
+		log.Error("Could not read ToS acceptances", "error", err)
+	}
+	setup.NeedsTOS = !accepted || guest
+	// Users are asked once whether they want to be counted
+	// If we can't read their answer, don't ask and don't count them
+	if usage.Enabled() && !guest {
+		decision, decided, err := usageConsents.Get(username)
+		if err != nil {
+			log.Error("Could not read telemetry consents", "error", err)
+		}
+		setup.AskUsage = !decided && err == nil
+		setup.ShareUsage = decided && decision.Allowed
+	}
+	if hasProfile {
+		// A handoff was already let in by the session it came from
+		setup.NeedsTOTP = profile.TOTP != "" && !handedOff
+		setup.Fingerprint = profile.Fingerprint
+		setup.Accent = profile.Prefs.Accent
+		setup.Prefs, setup.ProfileVersion = profile.Prefs, profile.Version
+	}
+	setup.TimeZone = sessionZone(s, profile.Prefs.TimeZone)
+	if handedOff {
+		// The profile is the original session's, not the new device's
+		setup.Name = handed.Name
+		setup.Fingerprint = handed.Fingerprint
+		setup.Accent = handed.Accent
+		setup.Avatar = handed.Avatar
+		setup.Input = handed.Input
+		// Saves from here are checked against the profile as it is now
+		if p, ok, err := userStore.Get(handed.Fingerprint); err == nil && ok {
+			setup.Prefs, setup.ProfileVersion = p.Prefs, p.Version
+		}
+	}
+
+	m, opts := startApp(s, setup)
+	if setup.Queued {
+		m.slot = slot
+		m.place = limiter.place(slot)
+	}
+	return m, opts
+}
+
+// startApp builds the app's model for the session from setup,
+// hooked up to the registry, the drainer and the debugging tools
+func startApp(s ssh.Session, setup sessionSetup) (model, []tea.ProgramOption) {
+	m := setup.model(bubbletea.MakeRenderer(s))
+	m.banner = currentBanner()
+	m.sessionRecorded = isRecorded(s)
+	if timeTravel {
+		m.timeline = newTimeline()
+	}
+	if messageLogDir != "" {
+		m.messages = openMessageLog(s.Context(), setup)
+	}
+	m.done = s.Context().Done()
+	// Admins viewing as someone don't make them online
+	if setup.Impersonator == "" {
+		m.online = online.Join(presenceKey(s, setup), m.done)
+	}
+	m.conn = sessions.FromContext(s.Context())
+	m.conn.SetUser(setup.User)
+	m.trail = sessionlog.FromContext(s.Context())
+	if live, ok := s.Context().Value(liveSessionKey{}).(*liveSession); ok {
+		m.live = live
+		m.live.track(m.kind(), m.busy())
+	}
+
+	// WithoutSignalHandler stops every program from quitting on the server's own SIGTERM,
+	// shutdown is handled by the drainer instead
+	opts := []tea.ProgramOption{tea.WithoutSignalHandler()}
+	if !m.inline {
+		// WithAltScreen makes the app take over the entire terminal screen
+		// Similar to how terminal.shop creates a full-screen experience
+		opts = append(opts, tea.WithAltScreen())
+	}
+	return m, opts
 }
 
 // Model represents the state of the entire app (following Elm architecture)
 // Bubble Tea is immutable - we update by returning a new model with changes
 type model struct {
 	// payload string
-	// Using a pre-built text input component from Bubbles (component library)
-	// The text input has its own update, view, and init methods
-	ti textinput.Model // text input model will have its own view, method, and etc methods
+	// form asks for a name, an email and a favorite coffee, see fields.go
+	// Each field is a text input from Bubbles (component library), with its own update and view
+	// The name's label is the prompt rendered from the content templates
+	form form.Model
+	// locale picks which template, and is kept to render it again when the content changes
+	locale string
+	// counter styles the live character count under the input
+	counter counterStyles
+	// err is shown under the input when a submission is rejected
+	err string
+	// saving is true while a confirmed submission is being saved, so it isn't saved twice
+	saving bool
+
+	// user is the SSH username of the connected client
+	// name is what the app calls them, from their profile when they have one
+	// fingerprint identifies their profile, empty for sessions without a key
+	user        string
+	name        string
+	fingerprint string
+	// prefs and profileVersion are the profile as this session last loaded or saved it,
+	// so saves can tell when another session got there first, see prefs.go
+	prefs          user.Prefs
+	profileVersion int
+	// needsTOTP is true until users with a second factor give the code from
+	// their authenticator app, nothing else works until then, see totp.go
+	needsTOTP bool
+	totp      totpPrompt
+	// needsTOS is true until the user accepts the current Terms of Service
+	// While it's set, every message goes to the tos screen instead of the text input
+	needsTOS bool
+	tos      tos.Model
+
+	// askUsage shows the telemetry consent screen, after the ToS and before the app
+	// shareUsage is the user's answer, nothing is counted unless it's true
+	askUsage   bool
+	shareUsage bool
+	consent    telemetry.ConsentModel
+
+	// picking is true while the emoji picker is open over the input
+	// The picker is kept between openings so its recently used list lasts the session
+	picking bool
+	picker  emoji.Model
+
+	// choosingColor is true while the color picker is open
+	// The color picked becomes the accent of the session's theme
+	choosingColor bool
+	colors        colorpick.Model
+	accent        lipgloss.Color
+	theme         theme.Theme
+
+	// recording is true while keystrokes are being recorded into recorded
+	// ctrl+r starts and stops recording, ctrl+p plays the saved macro back
+	recording bool
+	recorded  []tea.Key
+	// playing is true from ctrl+p until the macro's last key has been handled
+	playing bool
+	// savingMacro is true from the end of a recording until it's saved
+	savingMacro bool
+
+	// sessionRecorded is true when --record-sessions is recording the session, which it says on every screen
+	sessionRecorded bool
+
+	// links is true when the client's terminal draws OSC 8 hyperlinks, see hyperlink
+	links bool
+
+	// inline is true when running without the alt screen
+	// Rejected and saved submissions are then printed above the app, into the
+	// terminal's scrollback, so the user can scroll back through them natively
+	inline bool
+
+	// locked hides the screen after lockAfter without a keypress, see lock.go
+	locked     bool
+	lastActive time.Time
+	// idleWarned shows the warning that the session is about to close, see idle.go
+	idleWarned bool
+
+	// handoff is the QR code screen for moving to another device, empty when not showing
+	// addr is where this session connected to, which the QR code points at
+	handoff string
+	addr    string
+
+	// nav holds the screens open over the input, like the welcome and confirmation screens
+	// Each screen pushes the next or pops itself, see the screens package
+	nav screens.Stack
+
+	// warming is true while the server is still getting ready, see warmup.go
+	warming bool
+
+	// queued is true while the session waits for a place under --max-sessions, see limit.go
+	// place is its position in the queue, slot is what it waits on, nil in replays
+	queued bool
+	place  int
+	slot   *sessionSlot
+
+	// guest is true for clients let in without a registered key, see guest.go
+	// upgrade shows how to register a key, guests see it when they try to save anything
+	guest   bool
+	upgrade bool
+
+	// avatar is block art drawn from the user's key fingerprint
+	avatar string
+
+	// messages logs what the session handles for later replay, nil unless --record-messages
+	messages *messageLog
+
+	// done is closed when the session ends, anything the session joined leaves with it
+	done <-chan struct{}
+	// online is how many users are in the app, kept current by pushes from presence
+	online presence.Online
+
+	// timeline records the session's history for the f12 developer page, nil unless --time-travel
+	timeline *timeline
+
+	// width and height are the terminal's, screens are centered and wrapped to fit, see layout
+	width  int
+	height int
+
+	// banner is the latest announcement sent to every session, see broadcast
+	// bannerAt is when it was sent, zero for live ones like the shutdown countdown
+	banner   string
+	bannerAt time.Time
+
+	// format writes numbers and times for the user's locale and time zone, see l10n
+	// zoneName is the zone as the user knows it, see timezone.go for where it comes from
+	format   l10n.Formatter
+	zoneName string
+
+	// impersonator is the admin viewing the app as user, empty in normal sessions
+	// They can't save anything while readOnly, and the session ends at impersonateUntil
+	// See impersonate.go
+	impersonator     string
+	readOnly         bool
+	impersonateUntil time.Time
+
+	// live is shared with the shutdown drainer, nil when not running under it
+	live *liveSession
+	// conn is the session's entry in connected, nil when not registered
+	conn *sessions.Handle
+	// trail is the session's structured log, nil when it isn't logged
+	trail *sessionlog.Session
+}
+
+// sessionSetup is everything a new session's model is built from
+// It's saved at the top of message logs so replay can build the same model, see messagelog.go
+type sessionSetup struct {
+	User          string    `json:"user"`
+	Name          string    `json:"name"`
+	Fingerprint   string    `json:"fingerprint"`
+	Accent        string    `json:"accent"`
+	TimeZone      string    `json:"time_zone"`
+	Locale        string    `json:"locale"`
+	Prompt        string    `json:"prompt"`
+	Placeholder   string    `json:"placeholder"`
+	Input         string    `json:"input"`
+	Avatar        string    `json:"avatar"`
+	Addr          string    `json:"addr"`
+	NeedsTOTP     bool      `json:"needs_totp"`
+	NeedsTOS      bool      `json:"needs_tos"`
+	AskUsage      bool      `json:"ask_usage"`
+	ShareUsage    bool      `json:"share_usage"`
+	EmojiFallback bool      `json:"emoji_fallback"`
+	Hyperlinks    bool      `json:"hyperlinks"`
+	Guest         bool      `json:"guest"`
+	Warming       bool      `json:"warming"`
+	Queued        bool      `json:"queued"`
+	Inline        bool      `json:"inline"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	Started       time.Time `json:"started"`
+	// Prefs and ProfileVersion are the saved profile's, for spotting saves from other sessions
+	Prefs          user.Prefs `json:"prefs"`
+	ProfileVersion int        `json:"profile_version"`
+	// Impersonator, ReadOnly and ImpersonateUntil are set when an admin views the app as User
+	Impersonator     string    `json:"impersonator,omitempty"`
+	ReadOnly         bool      `json:"read_only,omitempty"`
+	ImpersonateUntil time.Time `json:"impersonate_until,omitzero"`
+}
+
+// model builds the session's model, styled for the renderer r
+func (c sessionSetup) model(r *lipgloss.Renderer) model {
+	m := initialModel(c.User, c.Prompt, c.Placeholder)
+	m.locale = c.Locale
+	m.name = c.Name
+	m.fingerprint = c.Fingerprint
+	m.prefs, m.profileVersion = c.Prefs, c.ProfileVersion
+	// A handoff carries on with the name typed so far
+	m.form = m.form.SetValue(fieldName, c.Input)
+	m.avatar = c.Avatar
+	m.addr = c.Addr
+	m.needsTOTP = c.NeedsTOTP
+	m.totp = newTOTPPrompt()
+	m.needsTOS = c.NeedsTOS
+	m.links = c.Hyperlinks
+	m.tos = m.tos.WithLinks(c.Hyperlinks)
+	m.askUsage = c.AskUsage
+	m.shareUsage = c.ShareUsage
+	m.picker = emoji.New(r, c.EmojiFallback)
+	m.colors = colorpick.New(r)
+	m.accent = lipgloss.Color(c.Accent)
+	m.theme = theme.New(r, c.Accent)
+	m.counter = newCounterStyles(m.theme)
+	m.form = m.form.WithStyles(formStyles(m.theme))
+	m.inline = c.Inline
+	m.width, m.height = c.Width, c.Height
+	if c.Width > 0 {
+		m.form = m.form.SetWidth(inputWidth(c.Width))
+	}
+	m.zoneName = c.TimeZone
+	m.format = l10n.New(c.Locale, loadZone(c.TimeZone))
+	m.guest = c.Guest
+	m.warming = c.Warming
+	m.queued = c.Queued
+	// Handoffs carry on from the other device, so they skip the greeting and the menu
+	if c.Input == "" {
+		m.nav = screens.New(m.newMenu(), screens.NewWelcome(c.Name, c.Avatar, m.theme.Name))
+	}
+	m.impersonator = c.Impersonator
+	m.readOnly = c.ReadOnly
+	m.impersonateUntil = c.ImpersonateUntil
+	m.lastActive = c.Started
+	return m
+}
+
+// inputWidth is how wide the text input is on a width column terminal,
+// it shrinks on narrow ones so the prompt never wraps mid-input
+func inputWidth(width int) int {
+	return max(min(20, width-8), 1)
 }
 
 // Constructor for creating the initial model state
-func initialModel() model {
-	ti := textinput.New()
-	// Focus is important - without it, the text input won't respond to typing
-	// Multiple text inputs can exist, but only the focused one receives input
-	ti.Focus()
-	ti.Placeholder = "Jae C"
-	// Width must be set for placeholder to display correctly
-	ti.Width = 20
+func initialModel(user, prompt, placeholder string) model {
 	return model{
-		ti,
+		// The prompt from the content directory asks for the name, see fields.go
+		form: newForm(prompt, placeholder),
+		user: user,
+		tos:  tos.New(),
 	}
 
 }
 
+// sessionLocale returns the client's locale from the environment it sent
+// OpenSSH forwards LANG and LC_* by default (SendEnv in ssh_config)
+func sessionLocale(s ssh.Session) string {
+	env := map[string]string{}
+	for _, kv := range s.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	// Same precedence as the C library uses for messages
+	for _, k := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := env[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// fingerprint identifies the client, e.g. to own idempotency keys and submissions
+// Sessions that didn't authenticate with a key fall back to the username,
+// prefixed so a client can't pass itself off as a key by calling itself SHA256:...
+func fingerprint(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return "user:" + s.User()
+}
+
+// owner is who the user's submissions and macro belong to, their key as fingerprint gives it
+func (m model) owner() string {
+	if m.fingerprint != "" {
+		return m.fingerprint
+	}
+	return "user:" + m.user
+}
+
 /* --------------------------------------------------------- */
 
 // Init is automatically called by Bubble Tea when the program starts
@@ -123,22 +1104,145 @@ func initialModel() model {
 func (m model) Init() tea.Cmd {
 	// Blink command makes the cursor start blinking immediately
 	// Without this, cursor would be static until first keystroke
-	return textinput.Blink
+	// It also starts listening for content changes so the prompt can be refreshed
+	cmds := []tea.Cmd{textinput.Blink, waitForContent(content.wait())}
+	if m.live != nil {
+		// Also wait in the background for the server to drain this session
+		cmds = append(cmds, waitForDrain(m.live))
+	}
+	if lockAfter > 0 {
+		cmds = append(cmds, lockTick(lockAfter))
+	}
+	if idleTimeout > 0 {
+		cmds = append(cmds, idleTick(max(idleTimeout-idleWarning, 0)))
+	}
+	if m.warming {
+		cmds = append(cmds, waitForWarm(warm))
+	}
+	if m.queued && m.slot != nil {
+		cmds = append(cmds, waitForSlot(m.slot), queueTick(m.slot))
+	}
+	if m.impersonator != "" {
+		cmds = append(cmds, impersonationTimer(m.impersonateUntil.Sub(now())))
+	}
+	return tea.Batch(cmds...)
 }
 
 // Update is the event handler - called automatically when messages (events) occur
 // This is not a pointer receiver, so changes aren't persisted unless returned
 // Similar to React's immutable state updates
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// While time traveling, keys step through history instead of reaching the app
+	if m.updateTimeline(msg) {
+		return m, nil
+	}
+	m.messages.write(msg)
+	next, cmd := m.update(msg)
+	if next.timeline != nil {
+		next.timeline.record(msg, next)
+	}
+	// Let the shutdown drain know what this session is doing
+	if next.live != nil {
+		next.live.track(next.kind(), next.busy())
+	}
+	return next, cmd
+}
+
+// update does the actual message handling for Update
+func (m model) update(msg tea.Msg) (model, tea.Cmd) {
 	// this method returns tea.Model beacuause this is not a pointer/receiver
 	// any changes made to m model will not persist outside of this method scope because it's passed by copy
 	// this meathod is like an event handler (pub/sub ood pattern) where it listens for events (in the form of t.message)
 	// return m, nil
 
+	// The server is shutting down and the drain policy says this session is done
+	if _, ok := msg.(drainMsg); ok {
+		return m, tea.Quit
+	}
+
+	// The content directory changed, render the prompt again and wait for the next change
+	if _, ok := msg.(contentMsg); ok {
+		prompt, placeholder := loadPrompt(m.locale, m.name)
+		m.form = m.form.SetLabel(fieldName, prompt).SetPlaceholder(fieldName, placeholder)
+		return m, waitForContent(content.wait())
+	}
+
+	if msg, ok := msg.(lockMsg); ok {
+		return m.checkLock(msg)
+	}
+	if msg, ok := msg.(idleMsg); ok {
+		return m.checkIdle(msg)
+	}
+	if _, ok := msg.(warmedMsg); ok {
+		m.warming = false
+		return m, nil
+	}
+	if msg, ok := msg.(queueMsg); ok {
+		if !m.queued {
+			return m, nil
+		}
+		m.place = msg.Place
+		if m.slot == nil {
+			return m, nil
+		}
+		return m, queueTick(m.slot)
+	}
+	if _, ok := msg.(impersonationOverMsg); ok {
+		return m, tea.Quit
+	}
+	if _, ok := msg.(admittedMsg); ok {
+		// Time spent in the queue doesn't count as idle
+		m.queued = false
+		m.lastActive = now()
+		return m, nil
+	}
+
+	if msg, ok := msg.(presence.Online); ok {
+		if msg.Seq > m.online.Seq {
+			m.online = msg
+		}
+		return m, nil
+	}
+
+	if _, ok := msg.(macro.DoneMsg); ok {
+		m.playing = false
+		return m, nil
+	}
+
+	// Storage runs in commands, these are what they came back with
+	if msg, ok := msg.(savedMsg); ok {
+		return m.saved(msg)
+	}
+	if msg, ok := msg.(macroSavedMsg); ok {
+		return m.macroSaved(msg), nil
+	}
+	if msg, ok := msg.(trashedMsg); ok {
+		return m.trashed(msg)
+	}
+	if msg, ok := msg.(prefSavedMsg); ok {
+		return m.prefSaved(msg), nil
+	}
+
+	if msg, ok := msg.(broadcast.Banner); ok {
+		m.banner = msg.Text
+		m.bannerAt = msg.At
+		return m, nil
+	}
+
+	// Keep the registry's window size current, the screens still need the message too
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		m.conn.Resize(msg.Width, msg.Height)
+		m.trail.Log("resize", "width", msg.Width, "height", msg.Height)
+		m.width, m.height = msg.Width, msg.Height
+		m.form = m.form.SetWidth(inputWidth(msg.Width))
+	}
+
 	// Type assertion to check if the message is a keyboard event
 	if val, ok := msg.(tea.KeyMsg); ok {
 		// String() method returns string representation of the key pressed
 		key := val.String()
+		// Any keypress clears the last error, enter sets it again if needed
+		m.err = ""
 		// os.WriteFile("output.log", []byte(key), 0644)
 
 		// Without handling ctrl+c, the app becomes unresponsive
@@ -147,31 +1251,541 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// tea.Quit tells Bubble Tea to stop the application
 			return m, tea.Quit
 		}
-		if key == "enter" {
-			// save to file
-			// ti.Value() gets the current text from the input field
-			// 0644 is octal file permission: read/write for owner, read for group/others
-			os.WriteFile("output.log", []byte(m.ti.Value()), 0644)
-			return m, tea.Quit
+		m.lastActive = now()
+		// Nothing works until the server is ready and the session has a place
+		if m.warming || m.queued {
+			return m, nil
+		}
+		// The key that answers the idle warning does nothing else
+		if m.idleWarned {
+			m.idleWarned = false
+			return m, nil
+		}
+		// While locked, the key that resumes the session does nothing else
+		if m.locked {
+			m.locked = false
+			return m, nil
+		}
+		if m.needsTOTP {
+			return m.updateTOTP(msg)
+		}
+		// Any key closes the handoff and upgrade screens
+		if m.handoff != "" || m.upgrade {
+			m.handoff = ""
+			m.upgrade = false
+			return m, nil
+		}
+		// Impersonating admins can't hand the session off, or save while read-only
+		if reason := m.blockedWhileImpersonating(key); reason != "" {
+			m.err = reason
+			m.audit("impersonate.blocked", key)
+			return m, nil
+		}
+		// Guests get the upgrade screen instead of anything that saves,
+		// ctrl+g shows it whenever they like
+		if m.guest && m.onPrompt() && slices.Contains([]string{"ctrl+g", "enter", "ctrl+o", "ctrl+r", "ctrl+p", "ctrl+y", "ctrl+b"}, key) {
+			m.upgrade = true
+			m.count("screen.upgrade")
+			return m, nil
+		}
+		// Macros are kept per user, guests can't record or play one whatever's showing
+		if m.guest && (key == "ctrl+r" || key == "ctrl+p") {
+			return m, nil
+		}
+		// ctrl+o shows a QR code that continues this session on another device
+		if key == "ctrl+o" && m.onPrompt() {
+			m.count("screen.handoff")
+			return m.showHandoff(), nil
+		}
+		// ctrl+y asks about telemetry again, so users can change their mind
+		if key == "ctrl+y" && m.onPrompt() && usage.Enabled() {
+			m.askUsage = true
+			return m, nil
+		}
+		if key == "ctrl+r" {
+			return m.toggleRecording()
+		}
+		// ctrl+p while recording or playing does nothing, see macro.Controls,
+		// nor before the last recording is saved, it would play the one before
+		if key == "ctrl+p" && (m.recording || m.playing || m.savingMacro) {
+			return m, nil
+		}
+		if key == "ctrl+p" {
+			keys, err := macroStore.Get(m.owner())
+			if err != nil {
+				log.Error("Could not load macro", "user", m.user, "error", err)
+				m.err = "could not load your macro"
+				return m, nil
+			}
+			m.count("feature.macro-played")
+			m.playing = len(keys) > 0
+			return m, macro.Play(keys)
+		}
+		if m.recording && len(m.recorded) < macro.MaxKeys {
+			m.recorded = append(m.recorded, tea.Key(val))
+		}
+		// ctrl+e opens the emoji picker, which inserts at the cursor
+		if key == "ctrl+e" && m.onPrompt() {
+			m.picking = true
+			m.count("screen.emoji")
+			var cmd tea.Cmd
+			m.picker, cmd = m.picker.Open()
+			return m, cmd
+		}
+		// ctrl+t opens the color picker to change the theme's accent color
+		if key == "ctrl+t" && m.onPrompt() {
+			m.choosingColor = true
+			m.count("screen.colors")
+			m.colors = m.colors.Open(m.accent)
+			return m, nil
+		}
+		// ctrl+b lists the user's submissions, to move them to the trash and back
+		if key == "ctrl+b" && m.onPrompt() {
+			return m.openSubmissions()
+		}
+		// esc goes back to the main menu, what's typed stays in the form
+		if key == "esc" && m.onPrompt() {
+			m.nav = m.nav.Push(m.newMenu())
+			return m, nil
+		}
+		// ctrl+z changes the time zone times are shown in
+		if key == "ctrl+z" && m.onPrompt() {
+			m.count("screen.timezone")
+			m.nav = m.nav.Push(screens.NewTimeZone(m.zoneName))
+			return m, textinput.Blink
+		}
+		// enter on the last field checks the form and asks for confirmation before saving it,
+		// on the others it goes to the next field
+		if key == "enter" && m.onPrompt() && m.form.Last() {
+			var ok bool
+			if m.form, ok = m.form.Submit(); !ok {
+				return m, m.scrollback("✗ %s", strings.Join(m.form.Errors(), "; "))
+			}
+			m.nav = m.nav.Push(screens.NewConfirm(m.form.Labels(), m.form.Values()))
+			return m, nil
 		}
 	}
 
-	// Pass the message to the text input component for processing
-	// The text input returns its updated model and any commands
+	if val, ok := msg.(screens.ConfirmedMsg); ok {
+		return m.submit(val.Values)
+	}
+	if val, ok := msg.(screens.MenuMsg); ok {
+		return m.choose(val.Item)
+	}
+	if val, ok := msg.(screens.PageMsg); ok {
+		return m, loadPage(val.Top, val.Page)
+	}
+	if val, ok := msg.(screens.TimeZoneMsg); ok {
+		return m.setZone(val.Name)
+	}
+	if val, ok := msg.(screens.ResolvedMsg); ok {
+		return m.resolvePref(val)
+	}
+	if val, ok := msg.(screens.DeleteMsg); ok {
+		return m.deleteSubmission(val.ID)
+	}
+	if val, ok := msg.(screens.RestoreMsg); ok {
+		return m.restoreSubmission(val.ID)
+	}
+
+	if m.needsTOTP {
+		return m.updateTOTP(msg)
+	}
+	if m.needsTOS {
+		return m.updateTOS(msg)
+	}
+	if m.askUsage {
+		return m.updateConsent(msg)
+	}
+	if m.picking {
+		return m.updatePicker(msg)
+	}
+	if m.choosingColor {
+		return m.updateColors(msg)
+	}
+	if !m.nav.Empty() {
+		return m.updateNav(msg)
+	}
+
+	// Pass the message to the form, which moves between fields on tab
+	// and hands everything else to the focused text input
 	var cmd tea.Cmd
-	m.ti, cmd = m.ti.Update(msg)
+	m.form, cmd = m.form.Update(msg)
 
-	// Return the updated model with the new text input state
-	// Commands from text input are forwarded to Bubble Tea
+	// Return the updated model with the new form state
+	// Commands from the form are forwarded to Bubble Tea
 	return m, cmd
 }
 
 // View renders the UI - returns a string that appears in the terminal
 // Called automatically whenever the model changes
 func (m model) View() string {
+	view := m.frame()
+	// Admins viewing as someone else always see that they are, see impersonate.go
+	if m.impersonator != "" {
+		view = m.impersonationView() + "\n\n" + layout.ClipTop(view, m.height-2)
+	}
+	view = layout.Fit(view, m.width)
+	// Inline sessions share the terminal with the shell, so they only centre across
+	if m.inline {
+		return layout.CenterHorizontally(view, m.width)
+	}
+	return layout.Center(view, m.width, m.height)
+}
+
+// frame renders whatever the session is showing for View
+func (m model) frame() string {
+	if m.timeline.traveling() {
+		return m.timelineView()
+	}
+	if m.warming {
+		return warmingView()
+	}
+	if m.queued {
+		return queueView(m.format, m.place)
+	}
+	if m.idleWarned {
+		return idleView()
+	}
+	if m.locked {
+		return lockView()
+	}
+	if m.needsTOTP {
+		return m.totpView()
+	}
+	view := m.view()
+	if m.recording {
+		view += fmt.Sprintf("\n\n● recording macro, %d keys (ctrl+r to stop)", len(m.recorded))
+	}
+	if m.online.Users > 0 {
+		view += "\n\n" + m.onlineView()
+	}
+	if m.sessionRecorded {
+		view += "\n\n" + m.theme.Hint.Render("● this session is recorded")
+	}
+	// Announcements go above whatever screen is showing
+	if m.banner != "" {
+		banner := m.theme.Banner.Render(m.banner)
+		if !m.bannerAt.IsZero() {
+			banner += "\n" + m.theme.Hint.Render(m.format.When(m.bannerAt, now()))
+		}
+		view = banner + "\n\n" + view
+	}
+	return view
+}
+
+// view renders the current screen for View
+func (m model) view() string {
+	if m.needsTOS {
+		return m.tos.View()
+	}
+	if m.askUsage {
+		return m.consent.View()
+	}
+	if m.handoff != "" {
+		return m.handoff
+	}
+	if m.upgrade {
+		return m.upgradeView()
+	}
+	if m.picking {
+		return m.picker.View()
+	}
+	if m.choosingColor {
+		return m.colors.View()
+	}
+	if !m.nav.Empty() {
+		return m.nav.View()
+	}
 	// return m.payload
-	// return m.ti.View()
-	// fmt.Sprintf creates a formatted string with the prompt and input field
-	output := fmt.Sprintf("Name?\n\n%v", m.ti.View())
+	// fmt.Sprintf creates a formatted string with the form and the focused field's counter
+	focused := m.form.Focused()
+	output := fmt.Sprintf("%s\n\n%s\n\n%s", m.avatar, m.form.View(),
+		m.counter.render(m.format, utf8.RuneCountInString(focused.Value()), focused.CharLimit))
+	if m.err != "" {
+		output += "\n\n" + m.theme.Error.Render(layout.Wrap(m.err, m.width))
+	}
+	if m.guest {
+		output += "\n\n" + m.theme.Hint.Render(layout.Wrap("browsing as a guest • ctrl+g to register a key", m.width))
+	}
 	return output
 }
+
+// updateNav handles messages while a screen is open over the input
+func (m model) updateNav(msg tea.Msg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+	m.nav, cmd = m.nav.Update(msg)
+	// The input's cursor stopped blinking while it was covered
+	if m.nav.Empty() {
+		return m, tea.Batch(cmd, textinput.Blink)
+	}
+	return m, cmd
+}
+
+// submit saves the confirmed form values, see saved for what happens next
+func (m model) submit(values []string) (model, tea.Cmd) {
+	if m.saving {
+		return m, nil
+	}
+	m.saving = true
+	return m, saveSubmission(storage.Submission{
+		User:   m.user,
+		Owner:  m.owner(),
+		Value:  values[fieldName],
+		Email:  values[fieldEmail],
+		Coffee: values[fieldCoffee],
+	})
+}
+
+// savedMsg is what saving a submission came to
+type savedMsg struct {
+	Submission storage.Submission
+	Failed     bool
+}
+
+// saveSubmission saves sub to the database, with its notifications
+func saveSubmission(sub storage.Submission) tea.Cmd {
+	return func() tea.Msg {
+		chaos.slowStorage()
+		if _, err := submissionStore.Save(sub, notifications); err != nil {
+			log.Error("Could not save submission", "user", sub.User, "error", err)
+			return savedMsg{Submission: sub, Failed: true}
+		}
+		return savedMsg{Submission: sub}
+	}
+}
+
+// saved ends the session once the submission is saved
+func (m model) saved(msg savedMsg) (model, tea.Cmd) {
+	m.saving = false
+	sub := msg.Submission
+	if msg.Failed {
+		m.err = "couldn't save that, please try again"
+		return m, m.scrollback("✗ %q: %s", sub.Value, m.err)
+	}
+	m.count("feature.submitted")
+	notifier.Wake()
+	// The values stay in the database, the log only says a submission happened
+	m.trail.Log("submit", "user", m.user, "length", utf8.RuneCountInString(sub.Value))
+	m.audit("impersonate.submitted", strings.Join([]string{sub.Value, sub.Email, sub.Coffee}, ", "))
+	saved := m.scrollback("✓ saved %q at %s, your %s is on its way", sub.Value, m.format.Time(now()), sub.Coffee)
+	if receiptsDelayed() {
+		saved = tea.Sequence(saved, m.scrollback("  email is down for the moment, your receipt will follow"))
+	}
+	return m, tea.Sequence(saved, tea.Quit)
+}
+
+// setZone shows times in the named zone from now on
+// Key holders keep it for next time, guests only for this session
+func (m model) setZone(name string) (model, tea.Cmd) {
+	m = m.applyZone(name)
+	m.count("feature.timezone-set")
+	if m.fingerprint != "" && !m.guest {
+		m.audit("impersonate.set-timezone", name)
+	}
+	return m.savePref(zonePref, name)
+}
+
+// updateTOS handles messages while the Terms of Service screen is showing
+func (m model) updateTOS(msg tea.Msg) (model, tea.Cmd) {
+	if val, ok := msg.(tos.AcceptedMsg); ok {
+		// A guest's acceptance only lasts the session, they have no identity to save it against
+		// Nor does a read-only admin's, it's up to the user to accept
+		var save tea.Cmd
+		if !m.guest && !m.readOnly {
+			user, at := m.user, now()
+			save = func() tea.Msg {
+				chaos.slowStorage()
+				if err := tosStore.Accept(user, val.Version, at); err != nil {
+					log.Error("Could not save ToS acceptance", "user", user, "error", err)
+				}
+				return nil
+			}
+			m.audit("impersonate.accepted-tos", val.Version)
+		}
+		m.needsTOS = false
+		return m, tea.Batch(save, textinput.Blink)
+	}
+
+	var cmd tea.Cmd
+	m.tos, cmd = m.tos.Update(msg)
+	return m, cmd
+}
+
+// showHandoff issues a handoff token for this session and shows it as a QR code
+func (m model) showHandoff() model {
+	token, err := handoffs.Issue(handoff.State{
+		User:        m.user,
+		Input:       m.form.Values()[fieldName],
+		Avatar:      m.avatar,
+		Name:        m.name,
+		Fingerprint: m.fingerprint,
+		Accent:      string(m.accent),
+	})
+	if err != nil {
+		log.Error("Could not issue handoff token", "user", m.user, "error", err)
+		m.err = "could not start a handoff"
+		return m
+	}
+	code, err := handoff.QR(token, m.addr)
+	if err != nil {
+		log.Error("Could not draw handoff QR code", "user", m.user, "error", err)
+		m.err = "could not start a handoff"
+		return m
+	}
+	m.handoff = fmt.Sprintf("%s\nscan to continue on another device, or connect as %s\nvalid once, for %s • any key to close",
+		code, token, handoffs.TTL())
+	return m
+}
+
+// scrollback prints a line above the app when running inline
+// With the alt screen there is no scrollback to add to, so it does nothing
+func (m model) scrollback(format string, args ...any) tea.Cmd {
+	if !m.inline {
+		return nil
+	}
+	return tea.Printf(format, args...)
+}
+
+// toggleRecording starts a new macro recording, or stops and saves the current one
+// Stopping with nothing recorded deletes the saved macro
+func (m model) toggleRecording() (model, tea.Cmd) {
+	if !m.recording {
+		m.recording = true
+		m.recorded = nil
+		return m, nil
+	}
+	m.recording = false
+	m.savingMacro = true
+	user, owner, keys := m.user, m.owner(), m.recorded
+	return m, func() tea.Msg {
+		chaos.slowStorage()
+		if err := macroStore.Save(owner, keys); err != nil {
+			log.Error("Could not save macro", "user", user, "error", err)
+			return macroSavedMsg{Failed: true}
+		}
+		return macroSavedMsg{Keys: len(keys)}
+	}
+}
+
+// macroSavedMsg is what saving a recorded macro came to
+type macroSavedMsg struct {
+	Keys   int
+	Failed bool
+}
+
+// macroSaved finishes toggleRecording once the macro is saved
+func (m model) macroSaved(msg macroSavedMsg) model {
+	m.savingMacro = false
+	if msg.Failed {
+		m.err = "could not save your macro"
+		return m
+	}
+	m.count("feature.macro-recorded")
+	m.audit("impersonate.recorded-macro", fmt.Sprintf("%d keys", msg.Keys))
+	return m
+}
+
+// updateConsent handles messages while the telemetry consent screen is showing
+func (m model) updateConsent(msg tea.Msg) (model, tea.Cmd) {
+	if val, ok := msg.(telemetry.DecidedMsg); ok {
+		user, at := m.user, now()
+		save := func() tea.Msg {
+			chaos.slowStorage()
+			if err := usageConsents.Decide(user, val.Allowed, at); err != nil {
+				log.Error("Could not save telemetry consent", "user", user, "error", err)
+			}
+			return nil
+		}
+		m.askUsage = false
+		m.shareUsage = val.Allowed
+		return m, tea.Batch(save, textinput.Blink)
+	}
+
+	var cmd tea.Cmd
+	m.consent, cmd = m.consent.Update(msg)
+	return m, cmd
+}
+
+// count records a usage event, only for users who agreed to share usage
+func (m model) count(event string) {
+	if m.shareUsage {
+		usage.Count(event)
+	}
+}
+
+// onPrompt reports whether the prompt screen is showing rather than something over it
+func (m model) onPrompt() bool {
+	return !m.needsTOS && !m.askUsage && !m.picking && !m.choosingColor && m.nav.Empty()
+}
+
+// updatePicker handles messages while the emoji picker is open
+func (m model) updatePicker(msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case emoji.PickedMsg:
+		m.picking = false
+		m.count("feature.emoji-picked")
+		m.insert(msg.Text)
+		return m, textinput.Blink
+	case emoji.ClosedMsg:
+		m.picking = false
+		return m, textinput.Blink
+	}
+
+	var cmd tea.Cmd
+	m.picker, cmd = m.picker.Update(msg)
+	return m, cmd
+}
+
+// updateColors handles messages while the color picker is open
+func (m model) updateColors(msg tea.Msg) (model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case colorpick.PickedMsg:
+		m.choosingColor = false
+		m.count("feature.color-picked")
+		m = m.applyAccent(string(msg.Color))
+		// Key holders keep their accent color for next time
+		if m.fingerprint != "" {
+			m.audit("impersonate.set-accent", string(m.accent))
+		}
+		var cmd tea.Cmd
+		m, cmd = m.savePref(accentPref, string(m.accent))
+		return m, tea.Batch(cmd, textinput.Blink)
+	case colorpick.ClosedMsg:
+		m.choosingColor = false
+		return m, textinput.Blink
+	}
+
+	var cmd tea.Cmd
+	m.colors, cmd = m.colors.Update(msg)
+	return m, cmd
+}
+
+// insert puts text at the focused input's cursor, unless it would go past the length limit
+func (m *model) insert(text string) {
+	ti := m.form.Focused()
+	value := []rune(ti.Value())
+	pos := ti.Position()
+	if ti.CharLimit > 0 && len(value)+utf8.RuneCountInString(text) > ti.CharLimit {
+		m.err = "no room left for that"
+		return
+	}
+	ti.SetValue(string(value[:pos]) + text + string(value[pos:]))
+	ti.SetCursor(pos + utf8.RuneCountInString(text))
+	m.form = m.form.SetFocused(ti)
+}
+
+// kind names the screen this session is on, used to pick a drain policy
+func (m model) kind() string {
+	// The consent screen is a one-off question like the ToS, so it drains the same way
+	if m.needsTOS || m.askUsage {
+		return kindTOS
+	}
+	return kindPrompt
+}
+
+// busy reports whether the user is in the middle of typing something, or
+// saving it, so a wait-for-idle drain doesn't throw their input away
+func (m model) busy() bool {
+	return m.saving || !m.needsTOS && !m.form.Empty()
+}
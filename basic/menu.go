@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/hyperlink"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+)
+
+// The main menu's items, see screens.Menu
+const (
+	menuSubmit      = "Submit name"
+	menuSubmissions = "View submissions"
+	menuBrowse      = "Everyone's submissions"
+	menuChat        = "Chat"
+	menuAbout       = "About"
+	menuQuit        = "Quit"
+)
+
+var menuItems = []screens.MenuItem{
+	{Name: menuSubmit, Desc: "your name, email and favorite coffee"},
+	{Name: menuSubmissions, Desc: "what you've sent, and the trash"},
+	{Name: menuBrowse, Desc: "what others have ordered, newest first"},
+	{Name: menuChat, Desc: "talk to everyone who's here"},
+	{Name: menuAbout, Desc: "what this is"},
+	{Name: menuQuit, Desc: "ctrl+c works anywhere too"},
+}
+
+// newMenu is the main menu, the first thing after the greeting and where esc on the form goes
+func (m model) newMenu() screens.Menu {
+	items := menuItems
+	// Admins viewing as someone would be speaking for them
+	if m.impersonator != "" {
+		items = slices.DeleteFunc(slices.Clone(items), func(i screens.MenuItem) bool { return i.Name == menuChat })
+	}
+	return screens.NewMenu("What would you like to do?", items, m.theme.Name, m.theme.Hint, m.width, m.height)
+}
+
+// choose does what the user picked from the main menu
+func (m model) choose(item string) (model, tea.Cmd) {
+	switch item {
+	case menuSubmit:
+		// The form is under the menu
+		return m, screens.Pop
+	case menuSubmissions:
+		if m.guest {
+			m.upgrade = true
+			m.count("screen.upgrade")
+			return m, nil
+		}
+		return m.openSubmissions()
+	case menuBrowse:
+		return m.openBrowse()
+	case menuChat:
+		return m.openChat()
+	case menuAbout:
+		m.count("screen.about")
+		m.nav = m.nav.Push(screens.NewAbout(hyperlink.Markdown(aboutText(), m.links)))
+	case menuQuit:
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// sourceURL is where the app's code is
+const sourceURL = "https://github.com/jwc20/wish-bubbletea-tests"
+
+func aboutText() string {
+	v, c, _ := buildInfo()
+	if len(c) > 7 {
+		c = c[:7]
+	}
+	return fmt.Sprintf("A small app you reach over SSH: tell it your name and\n"+
+		"favorite coffee, look back at what you've sent.\n\nversion %s, commit %s\nsource %s", v, orUnknown(c), sourceURL)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+	"github.com/jwc20/wish-bubbletea-tests/basic/chat"
+	"github.com/jwc20/wish-bubbletea-tests/basic/colorpick"
+	"github.com/jwc20/wish-bubbletea-tests/basic/emoji"
+	"github.com/jwc20/wish-bubbletea-tests/basic/macro"
+	"github.com/jwc20/wish-bubbletea-tests/basic/presence"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/telemetry"
+	"github.com/jwc20/wish-bubbletea-tests/basic/tos"
+	"github.com/muesli/termenv"
+)
+
+// messageLogDir is where session message logs are saved, set by --record-messages
+// Logs contain everything users type, so only turn this on with their consent
+var messageLogDir string
+
+// now is the model's clock
+// Replay sets it to the time each message was recorded, so time based
+// decisions like locking come out the same way they did live
+var now = time.Now
+
+// loggedMessages decodes each message type a log can hold, by the name it's saved under
+// Commands aren't run during replay, so the messages they produced have to be in the log too
+var loggedMessages = map[string]func(json.RawMessage) (tea.Msg, error){
+	"key":                 decodeAs[tea.KeyMsg],
+	"size":                decodeAs[tea.WindowSizeMsg],
+	"lock":                decodeAs[lockMsg],
+	"idle":                decodeAs[idleMsg],
+	"warmed":              decodeAs[warmedMsg],
+	"queue":               decodeAs[queueMsg],
+	"admitted":            decodeAs[admittedMsg],
+	"impersonation.over":  decodeAs[impersonationOverMsg],
+	"drain":               decodeAs[drainMsg],
+	"content":             decodeAs[contentMsg],
+	"tos.accepted":        decodeAs[tos.AcceptedMsg],
+	"telemetry.decided":   decodeAs[telemetry.DecidedMsg],
+	"emoji.picked":        decodeAs[emoji.PickedMsg],
+	"emoji.closed":        decodeAs[emoji.ClosedMsg],
+	"color.picked":        decodeAs[colorpick.PickedMsg],
+	"color.closed":        decodeAs[colorpick.ClosedMsg],
+	"screens.pop":         decodeAs[screens.PopMsg],
+	"broadcast.banner":    decodeAs[broadcast.Banner],
+	"screens.confirmed":   decodeAs[screens.ConfirmedMsg],
+	"screens.timezone":    decodeAs[screens.TimeZoneMsg],
+	"screens.submissions": decodeAs[screens.SubmissionsMsg],
+	"screens.delete":      decodeAs[screens.DeleteMsg],
+	"screens.restore":     decodeAs[screens.RestoreMsg],
+	"screens.resolved":    decodeAs[screens.ResolvedMsg],
+	"screens.menu":        decodeAs[screens.MenuMsg],
+	"screens.page":        decodeAs[screens.PageMsg],
+	"screens.browse":      decodeAs[screens.BrowseMsg],
+	"chat.message":        decodeAs[chat.Message],
+	"macro.done":          decodeAs[macro.DoneMsg],
+	"presence.online":     decodeAs[presence.Online],
+	"saved":               decodeAs[savedMsg],
+	"macro.saved":         decodeAs[macroSavedMsg],
+	"trashed":             decodeAs[trashedMsg],
+	"pref.saved":          decodeAs[prefSavedMsg],
+}
+
+func decodeAs[T tea.Msg](raw json.RawMessage) (tea.Msg, error) {
+	var msg T
+	err := json.Unmarshal(raw, &msg)
+	return msg, err
+}
+
+// messageName is the name msg is logged under, false for messages that aren't logged
+// Cursor blinks and the like only affect how the input looks, not what it holds
+func messageName(msg tea.Msg) (string, bool) {
+	switch msg.(type) {
+	case tea.KeyMsg:
+		return "key", true
+	case tea.WindowSizeMsg:
+		return "size", true
+	case lockMsg:
+		return "lock", true
+	case idleMsg:
+		return "idle", true
+	case warmedMsg:
+		return "warmed", true
+	case queueMsg:
+		return "queue", true
+	case admittedMsg:
+		return "admitted", true
+	case impersonationOverMsg:
+		return "impersonation.over", true
+	case drainMsg:
+		return "drain", true
+	case contentMsg:
+		return "content", true
+	case tos.AcceptedMsg:
+		return "tos.accepted", true
+	case telemetry.DecidedMsg:
+		return "telemetry.decided", true
+	case emoji.PickedMsg:
+		return "emoji.picked", true
+	case emoji.ClosedMsg:
+		return "emoji.closed", true
+	case colorpick.PickedMsg:
+		return "color.picked", true
+	case colorpick.ClosedMsg:
+		return "color.closed", true
+	case broadcast.Banner:
+		return "broadcast.banner", true
+	case screens.PopMsg:
+		return "screens.pop", true
+	case screens.ConfirmedMsg:
+		return "screens.confirmed", true
+	case screens.TimeZoneMsg:
+		return "screens.timezone", true
+	case screens.SubmissionsMsg:
+		return "screens.submissions", true
+	case screens.DeleteMsg:
+		return "screens.delete", true
+	case screens.RestoreMsg:
+		return "screens.restore", true
+	case screens.ResolvedMsg:
+		return "screens.resolved", true
+	case screens.MenuMsg:
+		return "screens.menu", true
+	case screens.PageMsg:
+		return "screens.page", true
+	case screens.BrowseMsg:
+		return "screens.browse", true
+	case macro.DoneMsg:
+		return "macro.done", true
+	case chat.Message:
+		return "chat.message", true
+	case presence.Online:
+		return "presence.online", true
+	case savedMsg:
+		return "saved", true
+	case macroSavedMsg:
+		return "macro.saved", true
+	case trashedMsg:
+		return "trashed", true
+	case prefSavedMsg:
+		return "pref.saved", true
+	}
+	return "", false
+}
+
+// logEntry is one line of a message log after the setup line
+type logEntry struct {
+	At   time.Time       `json:"at"`
+	Type string          `json:"type"`
+	Msg  json.RawMessage `json:"msg"`
+}
+
+// messageLog writes a session's messages as JSON lines
+// The first line is the sessionSetup, every line after it a logEntry
+type messageLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openMessageLog starts a log for a session, closed when ctx is done
+// Failing to open it is logged and the session just isn't recorded
+func openMessageLog(ctx context.Context, setup sessionSetup) *messageLog {
+	name := fmt.Sprintf("%s-%s.jsonl", time.Now().UTC().Format("20060102T150405.000"), setup.User)
+	f, err := os.Create(filepath.Join(messageLogDir, filepath.Base(name)))
+	if err != nil {
+		log.Error("Could not start message log", "user", setup.User, "error", err)
+		return nil
+	}
+	l := &messageLog{f: f, enc: json.NewEncoder(f)}
+	if err := l.enc.Encode(setup); err != nil {
+		log.Error("Could not write message log", "user", setup.User, "error", err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.f.Close()
+	}()
+	return l
+}
+
+// write appends msg if it's a logged type; a nil log does nothing
+func (l *messageLog) write(msg tea.Msg) {
+	if l == nil {
+		return
+	}
+	name, ok := messageName(msg)
+	if !ok {
+		return
+	}
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Errors after the session closed the file are expected and ignored
+	l.enc.Encode(logEntry{At: now(), Type: name, Msg: raw})
+}
+
+// replay feeds a message log through a fresh model and returns the final view
+// A panic is returned as an error naming the line that caused it
+func replay(r io.Reader) (view string, err error) {
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1<<20)
+	if !scan.Scan() {
+		return "", errors.New("empty message log")
+	}
+	var setup sessionSetup
+	if err := json.Unmarshal(scan.Bytes(), &setup); err != nil {
+		return "", fmt.Errorf("line 1: %w", err)
+	}
+
+	// Plain text output, so views compare the same on any machine
+	renderer := lipgloss.NewRenderer(io.Discard)
+	renderer.SetColorProfile(termenv.Ascii)
+	defer func() { now = time.Now }()
+
+	line := 1
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("line %d: panic: %v", line, p)
+		}
+	}()
+	var m tea.Model = setup.model(renderer)
+	for scan.Scan() {
+		line++
+		var e logEntry
+		if err := json.Unmarshal(scan.Bytes(), &e); err != nil {
+			return "", fmt.Errorf("line %d: %w", line, err)
+		}
+		decode, ok := loggedMessages[e.Type]
+		if !ok {
+			return "", fmt.Errorf("line %d: unknown message type %q", line, e.Type)
+		}
+		msg, err := decode(e.Msg)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", line, err)
+		}
+		now = func() time.Time { return e.At }
+		// Commands are dropped, whatever they produced is further down the log
+		m, _ = m.Update(msg)
+	}
+	return m.View(), scan.Err()
+}
+
+// replayCommand replays each log and compares its final view with the
+// .view file next to it, writing that file instead when update is set
+// Replays run in a scratch directory so saving the ToS, macros and
+// submissions doesn't touch the real files
+func replayCommand(logs []string, update bool) int {
+	if len(logs) == 0 {
+		fmt.Println("usage: replay [-update] session.jsonl...")
+		return exitConfig
+	}
+	scratch, err := os.MkdirTemp("", "replay")
+	if err != nil {
+		fmt.Println("✗", err)
+		return exitError
+	}
+	defer os.RemoveAll(scratch)
+	if abs, err := filepath.Abs(contentDir); err == nil {
+		contentDir = abs
+	}
+	for i, path := range logs {
+		if abs, err := filepath.Abs(path); err == nil {
+			logs[i] = abs
+		}
+	}
+	if err := os.Chdir(scratch); err != nil {
+		fmt.Println("✗", err)
+		return exitError
+	}
+	// Replays mustn't reach out to the network or start background work
+	usage = nil
+	// Submissions made during a replay go to a throwaway database
+	submissionStore, err = storage.Open("submissions.db")
+	if err != nil {
+		fmt.Println("✗", err)
+		return exitError
+	}
+	defer submissionStore.Close()
+
+	code := exitOK
+	for _, path := range logs {
+		if err := replayOne(path, update); err != nil {
+			fmt.Printf("✗ %s: %v\n", path, err)
+			code = exitError
+			continue
+		}
+		fmt.Printf("✓ %s\n", path)
+	}
+	return code
+}
+
+func replayOne(path string, update bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	view, err := replay(f)
+	if err != nil {
+		return err
+	}
+
+	golden := strings.TrimSuffix(path, filepath.Ext(path)) + ".view"
+	if update {
+		return os.WriteFile(golden, []byte(view), 0644)
+	}
+	want, err := os.ReadFile(golden)
+	if errors.Is(err, os.ErrNotExist) {
+		// Nothing to compare with, getting through without a panic is the check
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(want) != view {
+		return fmt.Errorf("final view differs from %s\n--- want\n%s\n--- got\n%s", golden, want, view)
+	}
+	return nil
+}
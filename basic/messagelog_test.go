@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestReplay replays the message logs in testdata and compares each final
+// view with the .view file next to it, `replay -update testdata/*.jsonl`
+// writes those again after an intended change
+func TestReplay(t *testing.T) {
+	logs, err := filepath.Glob(filepath.Join("testdata", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 {
+		t.Skip("no message logs in testdata")
+	}
+	// replayCommand moves to a scratch directory, this moves back after
+	t.Chdir(".")
+	if code := replayCommand(logs, false); code != exitOK {
+		t.Fatalf("replay exited with %d, see the output above", code)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/motd"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// motdNotice is a file whose text goes in the message of the day as {{.Notice}},
+// read for every session so editing it takes effect straight away, set by --motd-notice
+var motdNotice string
+
+// motdHold is how long the message stays up before the app takes over the screen
+var motdHold = 2 * time.Second
+
+// motdMiddleware shows the message of the day from the content directory, see
+// the motd package, then hands the session on
+// Sessions without a PTY, i.e. commands, get their output unprefixed
+func motdMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, isPty := s.Pty(); isPty {
+				showMOTD(s)
+			}
+			next(s)
+		}
+	}
+}
+
+func showMOTD(s ssh.Session) {
+	notice, err := readNotice()
+	if err != nil {
+		log.Warn("Could not read --motd-notice", "error", err)
+	}
+	text, err := motd.Render(contentFS(), motd.Vars{
+		User:    s.User(),
+		Version: version,
+		Now:     time.Now().In(loadZone(sessionZone(s, savedZone(s)))),
+		Online:  online.Online().Users,
+		Notice:  notice,
+	})
+	if err != nil {
+		log.Warn("Could not render the message of the day", "error", err)
+		return
+	}
+	if text == "" {
+		return
+	}
+	// The client's terminal is raw, so every line needs its carriage return
+	wish.Print(s, strings.ReplaceAll(text, "\n", "\r\n")+"\r\n")
+	select {
+	case <-time.After(motdHold):
+	case <-s.Context().Done():
+	}
+}
+
+// readNotice returns the notice, removing the file takes it down
+func readNotice() (string, error) {
+	if motdNotice == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(motdNotice)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// savedZone is the time zone the session's user picked, if they have a profile
+func savedZone(s ssh.Session) string {
+	if p, ok := user.FromContext(s.Context()); ok {
+		return p.Prefs.TimeZone
+	}
+	return ""
+}
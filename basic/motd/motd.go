@@ -0,0 +1,57 @@
+// Package motd renders the message of the day, shown when a session starts
+// and before the app takes over the terminal.
+//
+// The message is a text/template at <content>/motd.txt, so it can be changed
+// without recompiling, e.g.
+//
+//	{{.Version}} • {{.Now.Format "Mon Jan 2 15:04 MST"}}
+//	Hi {{.User}}, {{.Online}} others are here
+//	{{.Notice}}
+//
+// See Vars for everything it can use. A missing or empty file shows nothing.
+package motd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Path is where the template lives in the content directory
+const Path = "motd.txt"
+
+// Vars are the values the template can use, e.g. {{.User}} or {{.Now.Format "Jan 2"}}
+type Vars struct {
+	User    string
+	Version string
+	Now     time.Time
+	// Online is how many users were in the app before this session
+	Online int
+	// Notice is the operator's current notice, see --motd-notice, empty if there's none
+	Notice string
+}
+
+// Render fills in the template in fsys, returning "" when there isn't one
+// Trailing blank lines are dropped, so the app starts right below the message
+func Render(fsys fs.FS, v Vars) (string, error) {
+	text, err := fs.ReadFile(fsys, Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	t, err := template.New(Path).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", Path, err)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, v); err != nil {
+		return "", fmt.Errorf("%s: %w", Path, err)
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/breaker"
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbox"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// Where submissions are announced, each one off when empty, see --webhook and friends
+var (
+	webhookURL      string
+	slackWebhookURL string
+	smtpAddr        string
+	smtpFrom        string
+	smtpUser        string
+	// smtpPasswordSecret names the SMTP password in --secrets, set by --smtp-password-secret
+	smtpPasswordSecret string
+)
+
+// smtpPassword logs smtpUser in, see loadSMTPPassword
+var smtpPassword string
+
+// outboundPolicies say how long calls to each integration wait and how often
+// they're retried, set with --outbound
+var outboundPolicies = outbound.Policies(outbound.Defaults)
+
+// notifier delivers the outbox, set up by setupNotifier
+var notifier = outbox.New(time.Minute, nil)
+
+// breakers guard each integration, set up with --breaker-threshold and --breaker-cooldown
+var breakers = breaker.NewSet(5, time.Minute, logBreaker)
+
+// submittedEvent is the body POSTed to --webhook
+type submittedEvent struct {
+	Event  string    `json:"event"`
+	ID     int64     `json:"id"`
+	At     time.Time `json:"at"`
+	User   string    `json:"user"`
+	Name   string    `json:"name"`
+	Coffee string    `json:"coffee"`
+}
+
+// setupNotifier registers a sender for each configured destination,
+// checking the outbox every interval
+func setupNotifier(interval time.Duration) {
+	senders := map[string]outbox.Sender{}
+	// Each destination has its own breaker, a dead webhook doesn't hold up Slack
+	if webhookURL != "" {
+		webhook := outbox.NewWebhook(outboundPolicies.Get(outbound.Webhook))
+		senders[outbox.KindWebhook] = outbox.Guard(webhook, breakers.Get(outbox.KindWebhook))
+	}
+	if slackWebhookURL != "" {
+		slack := outbox.NewWebhook(outboundPolicies.Get(outbound.Slack))
+		senders[outbox.KindSlack] = outbox.Guard(slack, breakers.Get(outbox.KindSlack))
+	}
+	if smtpAddr != "" {
+		email := outbox.Email{Addr: smtpAddr, From: smtpFrom, Policy: outboundPolicies.Get(outbound.Email)}
+		if smtpUser != "" {
+			host, _, _ := strings.Cut(smtpAddr, ":")
+			email.Auth = smtp.PlainAuth("", smtpUser, smtpPassword, host)
+		}
+		senders[outbox.KindEmail] = outbox.Guard(email, breakers.Get(outbox.KindEmail))
+	}
+	notifier = outbox.New(interval, senders)
+}
+
+// loadSMTPPassword reads the SMTP password from --smtp-password-secret, or
+// else SMTP_PASSWORD, so it isn't in ps or shell history
+func loadSMTPPassword(ctx context.Context) error {
+	if smtpPasswordSecret == "" {
+		smtpPassword = os.Getenv("SMTP_PASSWORD")
+		return nil
+	}
+	var err error
+	smtpPassword, err = secret(ctx, "--smtp-password-secret", smtpPasswordSecret)
+	return err
+}
+
+// receiptsDelayed reports whether emailed receipts are waiting for the SMTP
+// server to come back, so the app can say so rather than promise one now
+func receiptsDelayed() bool {
+	return smtpAddr != "" && !breakers.Get(outbox.KindEmail).Available()
+}
+
+// logBreaker logs a breaker opening and closing
+func logBreaker(s breaker.Status) {
+	switch s.State {
+	case breaker.Open:
+		log.Warn("Integration failing, pausing calls", "integration", s.Name, "failures", s.Failures, "until", s.RetryAt.Format(time.RFC3339), "error", s.LastErr)
+	case breaker.HalfOpen:
+		log.Info("Trying integration again", "integration", s.Name)
+	case breaker.Closed:
+		log.Info("Integration working again", "integration", s.Name)
+	}
+}
+
+// logBreakers logs every integration's breaker, for the breakers control command
+func logBreakers() {
+	for _, s := range breakers.All() {
+		log.Info("Breaker", "integration", s.Name, "state", s.State, "failures", s.Failures, "since", s.Since.Format(time.RFC3339), "error", s.LastErr)
+	}
+}
+
+// deliverNotifications runs the outbox once storage is ready
+// Messages left from before a restart are picked up too
+func deliverNotifications(ctx context.Context) {
+	select {
+	case <-warm.done:
+	case <-ctx.Done():
+		return
+	}
+	if warm.err != nil {
+		return
+	}
+	notifier.Run(ctx, submissionStore)
+}
+
+// notifications are the messages about sub, for storage.Store.Save to put in
+// the outbox with it
+func notifications(sub storage.Submission) []storage.Message {
+	var msgs []storage.Message
+	if webhookURL != "" {
+		// Marshalling strings and a time can't fail
+		body, _ := json.Marshal(submittedEvent{
+			Event: "submission.created", ID: sub.ID, At: sub.At,
+			User: sub.User, Name: sub.Value, Coffee: sub.Coffee,
+		})
+		msgs = append(msgs, storage.Message{Kind: outbox.KindWebhook, To: webhookURL, Body: string(body)})
+	}
+	if slackWebhookURL != "" {
+		body, _ := json.Marshal(map[string]string{"text": fmt.Sprintf("☕ %s ordered a %s", sub.Value, sub.Coffee)})
+		msgs = append(msgs, storage.Message{Kind: outbox.KindSlack, To: slackWebhookURL, Body: string(body)})
+	}
+	if smtpAddr != "" && sub.Email != "" {
+		msgs = append(msgs, storage.Message{
+			Kind:    outbox.KindEmail,
+			To:      sub.Email,
+			Subject: fmt.Sprintf("Your %s, order %d", sub.Coffee, sub.ID),
+			Body:    fmt.Sprintf("Hi %s,\n\nthanks for your order, your %s is on its way.\n", sub.Value, sub.Coffee),
+		})
+	}
+	return msgs
+}
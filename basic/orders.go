@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+)
+
+// ordersCommand projects every order from its events and prints it with its
+// timeline, after a fix to the rules it shows what the events add up to now
+// Events that still can't be applied are listed and make it exit nonzero
+func ordersCommand() int {
+	events, err := submissionStore.Events(0)
+	if err != nil {
+		fmt.Println("✗ orders:", err)
+		return exitError
+	}
+	all, errs := orders.Project(events)
+	for _, o := range all {
+		fmt.Printf("%d  %s  %s  %s\n", o.ID, o.User, o.Item, o.State)
+		for _, e := range o.Timeline {
+			fmt.Printf("    %d  %-9s %-16s %s\n", e.Seq, e.Type, e.Actor, e.At.Format("2006-01-02 15:04:05"))
+		}
+	}
+	fmt.Printf("✓ %d orders from %d events\n", len(all), len(events))
+	for _, err := range errs {
+		fmt.Println("✗ skipped:", err)
+	}
+	if len(errs) > 0 {
+		return exitError
+	}
+	return exitOK
+}
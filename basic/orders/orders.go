@@ -0,0 +1,135 @@
+// Package orders keeps each coffee order as the events that happened to it,
+// created, paid, packed, shipped and refunded, rather than as a row that's
+// changed in place.
+//
+// An Order is a projection: it's rebuilt by applying the events in order, so
+// its timeline is exactly what happened, and a bug in the rules for moving
+// between states can be fixed and the orders projected again from the
+// unchanged events.
+package orders
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Type is what happened to an order, the last one is the order's state
+type Type string
+
+const (
+	Created  Type = "created"
+	Paid     Type = "paid"
+	Packed   Type = "packed"
+	Shipped  Type = "shipped"
+	Refunded Type = "refunded"
+)
+
+// follows lists the events each state can be followed by
+var follows = map[Type][]Type{
+	"":       {Created},
+	Created:  {Paid},
+	Paid:     {Packed, Refunded},
+	Packed:   {Shipped, Refunded},
+	Shipped:  {Refunded},
+	Refunded: nil,
+}
+
+// Event is one thing that happened to an order
+type Event struct {
+	OrderID int64
+	// Seq numbers an order's events from 1, two sessions appending the same
+	// Seq means one of them acted on an out of date order
+	Seq   int
+	Type  Type
+	At    time.Time
+	Actor string // the user for Created, whoever did it for the rest
+	// Item is what was ordered, only Created has it
+	Item string
+}
+
+// Order is the state of one order, as projected from its events
+type Order struct {
+	ID       int64
+	User     string
+	Item     string
+	State    Type
+	Timeline []Event
+	// Seq is the last event's, including any that were skipped, see Project
+	Seq int
+}
+
+// Apply moves the order on by e, or says why e can't happen to it
+func (o Order) Apply(e Event) (Order, error) {
+	if o.ID != 0 && e.OrderID != o.ID {
+		return o, fmt.Errorf("event for order %d applied to order %d", e.OrderID, o.ID)
+	}
+	if e.Seq != o.Seq+1 {
+		return o, fmt.Errorf("order %d: event %d is %s, expected event %d", e.OrderID, e.Seq, e.Type, o.Seq+1)
+	}
+	if !slices.Contains(follows[o.State], e.Type) {
+		return o, fmt.Errorf("order %d: can't go from %s to %s", e.OrderID, stateName(o.State), e.Type)
+	}
+	if e.Type == Created {
+		o.ID, o.User, o.Item = e.OrderID, e.Actor, e.Item
+	}
+	o.State, o.Seq = e.Type, e.Seq
+	o.Timeline = append(slices.Clip(o.Timeline), e)
+	return o, nil
+}
+
+// Next is the event that moves the order forward, empty once it's shipped or refunded
+func (o Order) Next() Type {
+	if next := follows[o.State]; len(next) > 0 && next[0] != Refunded {
+		return next[0]
+	}
+	return ""
+}
+
+// Can reports whether t may happen to the order now
+func (o Order) Can(t Type) bool {
+	return slices.Contains(follows[o.State], t)
+}
+
+// NewEvent is the event for t happening to o, numbered to follow its timeline
+func (o Order) NewEvent(t Type, actor string, at time.Time) (Event, error) {
+	e := Event{OrderID: o.ID, Seq: o.Seq + 1, Type: t, At: at, Actor: actor}
+	_, err := o.Apply(e)
+	return e, err
+}
+
+// Project rebuilds orders from events sorted by order and Seq, newest order first
+// Events that can't happen are skipped and returned as errors, the rest of
+// their order is still projected so one bad event doesn't hide it
+func Project(events []Event) ([]Order, []error) {
+	var all []Order
+	var errs []error
+	byID := map[int64]int{}
+	for _, e := range events {
+		i, ok := byID[e.OrderID]
+		if !ok {
+			i = len(all)
+			byID[e.OrderID] = i
+			all = append(all, Order{})
+		}
+		o, err := all[i].Apply(e)
+		if err != nil {
+			errs = append(errs, err)
+			// Still counted, so the next event follows on and new ones are numbered after it
+			all[i].Seq = e.Seq
+			continue
+		}
+		all[i] = o
+	}
+	// Orders whose Created was skipped have nothing to show
+	all = slices.DeleteFunc(all, func(o Order) bool { return o.ID == 0 })
+	slices.Reverse(all)
+	return all, errs
+}
+
+func stateName(t Type) string {
+	if t == "" {
+		return "nothing"
+	}
+	return string(t)
+}
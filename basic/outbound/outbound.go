@@ -0,0 +1,226 @@
+// Package outbound builds the clients for calls the server makes to other
+// services, webhooks, Vault, release checks and the like, so each one waits
+// and retries the way its policy says.
+//
+// Every attempt is cut off at the policy's timeout, and retries stop as soon
+// as the caller's context is done, so a service that hangs can only hold a
+// goroutine for as long as whoever made the call is prepared to wait.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is how calls to one integration wait and retry
+type Policy struct {
+	// Timeout limits each attempt, 0 for no limit beyond the caller's context
+	Timeout time.Duration
+	// Attempts includes the first, 1 means no retries
+	Attempts int
+	// Backoff is the wait before the first retry, doubled after each
+	Backoff time.Duration
+}
+
+// The integrations with a policy
+const (
+	Webhook     = "webhook"
+	Slack       = "slack"
+	Email       = "email"
+	Telemetry   = "telemetry"
+	Vault       = "vault"
+	UpdateCheck = "update-check"
+	SelfUpdate  = "self-update"
+	ForgeKeys   = "forge-keys"
+	KMS         = "kms"
+)
+
+// Defaults is each integration's policy when it isn't configured
+// Only calls that are safe to repeat are retried: webhooks carry an
+// Idempotency-Key, telemetry counts are kept for the next report instead
+var Defaults = map[string]Policy{
+	Webhook:     {Timeout: 10 * time.Second, Attempts: 3, Backoff: 500 * time.Millisecond},
+	Slack:       {Timeout: 10 * time.Second, Attempts: 3, Backoff: 500 * time.Millisecond},
+	Email:       {Timeout: 30 * time.Second, Attempts: 1},
+	Telemetry:   {Timeout: 10 * time.Second, Attempts: 1},
+	Vault:       {Timeout: 10 * time.Second, Attempts: 3, Backoff: 500 * time.Millisecond},
+	UpdateCheck: {Timeout: 10 * time.Second, Attempts: 1},
+	SelfUpdate:  {Timeout: 2 * time.Minute, Attempts: 3, Backoff: 2 * time.Second},
+	// Someone is waiting to log in, so it's quick
+	ForgeKeys: {Timeout: 5 * time.Second, Attempts: 2, Backoff: 250 * time.Millisecond},
+	// Every handshake waits on the host key's signature
+	KMS: {Timeout: 5 * time.Second, Attempts: 2, Backoff: 250 * time.Millisecond},
+}
+
+// Policies are the policies of every integration
+type Policies map[string]Policy
+
+// Parse reads policies as comma separated name=timeout/attempts/backoff,
+// e.g. "webhook=5s/3/1s,vault=20s", on top of Defaults
+// Attempts and backoff can be left off to keep the default's
+func Parse(spec string) (Policies, error) {
+	ps := Policies(maps.Clone(Defaults))
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		p, known := ps[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("%q: want name=timeout/attempts/backoff with a name from %s", part, strings.Join(slices.Sorted(maps.Keys(Defaults)), ", "))
+		}
+		fields := strings.Split(value, "/")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("%q: want timeout/attempts/backoff", part)
+		}
+		var err error
+		if p.Timeout, err = time.ParseDuration(fields[0]); err != nil || p.Timeout < 0 {
+			return nil, fmt.Errorf("%q: bad timeout %q", part, fields[0])
+		}
+		if len(fields) > 1 {
+			if p.Attempts, err = strconv.Atoi(fields[1]); err != nil || p.Attempts < 1 {
+				return nil, fmt.Errorf("%q: attempts must be at least 1", part)
+			}
+		}
+		if len(fields) > 2 {
+			if p.Backoff, err = time.ParseDuration(fields[2]); err != nil || p.Backoff < 0 {
+				return nil, fmt.Errorf("%q: bad backoff %q", part, fields[2])
+			}
+		}
+		ps[name] = p
+	}
+	return ps, nil
+}
+
+// Get returns the policy for name, or the default's if it isn't in ps
+func (ps Policies) Get(name string) Policy {
+	if p, ok := ps[name]; ok {
+		return p
+	}
+	return Defaults[name]
+}
+
+// Do calls f until it succeeds, returns a Permanent error, or the policy's
+// attempts are used up, each time with a context limited to Timeout
+// It gives up early when ctx is done, returning the last error
+func (p Policy) Do(ctx context.Context, f func(context.Context) error) error {
+	var err error
+	wait := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err = p.attempt(ctx, f)
+		var permanent permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= p.Attempts || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (p Policy) attempt(ctx context.Context, f func(context.Context) error) error {
+	if p.Timeout <= 0 {
+		return f(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	return f(ctx)
+}
+
+// Permanent wraps err so Do returns it straight away instead of retrying
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Client returns an HTTP client whose requests follow p
+// Requests that can't connect, time out or get a 429 or 5xx are retried,
+// as long as their body can be sent again; the last response is returned
+// as is, so callers still check its status
+func (p Policy) Client() *http.Client {
+	return &http.Client{Transport: transport{policy: p, next: http.DefaultTransport}}
+}
+
+type transport struct {
+	policy Policy
+	next   http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.policy
+	// A body that can't be read again can only be sent once
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		p.Attempts = 1
+	}
+	// Each attempt's timeout also covers reading its body, so it's applied here
+	// and released when the body is closed rather than when Do's attempt returns
+	timeout := p.Timeout
+	p.Timeout = 0
+	var resp *http.Response
+	first := true
+	err := p.Do(req.Context(), func(ctx context.Context) error {
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+		cancel := context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		try := req.Clone(ctx)
+		// The first attempt read the body, later ones need a fresh copy
+		if !first && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return Permanent(err)
+			}
+			try.Body = body
+		}
+		first = false
+		r, err := t.next.RoundTrip(try)
+		if err != nil {
+			cancel()
+			return err
+		}
+		r.Body = bodyCloser{ReadCloser: r.Body, cancel: cancel}
+		resp = r
+		if r.StatusCode == http.StatusTooManyRequests || r.StatusCode >= 500 {
+			return errors.New(r.Status)
+		}
+		return nil
+	})
+	if resp != nil {
+		// A 429 or 5xx left after the last attempt is the caller's to report
+		return resp, nil
+	}
+	return nil, err
+}
+
+// bodyCloser releases an attempt's context when its response body is closed
+type bodyCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b bodyCloser) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
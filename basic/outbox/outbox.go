@@ -0,0 +1,187 @@
+// Package outbox delivers the notifications storage keeps in its outbox
+// table: webhooks, Slack messages and emails about what users submitted.
+//
+// A message is written in the same transaction as the submission it's about,
+// so a crash can't leave one without the other. The Dispatcher claims due
+// messages, hands each to the Sender for its kind and marks it delivered, or
+// schedules a retry with a growing delay.
+//
+// Delivery is at least once: a crash after sending but before marking the
+// message delivered sends it again once its claim runs out. Every attempt
+// carries the same key, an Idempotency-Key header or the email's Message-ID,
+// so receivers can drop the repeat.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/breaker"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// Kinds of message, each delivered by the Sender registered for it
+const (
+	KindWebhook = "webhook"
+	KindSlack   = "slack"
+	KindEmail   = "email"
+)
+
+// Sender delivers one kind of message
+type Sender interface {
+	Send(ctx context.Context, m storage.Message) error
+}
+
+// Box is where messages wait, a *storage.Store
+type Box interface {
+	Claim(now time.Time, lease time.Duration, n int) ([]storage.Message, error)
+	Delivered(id int64, at time.Time) error
+	Retry(id int64, reason string, next time.Time) error
+	Defer(id int64, until time.Time) error
+}
+
+const (
+	// batch is how many messages are claimed at a time
+	batch = 20
+	// lease is how long a claimed message is left alone, longer than a send may take
+	lease = 2 * time.Minute
+	// sendTimeout cuts a send off however its sender retries, so the lease never runs out under it
+	sendTimeout = time.Minute
+	// MaxAttempts is how many times a message is tried before it's given up on
+	MaxAttempts = 10
+	// firstRetry doubles after each failure, up to lastRetry
+	firstRetry = 30 * time.Second
+	lastRetry  = 6 * time.Hour
+)
+
+// Key is what a receiver can use to tell a repeated delivery of m from a new message
+func Key(m storage.Message) string {
+	return fmt.Sprintf("outbox-%d", m.ID)
+}
+
+// Guard sends through s while b lets it, a sender whose breaker is open
+// isn't tried and its messages wait without using up attempts
+func Guard(s Sender, b *breaker.Breaker) Sender {
+	return guarded{s: s, b: b}
+}
+
+type guarded struct {
+	s Sender
+	b *breaker.Breaker
+}
+
+func (g guarded) Send(ctx context.Context, m storage.Message) error {
+	return g.b.Do(func() error { return g.s.Send(ctx, m) })
+}
+
+// Dispatcher delivers due messages every interval, and straight away after Wake
+type Dispatcher struct {
+	senders  map[string]Sender
+	interval time.Duration
+	wake     chan struct{}
+}
+
+// New returns a dispatcher using senders by kind
+func New(interval time.Duration, senders map[string]Sender) *Dispatcher {
+	return &Dispatcher{senders: senders, interval: interval, wake: make(chan struct{}, 1)}
+}
+
+// Enabled reports whether any kind of message can be delivered
+func (d *Dispatcher) Enabled() bool {
+	return len(d.senders) > 0
+}
+
+// Can reports whether messages of kind can be delivered
+func (d *Dispatcher) Can(kind string) bool {
+	return d.senders[kind] != nil
+}
+
+// Wake asks for a delivery round now rather than at the next interval,
+// e.g. after saving a message
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers messages from box until ctx is done
+func (d *Dispatcher) Run(ctx context.Context, box Box) {
+	tick := time.NewTicker(d.interval)
+	defer tick.Stop()
+	for {
+		d.Deliver(ctx, box)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Deliver sends every message that's due, one batch after another
+func (d *Dispatcher) Deliver(ctx context.Context, box Box) {
+	for ctx.Err() == nil {
+		msgs, err := box.Claim(time.Now(), lease, batch)
+		if err != nil {
+			log.Error("Could not claim outbox messages", "error", err)
+			return
+		}
+		for _, m := range msgs {
+			d.deliver(ctx, box, m)
+		}
+		if len(msgs) < batch {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, box Box, m storage.Message) {
+	err := fmt.Errorf("nothing sends %s messages", m.Kind)
+	if s := d.senders[m.Kind]; s != nil {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = s.Send(sendCtx, m)
+		cancel()
+	}
+	// The breaker didn't let it try, so the attempt doesn't count
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		if err := box.Defer(m.ID, open.RetryAt); err != nil {
+			log.Error("Could not reschedule outbox message", "id", m.ID, "error", err)
+		}
+		return
+	}
+	if err == nil {
+		if err := box.Delivered(m.ID, time.Now()); err != nil {
+			// It stays claimed, and goes again when the lease is up
+			log.Error("Could not mark outbox message delivered", "id", m.ID, "error", err)
+		}
+		return
+	}
+	next := time.Time{}
+	if m.Attempts < MaxAttempts {
+		wait := retryAfter(m.Attempts)
+		next = time.Now().Add(wait)
+		log.Warn("Outbox message not delivered, will retry", "id", m.ID, "kind", m.Kind, "attempt", m.Attempts, "retry-in", wait, "error", err)
+	} else {
+		log.Error("Outbox message not delivered, giving up", "id", m.ID, "kind", m.Kind, "attempts", m.Attempts, "error", err)
+	}
+	if err := box.Retry(m.ID, err.Error(), next); err != nil {
+		log.Error("Could not reschedule outbox message", "id", m.ID, "error", err)
+	}
+}
+
+// retryAfter is the wait after attempt failed
+func retryAfter(attempt int) time.Duration {
+	wait := firstRetry
+	for range attempt - 1 {
+		if wait *= 2; wait >= lastRetry {
+			return lastRetry
+		}
+	}
+	return wait
+}
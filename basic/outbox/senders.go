@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// Webhook POSTs a message's body, JSON, to its URL, it also sends Slack's
+// incoming webhooks
+type Webhook struct {
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook whose requests wait and retry as p says
+func NewWebhook(p outbound.Policy) Webhook {
+	return Webhook{Client: p.Client()}
+}
+
+func (w Webhook) Send(ctx context.Context, m storage.Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.To, strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", Key(m))
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", m.Kind, resp.Status)
+	}
+	return nil
+}
+
+// Email sends a message as a plain text email through an SMTP server
+type Email struct {
+	// Addr is the server's host:port
+	Addr string
+	From string
+	// Auth is nil for servers that don't need a login
+	Auth smtp.Auth
+	// Policy limits how long each try waits and how often it's retried
+	Policy outbound.Policy
+}
+
+func (e Email) Send(ctx context.Context, m storage.Message) error {
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return fmt.Errorf("email: header has a line break")
+	}
+	host, _, _ := strings.Cut(e.Addr, ":")
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", e.From, m.To, m.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\nMessage-ID: <%s@%s>\r\n", time.Now().Format(time.RFC1123Z), Key(m), host)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return e.Policy.Do(ctx, func(ctx context.Context) error {
+		// net/smtp has no context, the send runs on and its result is dropped if ctx ends first
+		done := make(chan error, 1)
+		go func() { done <- smtp.SendMail(e.Addr, e.Auth, e.From, []string{m.To}, []byte(msg.String())) }()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
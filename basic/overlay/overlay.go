@@ -0,0 +1,69 @@
+// Package overlay stacks two file systems so files in the upper one hide
+// files with the same name in the lower one.
+//
+// The server uses it to let a directory on disk override the defaults
+// embedded in the binary, one file at a time.
+package overlay
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+)
+
+// FS reads from upper first and falls back to lower
+type FS struct {
+	upper, lower fs.FS
+}
+
+// New returns a file system where upper takes precedence over lower
+func New(upper, lower fs.FS) FS {
+	return FS{upper: upper, lower: lower}
+}
+
+// Open opens name from upper, or from lower if upper doesn't have it
+func (o FS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+	return f, err
+}
+
+// ReadDir lists the entries of both layers, upper entries win on name clashes
+// fs.Glob and fs.WalkDir use this, so they see the merged tree
+func (o FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, uerr := fs.ReadDir(o.upper, name)
+	lower, lerr := fs.ReadDir(o.lower, name)
+	if uerr != nil && !errors.Is(uerr, fs.ErrNotExist) {
+		return nil, uerr
+	}
+	if lerr != nil && !errors.Is(lerr, fs.ErrNotExist) {
+		return nil, lerr
+	}
+	if uerr != nil && lerr != nil {
+		return nil, uerr
+	}
+
+	seen := map[string]bool{}
+	entries := make([]fs.DirEntry, 0, len(upper)+len(lower))
+	for _, e := range upper {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range lower {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		switch {
+		case a.Name() < b.Name():
+			return -1
+		case a.Name() > b.Name():
+			return 1
+		}
+		return 0
+	})
+	return entries, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// passwords lets users without a key log in with a password, nil unless --passwords
+var passwords *passwordFile
+
+// passwordFile admits the users listed in a credentials file, one per line as
+// NAME:HASH with a bcrypt hash of their password, see `hash-password`
+// Like authorized_keys, it's read again whenever it changes
+type passwordFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	hashes  map[string][]byte // by user name
+}
+
+func newPasswordFile(path string) *passwordFile {
+	return &passwordFile{path: path}
+}
+
+// unknownUser is checked against for names that aren't in the file, so a wrong
+// name takes as long to refuse as a wrong password
+var unknownUser, _ = bcrypt.GenerateFromPassword([]byte("not anyone's password"), bcrypt.DefaultCost)
+
+// load reads the file if it changed since the last read; callers must hold p.mu
+func (p *passwordFile) load() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	if p.hashes != nil && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	hashes := map[string][]byte{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("%s: line %d: want NAME:HASH", p.path, i+1)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("%s: line %d: %s's password isn't a bcrypt hash: %w", p.path, i+1, name, err)
+		}
+		hashes[name] = []byte(hash)
+	}
+	p.hashes, p.modTime = hashes, info.ModTime()
+	return nil
+}
+
+// hash returns name's hash, nil if they aren't in the file
+// If the file can't be read, the hashes from the last good read are used
+func (p *passwordFile) hash(name string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.load(); err != nil {
+		log.Error("Could not read passwords, using the last good copy", "error", err)
+	}
+	return p.hashes[name]
+}
+
+// listed reports whether name logs in with a password
+func (p *passwordFile) listed(name string) bool {
+	return p.hash(name) != nil
+}
+
+// verify reports whether password is name's
+func (p *passwordFile) verify(name, password string) bool {
+	hash := p.hash(name)
+	if hash == nil {
+		bcrypt.CompareHashAndPassword(unknownUser, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// Check makes sure the file exists and every line in it parses
+func (p *passwordFile) Check() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hashes = nil
+	return p.load()
+}
+
+// Option installs password authentication, which clients try once none of
+// their keys were accepted
+func (p *passwordFile) Option() ssh.Option {
+	return wish.WithPasswordAuth(func(ctx ssh.Context, password string) bool {
+		ok := p.verify(ctx.User(), password)
+		if !ok {
+			log.Info("Password not accepted", "user", ctx.User(), "remote", ctx.RemoteAddr())
+		}
+		return ok
+	})
+}
+
+// hashPasswordCommand prints a line for the --passwords file for the
+// `hash-password NAME` subcommand, reading the password from the terminal
+// without echoing it, or from the first line of stdin
+func hashPasswordCommand(args []string) int {
+	if len(args) != 1 || args[0] == "" || strings.Contains(args[0], ":") {
+		fmt.Fprintln(os.Stderr, "usage: hash-password NAME   (NAME can't contain a colon)")
+		return exitConfig
+	}
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hash-password: %v\n", err)
+		return exitError
+	}
+	hash, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+	if err != nil {
+		// e.g. longer than the 72 bytes bcrypt takes
+		fmt.Fprintf(os.Stderr, "hash-password: %v\n", err)
+		return exitConfig
+	}
+	fmt.Printf("%s:%s\n", args[0], hash)
+	return exitOK
+}
+
+func readPassword() ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, errors.New("no password on stdin")
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprint(os.Stderr, "Again: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(first, again) != 1 {
+		return nil, errors.New("the passwords don't match")
+	}
+	return first, nil
+}
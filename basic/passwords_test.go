@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writePasswords writes lines to a passwords file and returns it
+func writePasswords(t *testing.T, lines string) *passwordFile {
+	path := filepath.Join(t.TempDir(), "passwords")
+	if err := os.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return newPasswordFile(path)
+}
+
+func TestPasswordVerify(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := writePasswords(t, "# people without keys\njae:"+string(hash)+"\n\n")
+	if err := p.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, password string
+		ok             bool
+	}{
+		{"jae", "correct horse", true},
+		{"jae", "wrong horse", false},
+		{"jae", "", false},
+		{"sam", "correct horse", false},
+	} {
+		if ok := p.verify(tt.name, tt.password); ok != tt.ok {
+			t.Errorf("verify(%q, %q) = %v, want %v", tt.name, tt.password, ok, tt.ok)
+		}
+	}
+	if !p.listed("jae") || p.listed("sam") {
+		t.Error("listed should be true for jae only")
+	}
+}
+
+func TestPasswordFileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, lines string
+	}{
+		{"no hash", "jae\n"},
+		{"no name", ":$2a$04$abc\n"},
+		{"not bcrypt", "jae:hunter2\n"},
+	} {
+		if err := writePasswords(t, tt.lines).Check(); err == nil {
+			t.Errorf("%s: Check accepted %q", tt.name, tt.lines)
+		}
+	}
+	if err := newPasswordFile(filepath.Join(t.TempDir(), "missing")).Check(); err == nil {
+		t.Error("Check accepted a missing file")
+	}
+}
+
+// TestPasswordLastGoodCopy keeps the hashes from the last good read when the file breaks
+func TestPasswordLastGoodCopy(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := writePasswords(t, "jae:"+string(hash)+"\n")
+	if !p.verify("jae", "correct horse") {
+		t.Fatal("verify refused the right password")
+	}
+	if err := os.WriteFile(p.path, []byte("jae:hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change is seen whatever the file system's timestamp resolution
+	if err := os.Chtimes(p.path, p.modTime.Add(1), p.modTime.Add(1)); err != nil {
+		t.Fatal(err)
+	}
+	if !p.verify("jae", "correct horse") {
+		t.Error("a broken file locked jae out")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+	"github.com/jwc20/wish-bubbletea-tests/basic/sessionlog"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	"github.com/muesli/termenv"
+)
+
+// The app itself is the innermost middleware, so it has to end the pipeline
+const appMiddleware = "bubbletea"
+
+// middlewareRegistry returns every middleware that can appear in the pipeline,
+// by the name used in --middleware
+// Components that are set up in main are passed in rather than read from globals
+func middlewareRegistry(drain *drainer, sessionLog *sessionlog.Logger) map[string]func() wish.Middleware {
+	return map[string]func() wish.Middleware{
+		// Logs each session as JSON lines under its own ID, see --session-log
+		"logging":       sessionLog.Middleware,
+		"agent-forward": agentForwardMiddleware,
+		// Blocks or warns about known-bad SSH clients and counts versions
+		"clients": func() wish.Middleware { return clients.Middleware() },
+		// Turns new sessions away while an operator has maintenance mode on
+		"maintenance": maintenanceMiddleware,
+		// Turns guests away when they start too many sessions, see --guests
+		"guests": guestsMiddleware,
+		// Finds or creates the profile for the session's key
+		"users": usersMiddleware,
+		// Runs commands given on the ssh command line instead of the app, see exec.go
+		// It must come after users, so guests are known, and before activeterm
+		"exec": execMiddleware,
+		// Lists the session in the registry operators and admins see
+		"sessions": connected.Middleware,
+		// Tracks sessions so shutdown can drain them per policy,
+		// it must come before bubbletea so teaHandler can find the session
+		"drain": drain.Middleware,
+		// Holds new sessions on a queue screen once --max-sessions are in the app
+		"limit": limitMiddleware,
+		// Notes sessions without a PTY, it must come before activeterm which turns them away
+		"scanners": func() wish.Middleware { return scanners.Middleware() },
+		// Injects faults for resilience testing, see --chaos
+		"chaos": chaos.Middleware,
+		// Bubble Tea apps usually require a PTY
+		"activeterm": activeterm.Middleware,
+		// Shows the message of the day before the app starts, see motd.go
+		// Put it after users, so the greeting can use the user's time zone
+		"motd": motdMiddleware,
+		// Records terminal sessions as asciicast files, see --record-sessions
+		// Put it last before bubbletea, so what the app draws is all that's recorded
+		"record": recordMiddleware,
+		// The bubbletea middleware connects our TUI app to SSH sessions
+		// Programs are built through the broadcaster so announcements reach them
+		appMiddleware: func() wish.Middleware {
+			return bubbletea.MiddlewareWithProgramHandler(broadcaster.Handler(teaHandler, audienceOf), termenv.Ascii)
+		},
+	}
+}
+
+// audienceOf describes the session for targeted announcements, see broadcast.Target
+func audienceOf(s ssh.Session) broadcast.Audience {
+	a := broadcast.Audience{
+		Role:   broadcast.RoleUser,
+		Locale: sessionLocale(s),
+		Bucket: broadcast.Bucket(s.User()),
+	}
+	switch {
+	case isAdmin(s):
+		a.Role = broadcast.RoleAdmin
+	case isGuest(s.Context()):
+		a.Role = broadcast.RoleGuest
+	}
+	// Key holders land in the same bucket whatever name they connect as
+	if p, ok := user.FromContext(s.Context()); ok {
+		a.LastSeen = p.LastSeen
+		a.Bucket = broadcast.Bucket(p.Fingerprint)
+	}
+	return a
+}
+
+// usersMiddleware puts the key holder's profile in the session context
+// Handoff sessions are skipped, they carry the original session's profile instead
+// of creating one for the new device's key, and so are admins impersonating someone,
+// who would otherwise get a profile named as:NAME
+func usersMiddleware() wish.Middleware {
+	profiles := user.Middleware(userStore)
+	return func(next ssh.Handler) ssh.Handler {
+		withProfile := profiles(next)
+		return func(s ssh.Session) {
+			_, _, impersonating := parseImpersonation(s.User())
+			if handoffs.Valid(s.User()) || impersonating && isAdmin(s) {
+				next(s)
+				return
+			}
+			withProfile(s)
+		}
+	}
+}
+
+// buildPipeline turns a list like "logging,drain,activeterm,bubbletea" into middleware
+// The list is in the order a session passes through it, outermost first, and
+// leaving a name out disables that component
+func buildPipeline(spec string, registry map[string]func() wish.Middleware) ([]wish.Middleware, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := registry[name]; !ok {
+			known := make([]string, 0, len(registry))
+			for k := range registry {
+				known = append(known, k)
+			}
+			slices.Sort(known)
+			return nil, fmt.Errorf("unknown middleware %q (want some of %s)", name, strings.Join(known, ", "))
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("middleware %q is listed twice", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 || names[len(names)-1] != appMiddleware {
+		return nil, fmt.Errorf("the pipeline must end with %s", appMiddleware)
+	}
+
+	// wish.WithMiddleware runs the last one first, so hand them over reversed
+	mws := make([]wish.Middleware, 0, len(names))
+	for _, name := range slices.Backward(names) {
+		mws = append(mws, registry[name]())
+	}
+	return mws, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// pref is one preference a session can change and save
+type pref struct {
+	what string // as the user knows it, also the conflict screen's What
+	of   func(*user.Prefs) *string
+	// apply shows value in the session
+	apply func(model, string) model
+}
+
+var prefs = []pref{
+	{what: "accent color", of: func(p *user.Prefs) *string { return &p.Accent }, apply: model.applyAccent},
+	{what: "time zone", of: func(p *user.Prefs) *string { return &p.TimeZone }, apply: model.applyZone},
+}
+
+var accentPref, zonePref = prefs[0], prefs[1]
+
+// prefAttempts caps retries when other sessions keep saving in between
+const prefAttempts = 3
+
+// prefSavedMsg is what saving a preference came to: the profile as it was
+// saved or last found, and what another session saved over Value when the
+// user has to choose between them
+type prefSavedMsg struct {
+	What     string
+	Value    string
+	Prefs    user.Prefs
+	Version  int
+	Conflict bool
+	Theirs   string
+}
+
+// savePref saves value as the user's preference, if they have a profile to
+// keep it in. The session's prefs are what it last loaded or saved; when
+// another session has saved since, the change is merged if it touched
+// something else, and the user is asked which to keep if it touched this
+func (m model) savePref(p pref, value string) (model, tea.Cmd) {
+	if m.fingerprint == "" || m.guest {
+		return m, nil
+	}
+	name, fingerprint := m.user, m.fingerprint
+	msg := prefSavedMsg{What: p.what, Value: value, Prefs: m.prefs, Version: m.profileVersion}
+	return m, func() tea.Msg {
+		for range prefAttempts {
+			chaos.slowStorage()
+			saved, err := userStore.UpdatePrefsIf(fingerprint, msg.Version, func(prefs *user.Prefs) { *p.of(prefs) = value })
+			var conflict *user.ConflictError
+			if !errors.As(err, &conflict) {
+				if err != nil {
+					log.Error("Could not save preferences", "user", name, "error", err)
+					return msg
+				}
+				msg.Prefs, msg.Version = saved.Prefs, saved.Version
+				return msg
+			}
+			current := conflict.Current
+			theirs := *p.of(&current.Prefs)
+			was := *p.of(&msg.Prefs)
+			// What's saved now is what this session has seen from here on
+			msg.Prefs, msg.Version = current.Prefs, current.Version
+			if theirs != was && theirs != value {
+				log.Info("Preference changed in another session", "user", name, "pref", p.what)
+				msg.Conflict, msg.Theirs = true, theirs
+				return msg
+			}
+			// The other session changed something else, or made the same change, so this one goes on top
+		}
+		log.Error("Could not save preferences, they keep changing", "user", name, "pref", p.what)
+		return msg
+	}
+}
+
+// prefSaved keeps the profile savePref came back with, and asks the user
+// which value to keep if another session changed it too
+func (m model) prefSaved(msg prefSavedMsg) model {
+	// Saves can finish out of order, an older profile doesn't replace a newer one
+	if msg.Version >= m.profileVersion {
+		m.prefs, m.profileVersion = msg.Prefs, msg.Version
+	}
+	if msg.Conflict {
+		m.nav = m.nav.Push(screens.NewConflict(msg.What, msg.Theirs, msg.Value))
+	}
+	return m
+}
+
+// resolvePref applies the value the user kept after a conflict, saving it if it's theirs
+func (m model) resolvePref(msg screens.ResolvedMsg) (model, tea.Cmd) {
+	for _, p := range prefs {
+		if p.what != msg.What {
+			continue
+		}
+		m = p.apply(m, msg.Value)
+		if msg.Value != *p.of(&m.prefs) {
+			return m.savePref(p, msg.Value)
+		}
+	}
+	return m, nil
+}
+
+// applyAccent draws the session in accent from now on
+func (m model) applyAccent(accent string) model {
+	m.accent = lipgloss.Color(accent)
+	m.theme = m.theme.WithAccent(accent)
+	m.counter = newCounterStyles(m.theme)
+	m.form = m.form.WithStyles(formStyles(m.theme))
+	return m
+}
+
+// applyZone shows times in the named zone from now on
+func (m model) applyZone(name string) model {
+	m.zoneName = name
+	m.format = l10n.New(m.locale, loadZone(name))
+	return m
+}
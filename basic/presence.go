@@ -0,0 +1,21 @@
+package main
+
+import "github.com/charmbracelet/ssh"
+
+// presenceKey is who the session counts as online, a handed off session is
+// still the user who started it
+func presenceKey(s ssh.Session, setup sessionSetup) string {
+	if setup.Fingerprint != "" {
+		return setup.Fingerprint
+	}
+	return fingerprint(s)
+}
+
+// onlineView says how many users are online, including this one
+func (m model) onlineView() string {
+	users := "users"
+	if m.online.Users == 1 {
+		users = "user"
+	}
+	return m.theme.Hint.Render("● " + m.format.Int(m.online.Users) + " " + users + " online")
+}
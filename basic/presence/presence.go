@@ -0,0 +1,69 @@
+// Package presence counts who's online, pushing the count to every session
+// when it changes.
+//
+// Users are counted once however many sessions they have open, by their key
+// fingerprint or, without a key, the name they connected as.
+package presence
+
+import "sync"
+
+// Online is how many users are online, pushed when it changes
+// Seq orders the pushes, which can arrive out of order, so a session keeps
+// the one with the highest
+type Online struct {
+	Users int
+	Seq   uint64
+}
+
+// Tracker keeps each user's open sessions, it's safe to share
+type Tracker struct {
+	// changed, if set, is told the new count, e.g. to broadcast it
+	changed func(Online)
+
+	mu       sync.Mutex
+	sessions map[string]int
+	seq      uint64
+}
+
+// New returns a tracker with nobody online
+func New(changed func(Online)) *Tracker {
+	return &Tracker{changed: changed, sessions: map[string]int{}}
+}
+
+// Join counts a session of user until done is closed, e.g. the session's
+// context ends, and returns the count with it included
+func (t *Tracker) Join(user string, done <-chan struct{}) Online {
+	online := t.add(user, 1)
+	go func() {
+		<-done
+		t.add(user, -1)
+	}()
+	return online
+}
+
+// Online returns the count now
+func (t *Tracker) Online() Online {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Online{Users: len(t.sessions), Seq: t.seq}
+}
+
+// add changes user's sessions by n and announces the count if it changed
+func (t *Tracker) add(user string, n int) Online {
+	t.mu.Lock()
+	before := len(t.sessions)
+	if t.sessions[user] += n; t.sessions[user] <= 0 {
+		delete(t.sessions, user)
+	}
+	changed := len(t.sessions) != before
+	if changed {
+		t.seq++
+	}
+	online := Online{Users: len(t.sessions), Seq: t.seq}
+	t.mu.Unlock()
+
+	if changed && t.changed != nil {
+		t.changed(online)
+	}
+	return online
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/config"
+)
+
+// settings are the knobs that differ between environments
+type settings struct {
+	host          string
+	port          string
+	hostKey       string
+	logLevel      log.Level
+	listenRetries int
+	drain         string
+	drainTimeout  time.Duration
+	// middleware is the session pipeline, outermost first, see pipeline.go
+	middleware string
+	// openAuth lets everyone in without --authorized-keys on a port others can
+	// reach; when it's false the server won't start like that
+	openAuth bool
+	// integrations lets the server call other services: the webhooks, email,
+	// telemetry and the update check; when it's false their flags are ignored
+	integrations bool
+}
+
+// baseSettings is what every profile starts from
+var baseSettings = settings{
+	// For production deployment, use 0.0.0.0 to listen on all interfaces
+	host: "0.0.0.0",
+	// Port 22 is the default SSH port but requires elevated privileges
+	// Using port 3000 instead to avoid permission issues on macOS
+	port: "3000",
+	// SSH keys will be stored in .ssh/id_ed25519
+	hostKey:       ".ssh/id_ed25519",
+	logLevel:      log.InfoLevel,
+	listenRetries: 5,
+	drain:         "tos=immediate,prompt=wait-for-idle",
+	drainTimeout:  30 * time.Second,
+	middleware:    "logging,agent-forward,clients,maintenance,guests,users,exec,sessions,drain,limit,scanners,activeterm,record,bubbletea",
+}
+
+// profile is a named set of overrides applied on top of its parent
+// The parent's overrides run first, so a profile only lists what it changes
+type profile struct {
+	parent   string
+	override func(*settings)
+}
+
+// profiles selectable with --profile
+var profiles = map[string]profile{
+	"prod": {
+		override: func(s *settings) {
+			// Only production announces submissions and reports usage for real
+			s.integrations = true
+		},
+	},
+	"staging": {
+		parent: "prod",
+		override: func(s *settings) {
+			s.logLevel = log.DebugLevel
+		},
+	},
+	"dev": {
+		parent: "staging",
+		override: func(s *settings) {
+			// localhost is good for development
+			s.host = "localhost"
+			// Restarts during development shouldn't hang around
+			s.listenRetries = 1
+			s.drain = "tos=immediate,prompt=immediate"
+			s.drainTimeout = 2 * time.Second
+			// Trying the app shouldn't need a list of keys
+			s.openAuth = true
+			// A copy of production's flags shouldn't email real people
+			s.integrations = false
+		},
+	},
+}
+
+// applyConfig overrides s with whatever the config file or environment set
+func applyConfig(s *settings, f config.File) error {
+	if f.Host != "" {
+		s.host = f.Host
+	}
+	if f.Port != "" {
+		s.port = f.Port
+	}
+	if f.HostKey != "" {
+		s.hostKey = f.HostKey
+	}
+	if f.LogLevel != "" {
+		level, err := log.ParseLevel(f.LogLevel)
+		if err != nil {
+			return err
+		}
+		s.logLevel = level
+	}
+	if len(f.Middleware) > 0 {
+		s.middleware = strings.Join(f.Middleware, ",")
+	}
+	return nil
+}
+
+// dropIntegrations empties whichever of flags are set, for profiles without
+// integrations, saying which so nobody wonders why their webhook is quiet
+func dropIntegrations(profile string, flags map[string]*string) {
+	for _, name := range slices.Sorted(maps.Keys(flags)) {
+		if *flags[name] != "" {
+			log.Warn("Integrations are off in this profile, ignoring --"+name, "profile", profile)
+			*flags[name] = ""
+		}
+	}
+}
+
+// profileNames lists the profiles for help and error messages
+func profileNames() string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveProfile applies a profile and all of its parents to baseSettings
+func resolveProfile(name string) (settings, error) {
+	var chain []profile
+	for seen := map[string]bool{}; name != ""; {
+		p, ok := profiles[name]
+		if !ok {
+			return settings{}, fmt.Errorf("unknown profile %q (want one of %s)", name, profileNames())
+		}
+		if seen[name] {
+			return settings{}, fmt.Errorf("profile %q inherits from itself", name)
+		}
+		seen[name] = true
+		chain = append(chain, p)
+		name = p.parent
+	}
+
+	s := baseSettings
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].override(&s)
+	}
+	return s, nil
+}
@@ -0,0 +1,120 @@
+// Package prompt loads the text shown around the name input from the content
+// directory, so it can be changed and translated without recompiling.
+//
+// Each locale has a file at <content>/prompts/<locale>.json:
+//
+//	{"prompt": "Hi {{.User}}, what's your name?", "placeholder": "Jae C"}
+//
+// Both fields are text/template templates, see Vars for what they can use.
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultLocale is used when nothing matches the client's locale
+const DefaultLocale = "en"
+
+// Template is the unrendered prompt for one locale
+type Template struct {
+	Prompt      string `json:"prompt"`
+	Placeholder string `json:"placeholder"`
+}
+
+// fallback is used when the content directory has no prompt files at all
+var fallback = Template{Prompt: "Name?", Placeholder: "Jae C"}
+
+// Vars are the values templates can use, e.g. {{.User}} or {{.Now.Format "Jan 2"}}
+type Vars struct {
+	User string
+	Now  time.Time
+}
+
+// Load finds the best template for locale (e.g. "es_MX.UTF-8") in the content fsys
+// It tries es_MX, then es, then DefaultLocale, then the built-in fallback
+func Load(fsys fs.FS, locale string) (Template, error) {
+	for _, name := range candidates(locale) {
+		data, err := fs.ReadFile(fsys, path.Join("prompts", name+".json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fallback, err
+		}
+		var t Template
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fallback, fmt.Errorf("prompts/%s.json: %w", name, err)
+		}
+		return t, nil
+	}
+	return fallback, nil
+}
+
+// candidates lists the locale names to try, most specific first
+func candidates(locale string) []string {
+	// Drop the encoding and modifier, "es_MX.UTF-8@euro" -> "es_MX"
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+
+	var names []string
+	if locale != "" && locale != "C" && locale != "POSIX" {
+		names = append(names, locale)
+		if lang, _, ok := strings.Cut(locale, "_"); ok {
+			names = append(names, lang)
+		}
+	}
+	return append(names, DefaultLocale)
+}
+
+// Render fills in the template variables
+func (t Template) Render(v Vars) (prompt, placeholder string, err error) {
+	if prompt, err = render("prompt", t.Prompt, v); err != nil {
+		return "", "", err
+	}
+	if placeholder, err = render("placeholder", t.Placeholder, v); err != nil {
+		return "", "", err
+	}
+	return prompt, placeholder, nil
+}
+
+func render(name, text string, v Vars) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Check parses every prompt file in fsys so typos show up before anyone connects
+func Check(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "prompts/*.json")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var t Template
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if _, _, err := t.Render(Vars{}); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
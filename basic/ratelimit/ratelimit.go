@@ -0,0 +1,217 @@
+// Package ratelimit throttles addresses that reconnect too quickly and bans
+// the ones that keep at it for a while.
+//
+// Bans are saved to a JSON file, so restarting the server doesn't give an
+// abusive address a fresh start. Recent connection times only live in memory.
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+)
+
+// Ban is one banned address
+type Ban struct {
+	Host  string    `json:"host"`
+	Until time.Time `json:"until"`
+}
+
+// Limiter allows each address limit connections per window
+// Connections over the limit are refused, and an address that reaches
+// twice the limit is banned for banFor
+type Limiter struct {
+	limit  int
+	window time.Duration
+	banFor time.Duration
+	path   string
+
+	mu     sync.Mutex
+	recent map[string][]time.Time // connection times within the window, by host
+	bans   map[string]time.Time   // when each ban ends, by host
+	// counts since start, for Stats
+	throttled int
+	refused   int
+}
+
+// New returns a limiter that keeps its bans in the JSON file at path
+// Call Load before using it to pick up the bans from the last run
+func New(path string, limit int, window, banFor time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		banFor: banFor,
+		path:   path,
+		recent: map[string][]time.Time{},
+		bans:   map[string]time.Time{},
+	}
+}
+
+// Load reads the saved bans, a missing file just means there are none
+func (l *Limiter) Load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []Ban
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for _, b := range saved {
+		l.bans[b.Host] = b.Until
+	}
+	return nil
+}
+
+// SetLimits changes the limits for connections from now on, a limit of 0 lets
+// everyone in; bans already given last until they end
+func (l *Limiter) SetLimits(limit int, window, banFor time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.window, l.banFor = limit, window, banFor
+}
+
+// Allow records a connection from host and reports whether to let it in
+func (l *Limiter) Allow(host string, at time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until, ok := l.bans[host]; ok {
+		if at.Before(until) {
+			l.refused++
+			return false
+		}
+		delete(l.bans, host)
+		l.saveLocked(at)
+	}
+	if l.limit <= 0 {
+		return true
+	}
+
+	kept := l.recent[host][:0]
+	for _, t := range l.recent[host] {
+		if at.Sub(t) < l.window {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, at)
+	l.recent[host] = kept
+	// Forget hosts that have gone quiet so the map doesn't grow forever
+	for h, times := range l.recent {
+		if at.Sub(times[len(times)-1]) >= l.window {
+			delete(l.recent, h)
+		}
+	}
+
+	switch {
+	case len(kept) >= 2*l.limit:
+		l.bans[host] = at.Add(l.banFor)
+		delete(l.recent, host)
+		l.refused++
+		log.Warn("Banning address", "host", host, "connections", len(kept), "window", l.window, "until", at.Add(l.banFor).Format(time.RFC3339))
+		l.saveLocked(at)
+		return false
+	case len(kept) > l.limit:
+		l.throttled++
+		log.Debug("Throttling address", "host", host, "connections", len(kept), "window", l.window)
+		return false
+	}
+	return true
+}
+
+// Bans returns the bans still in force at at, soonest to end first
+func (l *Limiter) Bans(at time.Time) []Ban {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.activeLocked(at)
+}
+
+// Unban lifts the ban on host, reporting whether there was one
+func (l *Limiter) Unban(host string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.bans[host]; !ok {
+		return false, nil
+	}
+	delete(l.bans, host)
+	delete(l.recent, host)
+	return true, l.save(time.Now())
+}
+
+// Stats returns how many connections were throttled and how many were refused
+// because their address was banned, since the limiter was created
+func (l *Limiter) Stats() (throttled, refused int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throttled, l.refused
+}
+
+// Option refuses connections from throttled and banned addresses before the handshake
+// It wraps the connection callback already set, so it has to come after the option that sets it
+func (l *Limiter) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+			if err != nil {
+				host = conn.RemoteAddr().String()
+			}
+			if !l.Allow(host, time.Now()) {
+				return nil
+			}
+			if next != nil {
+				return next(ctx, conn)
+			}
+			return conn
+		}
+		return nil
+	}
+}
+
+// activeLocked returns the bans in force at at; callers must hold l.mu
+func (l *Limiter) activeLocked(at time.Time) []Ban {
+	var bans []Ban
+	for host, until := range l.bans {
+		if at.Before(until) {
+			bans = append(bans, Ban{Host: host, Until: until})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.Before(bans[j].Until) })
+	return bans
+}
+
+// saveLocked saves the bans, logging rather than returning a failure,
+// since the connection has to be dealt with either way; callers must hold l.mu
+func (l *Limiter) saveLocked(at time.Time) {
+	if err := l.save(at); err != nil {
+		log.Error("Could not save bans", "path", l.path, "error", err)
+	}
+}
+
+// save writes the bans in force at at, dropping expired ones; callers must hold l.mu
+func (l *Limiter) save(at time.Time) error {
+	data, err := json.MarshalIndent(l.activeLocked(at), "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half a file behind
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// start is an arbitrary time the tests count from
+var start = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+func newLimiter(t *testing.T, limit int) *Limiter {
+	return New(filepath.Join(t.TempDir(), "bans.json"), limit, time.Minute, time.Hour)
+}
+
+func TestThrottle(t *testing.T) {
+	l := newLimiter(t, 3)
+	for i := range 3 {
+		if !l.Allow("203.0.113.7", start.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("connection %d refused, the limit is 3", i+1)
+		}
+	}
+	if l.Allow("203.0.113.7", start.Add(3*time.Second)) {
+		t.Error("fourth connection in a minute let in")
+	}
+	if !l.Allow("198.51.100.1", start.Add(3*time.Second)) {
+		t.Error("another address was throttled too")
+	}
+	// The first connections fall out of the window
+	if !l.Allow("203.0.113.7", start.Add(time.Minute+2*time.Second)) {
+		t.Error("still throttled once the window moved on")
+	}
+	if throttled, refused := l.Stats(); throttled != 1 || refused != 0 {
+		t.Errorf("Stats = %d, %d, want 1, 0", throttled, refused)
+	}
+}
+
+func TestBan(t *testing.T) {
+	l := newLimiter(t, 2)
+	for i := range 4 {
+		l.Allow("203.0.113.7", start.Add(time.Duration(i)*time.Second))
+	}
+	bans := l.Bans(start.Add(5 * time.Second))
+	if len(bans) != 1 || bans[0].Host != "203.0.113.7" || !bans[0].Until.Equal(start.Add(3*time.Second+time.Hour)) {
+		t.Fatalf("Bans = %v, want 203.0.113.7 for an hour from the fourth connection", bans)
+	}
+	// Banned well past the window, until the ban ends
+	if l.Allow("203.0.113.7", start.Add(30*time.Minute)) {
+		t.Error("banned address let in")
+	}
+	if !l.Allow("203.0.113.7", start.Add(2*time.Hour)) {
+		t.Error("still refused after the ban ended")
+	}
+	if len(l.Bans(start.Add(2*time.Hour))) != 0 {
+		t.Error("ended ban still listed")
+	}
+}
+
+// TestBansSurviveRestart loads the bans a limiter saved into a new one
+func TestBansSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	l := New(path, 1, time.Minute, time.Hour)
+	l.Allow("203.0.113.7", start)
+	l.Allow("203.0.113.7", start)
+
+	restarted := New(path, 1, time.Minute, time.Hour)
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Allow("203.0.113.7", start.Add(time.Minute)) {
+		t.Error("ban forgotten across a restart")
+	}
+
+	if ok, err := restarted.Unban("203.0.113.7"); !ok || err != nil {
+		t.Fatalf("Unban = %v, %v, want true, nil", ok, err)
+	}
+	again := New(path, 1, time.Minute, time.Hour)
+	if err := again.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !again.Allow("203.0.113.7", start.Add(time.Minute)) {
+		t.Error("unbanned address still banned after a restart")
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if err := newLimiter(t, 1).Load(); err != nil {
+		t.Errorf("Load with no file = %v, want nil", err)
+	}
+}
+
+// TestNoLimit lets everyone in when the limit is 0, bans already given still hold
+func TestNoLimit(t *testing.T) {
+	l := newLimiter(t, 1)
+	l.Allow("203.0.113.7", start)
+	l.Allow("203.0.113.7", start)
+	l.SetLimits(0, time.Minute, time.Hour)
+	for i := range 10 {
+		if !l.Allow("198.51.100.1", start) {
+			t.Fatalf("connection %d refused with no limit", i+1)
+		}
+	}
+	if l.Allow("203.0.113.7", start.Add(time.Second)) {
+		t.Error("ban lifted by turning the limit off")
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/asciicast"
+)
+
+// recordDir is where sessions are recorded as asciicast files, set by --record-sessions
+// Recordings show everything users see and type, so only turn this on with their consent
+var recordDir string
+
+// recordRetention is how long recordings are kept, set by --record-retention
+var recordRetention = 7 * 24 * time.Hour
+
+// recordMaxBytes is the most the recordings can take up together, the oldest
+// are removed past it, set by --record-max-bytes
+var recordMaxBytes int64 = 1 << 30
+
+// recordingLimit is where a single recording stops, so one session can't
+// fill the disk between prunes
+const recordingLimit = 100 << 20
+
+// recordUsers is who gets recorded, set by --record-users and changed at
+// runtime with `record USER on|off` on the control FIFO
+var recordUsers = parseRecordUsers("")
+
+// recordingUsers is everyone, or the listed users, with the operator's changes on top
+type recordingUsers struct {
+	sync.Mutex
+	all  bool
+	list map[string]bool
+}
+
+// parseRecordUsers reads --record-users, a comma separated list of user names, or empty for everyone
+func parseRecordUsers(spec string) *recordingUsers {
+	users := &recordingUsers{all: true, list: map[string]bool{}}
+	for name := range strings.SplitSeq(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			users.all = false
+			users.list[name] = true
+		}
+	}
+	return users
+}
+
+// wants reports whether name's sessions are recorded
+func (u *recordingUsers) wants(name string) bool {
+	u.Lock()
+	defer u.Unlock()
+	if on, ok := u.list[name]; ok {
+		return on
+	}
+	return u.all
+}
+
+// set turns recording name's sessions on or off, from their next session on
+func (u *recordingUsers) set(name string, on bool) {
+	u.Lock()
+	defer u.Unlock()
+	if u.list == nil {
+		u.list = map[string]bool{}
+	}
+	u.list[name] = on
+}
+
+// recordedKey marks a session's context once its recording has started
+type recordedKey struct{}
+
+// isRecorded reports whether the session is being recorded, so the app can say so
+func isRecorded(s ssh.Session) bool {
+	on, _ := s.Context().Value(recordedKey{}).(bool)
+	return on
+}
+
+// recordMiddleware records what terminal sessions draw as asciicast files in
+// recordDir, see the asciicast package; without --record-sessions it does nothing
+// It goes just before bubbletea, so whatever draws earlier isn't recorded
+func recordMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			pty, windows, isPty := s.Pty()
+			who := recordedUser(s)
+			if recordDir == "" || !isPty || !recordUsers.wants(who) {
+				next(s)
+				return
+			}
+			name := fmt.Sprintf("%s-%s%s", time.Now().UTC().Format("20060102T150405.000"), who, asciicast.Ext)
+			rec, err := asciicast.Start(filepath.Join(recordDir, filepath.Base(name)), asciicast.Header{
+				Width:  pty.Window.Width,
+				Height: pty.Window.Height,
+				Title:  who + "@" + s.RemoteAddr().String(),
+				Env:    map[string]string{"TERM": pty.Term},
+			}, recordingLimit)
+			if err != nil {
+				log.Error("Could not start recording the session", "user", who, "error", err)
+				next(s)
+				return
+			}
+			defer func() {
+				if errors.Is(rec.Err(), asciicast.ErrLimit) {
+					log.Warn("Stopped recording the session at its size limit", "user", who, "file", name)
+				}
+				if err := rec.Close(); err != nil {
+					log.Error("Could not finish recording the session", "user", who, "error", err)
+				}
+			}()
+			s.Context().SetValue(recordedKey{}, true)
+			log.Debug("Recording the session", "user", who, "file", name)
+			next(&recordedSession{Session: s, rec: rec, windows: teeWindows(s.Context(), windows, rec)})
+		}
+	}
+}
+
+// recordedUser is the name the session's recording is filed under
+func recordedUser(s ssh.Session) string {
+	if isGuest(s.Context()) {
+		return "guest"
+	}
+	return userName(s)
+}
+
+// recordedSession passes everything through to the session, copying what's
+// written to it and its resizes into the recording
+type recordedSession struct {
+	ssh.Session
+	rec     *asciicast.Recorder
+	windows <-chan ssh.Window
+	once    sync.Once
+}
+
+// Write records what the client's terminal gets, which for an emulated PTY
+// has its newlines turned into carriage return and newline on the way
+func (r *recordedSession) Write(p []byte) (int, error) {
+	n, err := r.Session.Write(p)
+	var out io.Writer = recorderWriter{r.rec}
+	if r.EmulatedPty() {
+		out = ssh.NewPtyWriter(out)
+	}
+	if _, recErr := out.Write(p[:n]); recErr != nil && !errors.Is(recErr, asciicast.ErrLimit) {
+		r.once.Do(func() {
+			log.Error("Stopped recording the session", "user", r.User(), "error", recErr)
+		})
+	}
+	return n, err
+}
+
+// Pty hands out the resizes after they're recorded, the bubbletea middleware
+// reads them from here
+func (r *recordedSession) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	pty, _, ok := r.Session.Pty()
+	return pty, r.windows, ok
+}
+
+// recorderWriter adapts the recording to an io.Writer
+type recorderWriter struct{ rec *asciicast.Recorder }
+
+func (w recorderWriter) Write(p []byte) (int, error) {
+	return len(p), w.rec.Output(p)
+}
+
+// teeWindows records each resize on windows before passing it on
+func teeWindows(ctx context.Context, windows <-chan ssh.Window, rec *asciicast.Recorder) <-chan ssh.Window {
+	out := make(chan ssh.Window)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case w, ok := <-windows:
+				if !ok {
+					return
+				}
+				rec.Resize(w.Width, w.Height)
+				select {
+				case out <- w:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// pruneRecordings removes recordings past --record-retention, then the
+// oldest past --record-max-bytes, at startup and then every purgeEvery until ctx is done
+func pruneRecordings(ctx context.Context) {
+	if recordDir == "" {
+		return
+	}
+	tick := time.NewTicker(purgeEvery)
+	defer tick.Stop()
+	for {
+		n, err := asciicast.Prune(recordDir, time.Now().Add(-recordRetention), recordMaxBytes)
+		if err != nil {
+			log.Error("Could not prune session recordings", "error", err)
+		}
+		if n > 0 {
+			log.Info("Pruned session recordings", "recordings", n, "older-than", recordRetention, "max-bytes", recordMaxBytes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// checkRecordDir creates the recordings' directory if it's missing
+func checkRecordDir() error {
+	if recordDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(recordDir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(recordDir, ".check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// logRecording logs who is recorded, for the `record` control command
+func logRecording() {
+	recordUsers.Lock()
+	defer recordUsers.Unlock()
+	var on, off []string
+	for name, yes := range recordUsers.list {
+		if yes {
+			on = append(on, name)
+		} else {
+			off = append(off, name)
+		}
+	}
+	slices.Sort(on)
+	slices.Sort(off)
+	log.Info("Session recording", "dir", recordDir, "everyone", recordUsers.all, "on", on, "off", off)
+}
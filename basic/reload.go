@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/broadcast"
+	"github.com/jwc20/wish-bubbletea-tests/basic/config"
+)
+
+// liveSettings are the settings a running server can change, by reading
+// --config again on SIGHUP or the control FIFO's reload
+type liveSettings struct {
+	logLevel   log.Level
+	banner     string
+	admins     map[string]bool
+	rateLimit  int
+	rateWindow time.Duration
+	banFor     time.Duration
+}
+
+// configSource is where the live settings come from, kept so they can be read again
+type configSource struct {
+	path string
+	// base is the settings from the profile and the flags, before the file
+	base liveSettings
+	// flagged are the flags given on the command line, they keep winning over the file
+	flagged map[string]bool
+	// applied is the file as it was last applied
+	applied config.File
+}
+
+// liveConfig is where the live settings came from, set in main
+var liveConfig configSource
+
+// reloading stops two reloads from interleaving
+var reloading sync.Mutex
+
+// banner is the config file's banner, shown at the top of every session
+var banner atomic.Pointer[string]
+
+// currentBanner returns the config file's banner, empty when there isn't one
+func currentBanner() string {
+	if b := banner.Load(); b != nil {
+		return *b
+	}
+	return ""
+}
+
+// live returns the settings f gives on top of the base ones
+func (c configSource) live(f config.File) (liveSettings, error) {
+	s := c.base
+	s.banner = f.Banner
+	if f.LogLevel != "" && !c.flagged["log-level"] {
+		level, err := log.ParseLevel(f.LogLevel)
+		if err != nil {
+			return s, fmt.Errorf("log_level: %w", err)
+		}
+		s.logLevel = level
+	}
+	if len(f.Admins) > 0 && !c.flagged["admins"] {
+		s.admins = parseAdmins(strings.Join(f.Admins, ","))
+	}
+	if f.RateLimit != "" && !c.flagged["rate-limit"] {
+		n, err := strconv.Atoi(f.RateLimit)
+		if err != nil || n < 0 {
+			return s, fmt.Errorf("rate_limit: want a number of connections, got %q", f.RateLimit)
+		}
+		s.rateLimit = n
+	}
+	for _, d := range []struct {
+		name, flag, value string
+		to                *time.Duration
+	}{
+		{"rate_window", "rate-window", f.RateWindow, &s.rateWindow},
+		{"ban_for", "ban-for", f.BanFor, &s.banFor},
+	} {
+		if d.value == "" || c.flagged[d.flag] {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return s, fmt.Errorf("%s: want a duration like 1m, got %q", d.name, d.value)
+		}
+		*d.to = v
+	}
+	return s, nil
+}
+
+// restartNeeded names the settings f changes that only take effect on a restart
+func (c configSource) restartNeeded(f config.File) []string {
+	was := c.applied
+	var names []string
+	for name, changed := range map[string]bool{
+		"profile":    f.Profile != was.Profile,
+		"host":       f.Host != was.Host,
+		"port":       f.Port != was.Port,
+		"host_key":   f.HostKey != was.HostKey,
+		"middleware": !slices.Equal(f.Middleware, was.Middleware),
+	} {
+		if changed {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// reloadConfig reads --config again and applies what can change without a
+// restart; the listener and sessions carry on as they are
+// A file that doesn't parse changes nothing
+func reloadConfig() error {
+	reloading.Lock()
+	defer reloading.Unlock()
+	if liveConfig.path == "" {
+		return errors.New("there's no --config to reload")
+	}
+	f, err := config.Load(liveConfig.path)
+	if err != nil {
+		return err
+	}
+	// The profile was picked at start, by the file or --profile
+	if f.Profile == "" || liveConfig.flagged["profile"] {
+		f.Profile = liveConfig.applied.Profile
+	}
+	next, err := liveConfig.live(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", liveConfig.path, err)
+	}
+	was, _ := liveConfig.live(liveConfig.applied)
+	if names := liveConfig.restartNeeded(f); len(names) > 0 {
+		log.Warn("Some --config changes need a restart", "settings", strings.Join(names, ", "))
+	}
+	applyLive(next, was)
+	liveConfig.applied = f
+	log.Info("Reloaded --config", "path", liveConfig.path)
+	return nil
+}
+
+// applyLive puts s in place, logging what changed since was
+func applyLive(s, was liveSettings) {
+	if s.logLevel != was.logLevel {
+		log.SetLevel(s.logLevel)
+		log.Info("Log level changed", "to", s.logLevel.String())
+	}
+
+	if s.banner != was.banner {
+		banner.Store(&s.banner)
+		n := broadcaster.Send(broadcast.Banner{Text: s.banner})
+		log.Info("Banner changed", "banner", s.banner, "sessions", n)
+	}
+
+	if !maps.Equal(s.admins, was.admins) {
+		// Impersonation is recorded in the audit log, which is only opened at
+		// start when there are admins, so the first ones need a restart
+		if auditLog == nil && len(s.admins) > 0 {
+			log.Error("Admins can only be added to a server started without any by restarting it, so the audit log is opened")
+		} else {
+			admins.set(s.admins)
+			// Admin sessions already open stay open until they end
+			log.Info("Admins changed", "admins", len(s.admins))
+		}
+	}
+
+	if s.rateLimit != was.rateLimit || s.rateWindow != was.rateWindow || s.banFor != was.banFor {
+		switch {
+		case rateLimits == nil && s.rateLimit > 0:
+			log.Error("Rate limiting was off at start, restart to turn it on", "rate-limit", s.rateLimit)
+		case rateLimits != nil:
+			rateLimits.SetLimits(s.rateLimit, s.rateWindow, s.banFor)
+			log.Info("Rate limits changed", "limit", s.rateLimit, "window", s.rateWindow, "ban-for", s.banFor)
+		}
+	}
+}
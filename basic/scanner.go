@@ -0,0 +1,192 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// scanners is set up in main and shared with the runtime controls for stats
+var scanners *scannerGuard
+
+// scannerGuard spots clients that behave like scanners rather than people:
+// dropping the connection before auth, or connecting without asking for a PTY.
+// Addresses that do this repeatedly get tarpitted, then dropped, while
+// addresses that open real sessions are left alone
+type scannerGuard struct {
+	// threshold suspicious events within window starts the tarpit,
+	// twice as many drops connections outright
+	threshold int
+	window    time.Duration
+	tarpit    time.Duration
+
+	mu        sync.Mutex
+	hosts     map[string]*scannerHost
+	lastSweep time.Time
+	tarpitted int
+	dropped   int
+}
+
+// scannerHost is what we remember about one remote address
+type scannerHost struct {
+	events []time.Time // recent suspicious events, oldest first
+	// versions counts the client version strings seen, a cheap fingerprint
+	versions map[string]int
+}
+
+func newScannerGuard(threshold int, window, tarpit time.Duration) *scannerGuard {
+	return &scannerGuard{
+		threshold: threshold,
+		window:    window,
+		tarpit:    tarpit,
+		hosts:     map[string]*scannerHost{},
+	}
+}
+
+// hostOf strips the port so reconnects from the same machine count together
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// score returns the number of recent suspicious events; callers must hold g.mu
+func (g *scannerGuard) score(host string, now time.Time) int {
+	h, ok := g.hosts[host]
+	if !ok {
+		return 0
+	}
+	cutoff := now.Add(-g.window)
+	for len(h.events) > 0 && h.events[0].Before(cutoff) {
+		h.events = h.events[1:]
+	}
+	return len(h.events)
+}
+
+// record notes a suspicious event for addr
+func (g *scannerGuard) record(addr net.Addr, version, reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	host := hostOf(addr)
+	h, ok := g.hosts[host]
+	if !ok {
+		h = &scannerHost{versions: map[string]int{}}
+		g.hosts[host] = h
+	}
+	h.events = append(h.events, time.Now())
+	if version != "" {
+		h.versions[version]++
+	}
+	log.Debug("Suspicious connection", "host", host, "reason", reason, "version", version, "score", len(h.events))
+}
+
+// forgive takes the oldest suspicious event off an address when it opens a
+// real session, so a person who fumbled their first few attempts works their
+// way back, but a scanner can't wipe its record by opening one PTY session
+func (g *scannerGuard) forgive(addr net.Addr) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if h, ok := g.hosts[hostOf(addr)]; ok && len(h.events) > 0 {
+		h.events = h.events[1:]
+	}
+}
+
+// Option hooks the guard into the server's connection lifecycle
+func (g *scannerGuard) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		s.ConnCallback = g.connCallback
+		s.ConnectionFailedCallback = func(conn net.Conn, err error) {
+			// The handshake failed, so the client never got as far as a session
+			g.record(conn.RemoteAddr(), "", "handshake failed")
+		}
+		return nil
+	}
+}
+
+// connCallback runs for every new connection before the handshake
+// Returning nil closes the connection
+func (g *scannerGuard) connCallback(ctx ssh.Context, conn net.Conn) net.Conn {
+	now := time.Now()
+	host := hostOf(conn.RemoteAddr())
+
+	g.mu.Lock()
+	g.sweep(now)
+	score := g.score(host, now)
+	switch {
+	case score >= 2*g.threshold:
+		g.dropped++
+	case score >= g.threshold:
+		g.tarpitted++
+	}
+	g.mu.Unlock()
+
+	switch {
+	case score >= 2*g.threshold:
+		return nil
+	case score >= g.threshold:
+		// Each connection waits in its own goroutine, so this only slows the scanner down
+		time.Sleep(g.tarpit)
+	}
+	return conn
+}
+
+// sweep forgets addresses with no recent events; callers must hold g.mu
+func (g *scannerGuard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.window {
+		return
+	}
+	g.lastSweep = now
+	for host := range g.hosts {
+		if g.score(host, now) == 0 {
+			delete(g.hosts, host)
+		}
+	}
+}
+
+// Middleware records sessions that never asked for a PTY, and forgives one event for ones that did
+// It has to run before activeterm, which would otherwise turn them away first
+func (g *scannerGuard) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); ok {
+				g.forgive(s.RemoteAddr())
+			} else {
+				g.record(s.RemoteAddr(), s.Context().ClientVersion(), "no pty")
+			}
+			next(s)
+		}
+	}
+}
+
+// LogStats logs the noisiest addresses and how many connections were slowed or dropped
+func (g *scannerGuard) LogStats() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	type entry struct {
+		host  string
+		score int
+		h     *scannerHost
+	}
+	var top []entry
+	for host, h := range g.hosts {
+		if score := g.score(host, now); score > 0 {
+			top = append(top, entry{host, score, h})
+		}
+	}
+	sort.Slice(top, func(i, j int) bool { return top[i].score > top[j].score })
+
+	log.Info("Scanner stats", "tracked", len(top), "tarpitted", g.tarpitted, "dropped", g.dropped)
+	for _, e := range top[:min(len(top), 10)] {
+		log.Info("Scanner", "host", e.host, "score", e.score, "versions", e.h.versions)
+	}
+}
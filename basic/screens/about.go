@@ -0,0 +1,27 @@
+package screens
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// About says what the app is, the app writes the text
+type About struct {
+	text string
+}
+
+// NewAbout shows text until the user goes back
+func NewAbout(text string) About {
+	return About{text: text}
+}
+
+func (a About) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc", "enter", "q":
+			return a, Pop
+		}
+	}
+	return a, nil
+}
+
+func (a About) View() string {
+	return a.text + "\n\nesc to go back"
+}
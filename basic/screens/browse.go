@@ -0,0 +1,132 @@
+package screens
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// PageSize is how many submissions Browse shows at a time
+const PageSize = 10
+
+// PageMsg asks the app for page Page, counting from 0, of everyone's
+// submissions up to submission Top, 0 for the newest
+type PageMsg struct {
+	Top  int64
+	Page int
+}
+
+// BrowseMsg is the page of everyone's submissions the app loaded at At
+// Top is the newest submission counted, Total how many there are up to it
+type BrowseMsg struct {
+	At    time.Time
+	Top   int64
+	Page  int
+	Total int
+	Rows  []storage.Submission
+	Err   string
+}
+
+// Browse shows everyone's submissions newest first, a page at a time
+// The app does the loading, the screen asks with PageMsg
+// Pages are counted from the newest submission when it opened, so paging
+// doesn't skip or repeat rows when someone submits meanwhile; r starts again
+type Browse struct {
+	f      l10n.Formatter
+	table  table.Model
+	loaded time.Time // zero until the first BrowseMsg
+	top    int64
+	page   int
+	total  int
+	err    string
+}
+
+// NewBrowse opens the table, the header in hint and the selected row in accent
+func NewBrowse(f l10n.Formatter, accent, hint lipgloss.Style) Browse {
+	t := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Name", Width: 20},
+			{Title: "Coffee", Width: 16},
+			{Title: "When", Width: 24},
+		}),
+		// One more line for the header
+		table.WithHeight(PageSize+1),
+		table.WithFocused(true),
+	)
+	// The table's own styles use the server's renderer, these use the session's
+	t.SetStyles(table.Styles{
+		Header:   hint.Bold(true).Padding(0, 1),
+		Cell:     hint.UnsetForeground().Padding(0, 1),
+		Selected: accent.Bold(true),
+	})
+	return Browse{f: f, table: t}
+}
+
+// pages is how many pages there are, at least one so an empty table is page 1 of 1
+func (b Browse) pages() int {
+	return max((b.total+PageSize-1)/PageSize, 1)
+}
+
+func (b Browse) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case BrowseMsg:
+		b.loaded = msg.At
+		b.err = msg.Err
+		if msg.Err != "" {
+			return b, nil
+		}
+		b.top, b.page, b.total = msg.Top, msg.Page, msg.Total
+		rows := make([]table.Row, len(msg.Rows))
+		for i, sub := range msg.Rows {
+			rows[i] = table.Row{sub.Value, sub.Coffee, b.f.When(sub.At, msg.At)}
+		}
+		b.table.SetRows(rows)
+		b.table.GotoTop()
+		return b, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			return b, Pop
+		case "right", "l", "pgdown":
+			if b.page+1 < b.pages() {
+				return b, b.ask(b.top, b.page+1)
+			}
+			return b, nil
+		case "left", "h", "pgup":
+			if b.page > 0 {
+				return b, b.ask(b.top, b.page-1)
+			}
+			return b, nil
+		case "r":
+			return b, b.ask(0, 0)
+		}
+	}
+	var cmd tea.Cmd
+	b.table, cmd = b.table.Update(msg)
+	return b, cmd
+}
+
+func (b Browse) ask(top int64, page int) tea.Cmd {
+	return func() tea.Msg { return PageMsg{Top: top, Page: page} }
+}
+
+func (b Browse) View() string {
+	view := "What everyone's ordering\n\n"
+	switch {
+	case b.loaded.IsZero():
+		return view + "loading…\n\nesc back"
+	case b.total == 0 && b.err == "":
+		return view + "nobody has submitted anything yet\n\nr refresh • esc back"
+	}
+	view += b.table.View() + "\n\n"
+	view += fmt.Sprintf("page %s of %s • %s submissions", b.f.Int(b.page+1), b.f.Int(b.pages()), b.f.Int(b.total))
+	if b.err != "" {
+		view += "\n\n" + b.err
+	}
+	return view + "\n\n↑/↓ scroll • ←/→ page • r newest • esc back"
+}
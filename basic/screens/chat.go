@@ -0,0 +1,149 @@
+package screens
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jwc20/wish-bubbletea-tests/basic/chat"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/layout"
+)
+
+// maxChatLength keeps messages to a line or two
+const maxChatLength = 280
+
+// Chat is the room, with what's been said above and the input below
+// It listens on its member's channel while it's open and leaves the room when it closes
+// A member who's only watching gets no input, see chat.Hub.Watch
+type Chat struct {
+	member *chat.Member
+	f      l10n.Formatter
+	lines  []chat.Message
+	here   int
+	input  textinput.Model
+	scroll viewport.Model
+	accent lipgloss.Style
+	hint   lipgloss.Style
+}
+
+// NewChat shows the room to member, starting with history, names in accent
+// and comings and goings in hint, sized for a width by height terminal
+func NewChat(member *chat.Member, history []chat.Message, f l10n.Formatter, accent, hint lipgloss.Style, width, height int) Chat {
+	input := textinput.New()
+	input.Placeholder = "say something"
+	input.CharLimit = maxChatLength
+	if !member.Watching {
+		input.Focus()
+	}
+	c := Chat{member: member, f: f, lines: history, input: input, accent: accent, hint: hint}
+	c.resize(width, height)
+	return c
+}
+
+// Listen waits for the next message in the room, the screen listens again after each one
+func (c Chat) Listen() tea.Cmd {
+	ch := c.member.C
+	return func() tea.Msg {
+		msg, ok := <-ch
+		if !ok {
+			// Left the room, nothing more is coming
+			return nil
+		}
+		return msg
+	}
+}
+
+func (c *Chat) resize(width, height int) {
+	// The title, the input and the help take six lines
+	c.scroll = viewport.New(min(max(width, 20), layout.MaxWidth), min(max(height-6, 3), 20))
+	c.input.Width = c.scroll.Width - 3
+	c.render()
+}
+
+// render fills the viewport with the lines, staying at the bottom
+func (c *Chat) render() {
+	var b strings.Builder
+	for i, msg := range c.lines {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(layout.Wrap(c.line(msg), c.scroll.Width))
+	}
+	c.scroll.SetContent(b.String())
+	c.scroll.GotoBottom()
+}
+
+func (c Chat) line(msg chat.Message) string {
+	at := c.f.Time(msg.At)
+	switch msg.Kind {
+	case chat.Joined:
+		return c.hint.Render(fmt.Sprintf("%s → %s joined", at, msg.From))
+	case chat.Left:
+		return c.hint.Render(fmt.Sprintf("%s ← %s left", at, msg.From))
+	}
+	from := c.accent.Render(msg.From + ":")
+	if msg.Badge != "" {
+		from = msg.Badge + " " + from
+	}
+	return fmt.Sprintf("%s %s %s", c.hint.Render(at), from, msg.Text)
+}
+
+func (c Chat) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case chat.Message:
+		// Copied so earlier models (e.g. time travel frames) keep the lines they had
+		c.lines = append(slices.Clip(c.lines), msg)
+		if len(c.lines) > chat.History*2 {
+			c.lines = c.lines[len(c.lines)-chat.History*2:]
+		}
+		c.here = msg.Here
+		c.render()
+		return c, c.Listen()
+	case tea.WindowSizeMsg:
+		c.resize(msg.Width, msg.Height)
+		return c, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			member := c.member
+			return c, tea.Sequence(func() tea.Msg { member.Leave(); return nil }, Pop)
+		case "enter":
+			text := strings.TrimSpace(c.input.Value())
+			if c.member.Watching {
+				return c, nil
+			}
+			if text == "" {
+				return c, nil
+			}
+			c.input.SetValue("")
+			member := c.member
+			return c, func() tea.Msg { member.Say(text); return nil }
+		case "pgup", "pgdown", "up", "down":
+			var cmd tea.Cmd
+			c.scroll, cmd = c.scroll.Update(msg)
+			return c, cmd
+		}
+	}
+	var cmd tea.Cmd
+	c.input, cmd = c.input.Update(msg)
+	return c, cmd
+}
+
+func (c Chat) View() string {
+	title := "Chat"
+	if c.here > 0 {
+		title += c.hint.Render(fmt.Sprintf(" • %s here", c.f.Int(c.here)))
+	}
+	if c.member.Watching {
+		return fmt.Sprintf("%s\n\n%s\n\n%s\n%s", title, c.scroll.View(),
+			c.hint.Render("guests can read along, talking needs a registered key"),
+			c.hint.Render("↑/↓ scroll • esc leave"))
+	}
+	return fmt.Sprintf("%s\n\n%s\n\n%s\n%s", title, c.scroll.View(), c.input.View(),
+		c.hint.Render("enter send • ↑/↓ scroll • esc leave"))
+}
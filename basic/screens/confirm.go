@@ -0,0 +1,48 @@
+package screens
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ConfirmedMsg is sent when the user confirms Values
+// The app decides what confirming means, e.g. saving them
+type ConfirmedMsg struct {
+	Values []string
+}
+
+// Confirm asks the user to check values before they're used
+type Confirm struct {
+	labels []string
+	values []string
+}
+
+// NewConfirm asks about values, each shown after the label at the same index
+func NewConfirm(labels, values []string) Confirm {
+	return Confirm{labels: labels, values: values}
+}
+
+func (c Confirm) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter", "y":
+			confirmed := func() tea.Msg { return ConfirmedMsg{Values: c.values} }
+			return c, tea.Sequence(Pop, confirmed)
+		case "esc", "n":
+			return c, Pop
+		}
+	}
+	return c, nil
+}
+
+func (c Confirm) View() string {
+	var b strings.Builder
+	b.WriteString("Save this?\n\n")
+	for i, value := range c.values {
+		fmt.Fprintf(&b, "%s: %q\n", c.labels[i], value)
+	}
+	b.WriteString("\nenter or y to save • esc or n to go back and edit")
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package screens
+
+import (
+	"fmt"
+	"strconv"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ResolvedMsg is sent when the user settles a Conflict, Value is the one they kept
+type ResolvedMsg struct {
+	What  string
+	Value string
+}
+
+// Conflict asks which of two values to keep when another session saved
+// something while this one was changing it too
+type Conflict struct {
+	what   string
+	theirs string
+	yours  string
+}
+
+// NewConflict asks about what, which another session set to theirs while this one set it to yours
+func NewConflict(what, theirs, yours string) Conflict {
+	return Conflict{what: what, theirs: theirs, yours: yours}
+}
+
+func (c Conflict) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		value := ""
+		switch msg.String() {
+		case "y":
+			value = c.yours
+		// Leaving it be keeps what's saved, nothing is overwritten by accident
+		case "t", "esc":
+			value = c.theirs
+		default:
+			return c, nil
+		}
+		resolved := func() tea.Msg { return ResolvedMsg{What: c.what, Value: value} }
+		return c, tea.Sequence(Pop, resolved)
+	}
+	return c, nil
+}
+
+func (c Conflict) View() string {
+	return fmt.Sprintf("Your %s was changed in another session while you were changing it here\n\n"+
+		"  theirs %s\n  yours  %s\n\ny to keep yours • t or esc to keep theirs", c.what, show(c.theirs), show(c.yours))
+}
+
+// show quotes value, an empty one means the default
+func show(value string) string {
+	if value == "" {
+		return "the default"
+	}
+	return strconv.Quote(value)
+}
@@ -0,0 +1,101 @@
+package screens
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// MenuMsg is sent when the user picks Item from a Menu
+type MenuMsg struct {
+	Item string
+}
+
+// MenuItem is one choice on a Menu, Name is also what MenuMsg carries
+type MenuItem struct {
+	Name string
+	Desc string
+}
+
+func (i MenuItem) Title() string       { return i.Name }
+func (i MenuItem) Description() string { return i.Desc }
+func (i MenuItem) FilterValue() string { return i.Name }
+
+// The menu doesn't fill big terminals, so it stays centered like the other screens
+const (
+	menuWidth  = 48
+	menuHeight = 22
+)
+
+// Menu lists what the app can do, ↑/↓ to move, / to filter and enter to pick
+// It stays open under whatever the app opens from it, so going back returns here
+type Menu struct {
+	list list.Model
+}
+
+// NewMenu lists items under title, the selected one drawn in accent and
+// descriptions in hint, sized for a width by height terminal
+func NewMenu(title string, items []MenuItem, accent, hint lipgloss.Style, width, height int) Menu {
+	rows := make([]list.Item, len(items))
+	for i, item := range items {
+		rows[i] = item
+	}
+	bar := lipgloss.NormalBorder()
+	d := list.NewDefaultDelegate()
+	d.Styles.SelectedTitle = accent.Bold(true).Border(bar, false, false, false, true).
+		BorderForeground(accent.GetForeground()).Padding(0, 0, 0, 1)
+	d.Styles.SelectedDesc = hint.Border(bar, false, false, false, true).
+		BorderForeground(accent.GetForeground()).Padding(0, 0, 0, 1)
+	d.Styles.NormalTitle = hint.UnsetForeground().Padding(0, 0, 0, 2)
+	d.Styles.NormalDesc = hint.Padding(0, 0, 0, 2)
+	d.Styles.DimmedTitle = hint.Padding(0, 0, 0, 2)
+	d.Styles.DimmedDesc = hint.Padding(0, 0, 0, 2)
+	d.Styles.FilterMatch = accent.Underline(true)
+
+	l := list.New(rows, d, 0, 0)
+	l.Title = title
+	// The list's own styles use the server's renderer, these use the session's
+	l.Styles.Title = accent.Bold(true)
+	l.Styles.FilterPrompt = accent
+	l.Styles.FilterCursor = accent
+	l.Styles.StatusBar = hint.Padding(0, 0, 1, 2)
+	l.Help.Styles.ShortKey = hint
+	l.Help.Styles.ShortDesc = hint
+	l.Help.Styles.ShortSeparator = hint
+	l.Help.Styles.FullKey = hint
+	l.Help.Styles.FullDesc = hint
+	l.Help.Styles.FullSeparator = hint
+	// Leaving is the app's business, q should filter like any other letter
+	l.DisableQuitKeybindings()
+	m := Menu{list: l}
+	m.resize(width, height)
+	return m
+}
+
+func (m *Menu) resize(width, height int) {
+	m.list.SetSize(min(width, menuWidth), min(height, menuHeight))
+}
+
+func (m Menu) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.resize(msg.Width, msg.Height)
+		return m, nil
+	case tea.KeyMsg:
+		// While typing a filter enter accepts it, after that it picks
+		if msg.String() == "enter" && m.list.FilterState() != list.Filtering {
+			item, ok := m.list.SelectedItem().(MenuItem)
+			if !ok {
+				return m, nil
+			}
+			return m, func() tea.Msg { return MenuMsg{Item: item.Name} }
+		}
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m Menu) View() string {
+	return m.list.View()
+}
@@ -0,0 +1,66 @@
+// Package screens is a stack based navigator for full screen views.
+// The app pushes a screen to open it and the screen pops itself to go back,
+// so adding a view doesn't mean threading another flag through the app model.
+package screens
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// Screen is one full screen view on the stack
+type Screen interface {
+	Update(tea.Msg) (Screen, tea.Cmd)
+	View() string
+}
+
+// PopMsg closes the current screen, going back to the one under it
+type PopMsg struct{}
+
+// Pop is the command a screen returns to close itself
+func Pop() tea.Msg {
+	return PopMsg{}
+}
+
+// Stack holds the open screens, the last one is showing
+// The zero value is empty, which leaves the app's own view showing
+type Stack struct {
+	screens []Screen
+}
+
+// New returns a stack with the given screens open, the last one on top
+func New(screens ...Screen) Stack {
+	return Stack{screens: screens}
+}
+
+// Empty reports whether no screen is open
+func (s Stack) Empty() bool {
+	return len(s.screens) == 0
+}
+
+// Push opens screen on top of the others
+func (s Stack) Push(screen Screen) Stack {
+	// Copied so earlier models (e.g. time travel frames) keep the stack they had
+	s.screens = append(s.screens[:len(s.screens):len(s.screens)], screen)
+	return s
+}
+
+// Update applies PopMsg and passes any other message to the top screen
+func (s Stack) Update(msg tea.Msg) (Stack, tea.Cmd) {
+	if s.Empty() {
+		return s, nil
+	}
+	top := len(s.screens) - 1
+	if _, ok := msg.(PopMsg); ok {
+		s.screens = s.screens[:top]
+		return s, nil
+	}
+	next, cmd := s.screens[top].Update(msg)
+	s.screens = append(s.screens[:top:top], next)
+	return s, cmd
+}
+
+// View renders the top screen, empty when no screen is open
+func (s Stack) View() string {
+	if s.Empty() {
+		return ""
+	}
+	return s.screens[len(s.screens)-1].View()
+}
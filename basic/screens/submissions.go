@@ -0,0 +1,141 @@
+package screens
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/l10n"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// SubmissionsMsg is what the app loaded for the Submissions screen at At
+// Status says what the last delete or restore did, Err why loading or changing failed
+type SubmissionsMsg struct {
+	At     time.Time
+	Live   []storage.Submission
+	Trash  []storage.Submission
+	Status string
+	Err    string
+}
+
+// DeleteMsg asks the app to move submission ID to the trash
+type DeleteMsg struct {
+	ID int64
+}
+
+// RestoreMsg asks the app to take submission ID out of the trash
+type RestoreMsg struct {
+	ID int64
+}
+
+// Submissions lists the user's submissions and their trash
+// The app does the loading and saving, the screen asks with DeleteMsg and
+// RestoreMsg and shows the SubmissionsMsg that comes back
+type Submissions struct {
+	f         l10n.Formatter
+	retention time.Duration
+	loaded    time.Time // zero until the first SubmissionsMsg
+	live      []storage.Submission
+	trash     []storage.Submission
+	inTrash   bool // showing the trash rather than the live list
+	cursor    int
+	status    string
+}
+
+// NewSubmissions opens the list, things in the trash are purged retention after they're deleted
+func NewSubmissions(f l10n.Formatter, retention time.Duration) Submissions {
+	return Submissions{f: f, retention: retention}
+}
+
+func (s Submissions) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case SubmissionsMsg:
+		s.loaded = msg.At
+		s.live, s.trash = msg.Live, msg.Trash
+		s.status = msg.Status
+		if msg.Err != "" {
+			s.status = msg.Err
+		}
+		s.cursor = min(s.cursor, max(len(s.shown())-1, 0))
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc", "q":
+			return s, Pop
+		case "tab":
+			s.inTrash = !s.inTrash
+			s.cursor = 0
+			s.status = ""
+		case "up", "k":
+			s.cursor = max(s.cursor-1, 0)
+		case "down", "j":
+			s.cursor = min(s.cursor+1, max(len(s.shown())-1, 0))
+		case "d", "delete":
+			if sub, ok := s.selected(); ok && !s.inTrash {
+				return s, func() tea.Msg { return DeleteMsg{ID: sub.ID} }
+			}
+		case "u":
+			if sub, ok := s.selected(); ok && s.inTrash {
+				return s, func() tea.Msg { return RestoreMsg{ID: sub.ID} }
+			}
+		}
+	}
+	return s, nil
+}
+
+// shown is the list on screen, the live one or the trash
+func (s Submissions) shown() []storage.Submission {
+	if s.inTrash {
+		return s.trash
+	}
+	return s.live
+}
+
+func (s Submissions) selected() (storage.Submission, bool) {
+	shown := s.shown()
+	if s.cursor >= len(shown) {
+		return storage.Submission{}, false
+	}
+	return shown[s.cursor], true
+}
+
+func (s Submissions) View() string {
+	var b strings.Builder
+	if s.inTrash {
+		fmt.Fprintf(&b, "Your trash (%s)\n\n", s.f.Int(len(s.trash)))
+	} else {
+		fmt.Fprintf(&b, "Your submissions (%s)\n\n", s.f.Int(len(s.live)))
+	}
+	shown := s.shown()
+	switch {
+	case s.loaded.IsZero():
+		b.WriteString("loading…\n")
+	case len(shown) == 0 && s.inTrash:
+		b.WriteString("the trash is empty\n")
+	case len(shown) == 0:
+		b.WriteString("nothing saved yet\n")
+	}
+	for i, sub := range shown {
+		cursor := "  "
+		if i == s.cursor {
+			cursor = "> "
+		}
+		when := "saved " + s.f.When(sub.At, s.loaded)
+		if s.inTrash {
+			when = "kept until " + s.f.Date(sub.DeletedAt.Add(s.retention))
+		}
+		what := fmt.Sprintf("%q", sub.Value)
+		if sub.Coffee != "" {
+			what += ", " + sub.Coffee
+		}
+		fmt.Fprintf(&b, "%s%s • %s\n", cursor, what, when)
+	}
+	if s.status != "" {
+		b.WriteString("\n" + s.status + "\n")
+	}
+	if s.inTrash {
+		return b.String() + "\nu restore • tab your submissions • esc back"
+	}
+	return b.String() + "\nd move to trash • tab trash • esc back"
+}
@@ -0,0 +1,60 @@
+package screens
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TimeZoneMsg is sent when the user picks the time zone Name, an IANA name like Europe/Berlin
+type TimeZoneMsg struct {
+	Name string
+}
+
+// TimeZone lets the user type the time zone times are shown in
+type TimeZone struct {
+	input textinput.Model
+	err   string
+}
+
+// NewTimeZone asks for a time zone, starting from current
+func NewTimeZone(current string) TimeZone {
+	input := textinput.New()
+	input.Placeholder = "Europe/Berlin"
+	input.Width = 30
+	input.SetValue(current)
+	input.Focus()
+	return TimeZone{input: input}
+}
+
+func (z TimeZone) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			name := strings.TrimSpace(z.input.Value())
+			if _, err := time.LoadLocation(name); err != nil || name == "" {
+				z.err = fmt.Sprintf("%q isn't a time zone, try one like America/New_York", name)
+				return z, nil
+			}
+			picked := func() tea.Msg { return TimeZoneMsg{Name: name} }
+			return z, tea.Sequence(Pop, picked)
+		case "esc":
+			return z, Pop
+		}
+		z.err = ""
+	}
+	var cmd tea.Cmd
+	z.input, cmd = z.input.Update(msg)
+	return z, cmd
+}
+
+func (z TimeZone) View() string {
+	view := "Your time zone\n\n" + z.input.View()
+	if z.err != "" {
+		view += "\n\n" + z.err
+	}
+	return view + "\n\nenter to save • esc to go back"
+}
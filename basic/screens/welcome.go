@@ -0,0 +1,31 @@
+package screens
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Welcome greets the user before the input screen
+type Welcome struct {
+	name   string
+	avatar string
+	style  lipgloss.Style
+}
+
+// NewWelcome greets name, with their avatar above and name drawn in style
+func NewWelcome(name, avatar string, style lipgloss.Style) Welcome {
+	return Welcome{name: name, avatar: avatar, style: style}
+}
+
+func (w Welcome) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && msg.String() == "enter" {
+		return w, Pop
+	}
+	return w, nil
+}
+
+func (w Welcome) View() string {
+	return fmt.Sprintf("%s\n\nWelcome, %s!\n\nenter to start • ctrl+c to leave", w.avatar, w.style.Render(w.name))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+	"github.com/jwc20/wish-bubbletea-tests/basic/secrets"
+)
+
+// secretsURI is where secrets are loaded from, set by --secrets
+var secretsURI string
+
+// secretStore is the provider at secretsURI, nil until openSecrets
+var secretStore secrets.Provider
+
+// openSecrets opens the provider at secretsURI, if there is one
+// Its background work, renewing the Vault token, stops when ctx is done
+func openSecrets(ctx context.Context) error {
+	if secretsURI == "" {
+		return nil
+	}
+	provider, err := secrets.Open(ctx, secretsURI, time.Hour, outboundPolicies.Get(outbound.Vault).Client())
+	if err != nil {
+		return err
+	}
+	secretStore = provider
+	return nil
+}
+
+// secret looks up name for the flag that asked for it
+func secret(ctx context.Context, flag, name string) (string, error) {
+	if secretsURI == "" {
+		return "", fmt.Errorf("%s needs --secrets to say where secrets live", flag)
+	}
+	if secretStore == nil {
+		return "", errors.New("--secrets could not be opened")
+	}
+	value, err := secretStore.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("%s %q: %w", flag, name, err)
+	}
+	return value, nil
+}
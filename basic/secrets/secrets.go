@@ -0,0 +1,92 @@
+// Package secrets loads sensitive values (host keys, passwords, API keys)
+// from somewhere safer than a plaintext config file.
+//
+// A provider is picked with a URI:
+//
+//	vault://secret/basic     HashiCorp Vault KV v2, mount "secret", path "basic"
+//	sops://secrets.enc.yaml  a SOPS-encrypted file, decrypted with the sops CLI
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a provider has no value for a key
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up secret values by key
+type Provider interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// Open returns the provider for uri, wrapped in a cache that refreshes values after ttl
+// Background work such as renewing the Vault token stops when ctx is done
+// client makes the calls to providers with an HTTP API, i.e. Vault
+func Open(ctx context.Context, uri string, ttl time.Duration, client *http.Client) (Provider, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("secrets uri %q: %w", uri, err)
+	}
+
+	var p Provider
+	switch u.Scheme {
+	case "vault":
+		var v *vault
+		if v, err = newVault(u.Host, u.Path, client); err == nil {
+			go v.renewToken(ctx, ttl)
+			p = v
+		}
+	case "sops":
+		p = &sops{file: u.Host + u.Path}
+	default:
+		return nil, fmt.Errorf("secrets uri %q: unknown provider %q (want vault or sops)", uri, u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cache{p: p, ttl: ttl, entries: map[string]entry{}}, nil
+}
+
+// cache keeps values around for ttl so every lookup doesn't hit Vault or run sops
+// After ttl the value is fetched again, which picks up rotated secrets
+type cache struct {
+	p   Provider
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	value   string
+	fetched time.Time
+}
+
+func (c *cache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(e.fetched) < c.ttl {
+		return e.value, nil
+	}
+
+	value, err := c.p.Get(ctx, key)
+	if err != nil {
+		// Keep serving the old value if the backend is briefly unreachable
+		if ok && !errors.Is(err, ErrNotFound) {
+			return e.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry{value: value, fetched: time.Now()}
+	c.mu.Unlock()
+	return value, nil
+}
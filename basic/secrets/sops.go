@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sops decrypts a SOPS file with the sops CLI, which already knows how to
+// talk to age, PGP and the cloud KMS services the file was encrypted with
+type sops struct {
+	file string
+}
+
+// Get returns the value at key, using dots for nested fields (e.g. "smtp.password")
+func (s *sops) Get(ctx context.Context, key string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sops", "--decrypt", "--output-type", "json", s.file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("sops %s: %w: %s", s.file, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var doc any
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return "", fmt.Errorf("sops %s: %w", s.file, err)
+	}
+	for _, part := range strings.Split(key, ".") {
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return "", ErrNotFound
+		}
+		if doc, ok = m[part]; !ok {
+			return "", ErrNotFound
+		}
+	}
+	value, ok := doc.(string)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vault reads a KV v2 secret over the Vault HTTP API
+// The address and token come from the usual VAULT_ADDR and VAULT_TOKEN variables
+type vault struct {
+	addr   string
+	token  string
+	mount  string
+	path   string
+	client *http.Client
+}
+
+func newVault(mount, path string, client *http.Client) (*vault, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("vault secrets need VAULT_ADDR and VAULT_TOKEN set")
+	}
+	return &vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  mount,
+		path:   strings.TrimPrefix(path, "/"),
+		client: client,
+	}, nil
+}
+
+// Get returns one field of the secret at the provider's path
+func (v *vault) Get(ctx context.Context, key string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", v.addr, v.mount, v.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s returned %s", url, resp.Status)
+	}
+
+	// KV v2 nests the fields under data.data
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	value, ok := body.Data.Data[key].(string)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// renewToken extends the token's lease every interval until ctx is done
+// Failures are ignored, a token that can't be renewed simply expires as configured
+func (v *vault) renewToken(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.addr+"/v1/auth/token/renew-self", nil)
+			if err != nil {
+				return
+			}
+			req.Header.Set("X-Vault-Token", v.token)
+			if resp, err := v.client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+)
+
+// demoUsers are the made up people `seed` adds
+// Their fingerprints aren't real keys, so nobody can log in as them
+var demoUsers = []struct {
+	fingerprint, name, accent string
+	submissions               []string
+}{
+	{"SHA256:demo-ada", "ada", "#FF5F87", []string{"Ada Lovelace", "hello from the analytical engine"}},
+	{"SHA256:demo-grace", "grace", "#5FAFFF", []string{"Grace Hopper", "it's easier to ask forgiveness"}},
+	{"SHA256:demo-linus", "linus", "#87D75F", []string{"Linus", "talk is cheap 🐧"}},
+	{"SHA256:demo-margaret", "margaret", "#FFAF00", []string{"Margaret Hamilton"}},
+}
+
+// seedCommand fills a fresh deployment with demo users and submissions
+// so there's something to look at straight away
+// Users are only created once, submissions only when the database is empty,
+// so running it twice doesn't double anything up
+func seedCommand() int {
+	for _, d := range demoUsers {
+		if _, err := userStore.FindOrCreate(d.fingerprint, d.name, now()); err != nil {
+			fmt.Println("✗ users:", err)
+			return exitError
+		}
+		err := userStore.UpdatePrefs(d.fingerprint, func(p *user.Prefs) { p.Accent = d.accent })
+		if err != nil {
+			fmt.Println("✗ users:", err)
+			return exitError
+		}
+	}
+	fmt.Printf("✓ %d demo users\n", len(demoUsers))
+
+	existing, err := submissionStore.List()
+	if err != nil {
+		fmt.Println("✗ submissions:", err)
+		return exitError
+	}
+	if len(existing) > 0 {
+		fmt.Printf("- submissions already has %d rows, leaving it alone\n", len(existing))
+		return exitOK
+	}
+	n := 0
+	for _, d := range demoUsers {
+		for _, value := range d.submissions {
+			if _, err := submissionStore.Save(storage.Submission{User: d.name, Owner: d.fingerprint, Value: value}, nil); err != nil {
+				fmt.Println("✗ submissions:", err)
+				return exitError
+			}
+			n++
+		}
+	}
+	fmt.Printf("✓ %d demo submissions\n", n)
+	return exitOK
+}
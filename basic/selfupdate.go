@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+)
+
+// releaseKey is the base64 ed25519 public key release binaries are signed with,
+// set at build time with -ldflags "-X main.releaseKey=..."
+// Without it self-update refuses to run, an unverified binary is never installed
+var releaseKey = ""
+
+// maxReleaseSize caps the download so a bad URL can't fill the disk
+const maxReleaseSize = 256 << 20
+
+// releaseAsset is the binary for this platform, e.g. basic_linux_amd64
+func releaseAsset() string {
+	return fmt.Sprintf("basic_%s_%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// manifestAsset lists a release's version and the sha256 of each of its
+// binaries, and is what's signed: manifestAsset+".sig" holds its base64
+// ed25519 signature
+// The version is taken from it rather than the release's tag, which isn't
+// signed, so an older signed release can't be passed off as a newer one
+const manifestAsset = "manifest.json"
+
+// releaseManifest is what manifestAsset holds
+type releaseManifest struct {
+	Version string            `json:"version"`
+	SHA256  map[string]string `json:"sha256"` // hex, by asset name
+}
+
+// selfUpdateCommand replaces the running binary with the latest signed release
+//
+//	basic self-update [-url URL] [-force] [-restart PID]
+//
+// -restart sends SIGTERM to a running server once the new binary is in place,
+// so it drains its sessions and its supervisor starts the new version
+func selfUpdateCommand(args []string, defaultURL string) int {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	url := fs.String("url", defaultURL, "release URL, e.g. https://api.github.com/repos/OWNER/REPO/releases/latest (defaults to --update-check)")
+	force := fs.Bool("force", false, "install the release even if it isn't newer than this build")
+	restart := fs.Int("restart", 0, "pid of a running server to restart gracefully after updating")
+	if err := fs.Parse(args); err != nil {
+		return exitConfig
+	}
+	if *url == "" {
+		fmt.Fprintln(os.Stderr, "self-update: no release URL, pass -url or --update-check")
+		return exitConfig
+	}
+	key, err := base64.StdEncoding.DecodeString(releaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		fmt.Fprintln(os.Stderr, "self-update: this build has no release signing key, rebuild with -X main.releaseKey=...")
+		return exitConfig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	tag, assets, err := fetchRelease(ctx, *url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-update: %v\n", err)
+		return exitTempFail
+	}
+	manifest, err := signedManifest(ctx, key, tag, assets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-update: %v\n", err)
+		return exitError
+	}
+	if !*force && !newerVersion(manifest.Version, version) {
+		fmt.Printf("already up to date (running %s, latest %s)\n", version, manifest.Version)
+		return exitOK
+	}
+
+	name := releaseAsset()
+	binURL, want := assets[name], manifest.SHA256[name]
+	if binURL == "" || want == "" {
+		fmt.Fprintf(os.Stderr, "self-update: release %s has no %s\n", manifest.Version, name)
+		return exitError
+	}
+	bin, err := download(ctx, binURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-update: %v\n", err)
+		return exitTempFail
+	}
+	if sum := sha256.Sum256(bin); hex.EncodeToString(sum[:]) != strings.ToLower(want) {
+		fmt.Fprintf(os.Stderr, "self-update: %s doesn't match the signed manifest, not installing it\n", name)
+		return exitError
+	}
+	tag = manifest.Version
+
+	path, err := replaceExecutable(bin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-update: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("updated %s from %s to %s\n", path, version, tag)
+
+	if *restart != 0 {
+		p, err := os.FindProcess(*restart)
+		if err == nil {
+			err = p.Signal(syscall.SIGTERM)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "self-update: could not restart pid %d: %v\n", *restart, err)
+			return exitError
+		}
+		fmt.Printf("asked pid %d to drain and restart\n", *restart)
+	}
+	return exitOK
+}
+
+// signedManifest downloads the release's manifest and checks its signature against key
+func signedManifest(ctx context.Context, key ed25519.PublicKey, tag string, assets map[string]string) (releaseManifest, error) {
+	var m releaseManifest
+	manifestURL, sigURL := assets[manifestAsset], assets[manifestAsset+".sig"]
+	if manifestURL == "" || sigURL == "" {
+		return m, fmt.Errorf("release %s has no %s and %s.sig", tag, manifestAsset, manifestAsset)
+	}
+	data, err := download(ctx, manifestURL)
+	if err != nil {
+		return m, err
+	}
+	sig, err := download(ctx, sigURL)
+	if err != nil {
+		return m, err
+	}
+	sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return m, fmt.Errorf("release %s has a bad signature on its %s, not installing it", tag, manifestAsset)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%s: %w", manifestAsset, err)
+	}
+	return m, nil
+}
+
+// fetchRelease reads a GitHub style release, returning its tag and asset download URLs by name
+func fetchRelease(ctx context.Context, url string) (string, map[string]string, error) {
+	body, err := download(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return "", nil, fmt.Errorf("release %s: %w", url, err)
+	}
+	assets := map[string]string{}
+	for _, a := range release.Assets {
+		assets[a.Name] = a.URL
+	}
+	return release.TagName, assets, nil
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := outboundPolicies.Get(outbound.SelfUpdate).Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if len(body) > maxReleaseSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", url, maxReleaseSize)
+	}
+	return body, nil
+}
+
+// replaceExecutable swaps the running binary for bin
+// The new file is written next to the old one and renamed over it,
+// so the path always holds either the old binary or the new one, never half of one
+func replaceExecutable(bin []byte) (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(bin)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.Join(errors.New("could not replace "+path), err)
+	}
+	return path, nil
+}
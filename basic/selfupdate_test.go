@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveRelease serves files by name and returns the asset URLs fetchRelease would
+func serveRelease(t *testing.T, files map[string]string) map[string]string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path[1:]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	assets := map[string]string{}
+	for name := range files {
+		assets[name] = srv.URL + "/" + name
+	}
+	return assets
+}
+
+func TestSignedManifest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"version":"v1.2.0","sha256":{"basic_linux_amd64":"00ff"}}`
+	sign := func(key ed25519.PrivateKey, data string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(data))) + "\n"
+	}
+
+	assets := serveRelease(t, map[string]string{
+		manifestAsset:          manifest,
+		manifestAsset + ".sig": sign(priv, manifest),
+	})
+	m, err := signedManifest(context.Background(), pub, "v1.2.0", assets)
+	if err != nil {
+		t.Fatalf("good signature refused: %v", err)
+	}
+	if m.Version != "v1.2.0" || m.SHA256["basic_linux_amd64"] != "00ff" {
+		t.Errorf("manifest = %+v", m)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		key   ed25519.PublicKey
+		files map[string]string
+	}{
+		{"tampered manifest", pub, map[string]string{
+			manifestAsset:          `{"version":"v9.9.9","sha256":{"basic_linux_amd64":"00ff"}}`,
+			manifestAsset + ".sig": sign(priv, manifest),
+		}},
+		{"signed with another key", pub, map[string]string{
+			manifestAsset:          manifest,
+			manifestAsset + ".sig": sign(otherPriv, manifest),
+		}},
+		{"checked against another key", otherPub, map[string]string{
+			manifestAsset:          manifest,
+			manifestAsset + ".sig": sign(priv, manifest),
+		}},
+		{"signature isn't base64", pub, map[string]string{
+			manifestAsset:          manifest,
+			manifestAsset + ".sig": "not a signature",
+		}},
+		{"no signature", pub, map[string]string{
+			manifestAsset: manifest,
+		}},
+		{"no manifest", pub, map[string]string{
+			manifestAsset + ".sig": sign(priv, manifest),
+		}},
+	} {
+		if _, err := signedManifest(context.Background(), tt.key, "v1.2.0", serveRelease(t, tt.files)); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
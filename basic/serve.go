@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// Exit codes follow sysexits.h so process managers can tell failures apart
+// e.g. systemd's RestartPreventExitStatus=78 stops restart loops on bad config
+const (
+	exitOK = 0
+	// exitError means the server failed while running, restarting is reasonable
+	exitError = 1
+	// exitTempFail means binding kept failing with errors that may clear up later
+	exitTempFail = 75
+	// exitConfig means something permanent is wrong (bad host key, privileged port)
+	exitConfig = 78
+)
+
+// retryPolicy controls how often a failed bind is retried and how long to wait
+type retryPolicy struct {
+	attempts int
+	initial  time.Duration
+	max      time.Duration
+}
+
+// errPermanent wraps bind errors that retrying won't fix
+type errPermanent struct{ err error }
+
+func (e errPermanent) Error() string { return e.err.Error() }
+func (e errPermanent) Unwrap() error { return e.err }
+
+// listen binds addr, retrying transient failures with exponential backoff
+// This covers restarts where the old process still holds the port for a moment
+func listen(ctx context.Context, addr string, p retryPolicy) (net.Listener, error) {
+	wait := p.initial
+	for attempt := 1; ; attempt++ {
+		ln, err := net.Listen("tcp", addr)
+		if err == nil {
+			return ln, nil
+		}
+		if !transient(err) {
+			return nil, errPermanent{err}
+		}
+		if attempt >= p.attempts {
+			return nil, err
+		}
+
+		log.Warn("Could not bind, retrying", "addr", addr, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, p.max)
+	}
+}
+
+// transient reports whether a bind error may go away on its own
+// A busy port gets freed, an address appears once the interface comes up,
+// but a privileged port or a malformed address never fixes itself
+func transient(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.EADDRNOTAVAIL)
+}
+
+// exitCodeFor maps a listen error to the process exit code
+func exitCodeFor(err error) int {
+	var perm errPermanent
+	switch {
+	case errors.As(err, &perm):
+		return exitConfig
+	case errors.Is(err, context.Canceled):
+		return exitOK
+	default:
+		return exitTempFail
+	}
+}
@@ -0,0 +1,84 @@
+package sessionlog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile appends to a file, moving it aside once it grows past maxSize
+// path.1 is the newest old file, path.<keep> the oldest, anything older is removed
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotating(path string, maxSize int64, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens path for appending; callers must hold r.mu, or own r
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write writes p whole, rotating first if it would take the file past maxSize
+// Lines are never split across files
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and starts a new file;
+// callers must hold r.mu
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+	for n := r.keep - 1; n >= 1; n-- {
+		// Old files that don't exist yet are fine to skip
+		os.Rename(fmt.Sprintf("%s.%d", r.path, n), fmt.Sprintf("%s.%d", r.path, n+1))
+	}
+	if r.keep > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
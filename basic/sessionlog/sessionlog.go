@@ -0,0 +1,122 @@
+// Package sessionlog writes a structured log of every session as JSON lines:
+// when it connected and disconnected, window resizes and submissions.
+//
+// Each session gets a random UUID that's on every line it logs, so one
+// session's lines can be pulled out of a busy log with a single grep.
+// The file is rotated by size, keeping a few old files next to it.
+package sessionlog
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Logger writes session logs to a rotating file, safe for every session to share
+type Logger struct {
+	file   *rotatingFile
+	logger *log.Logger
+}
+
+// Open logs to the file at path, moving it to path.1 once it reaches maxSize bytes
+// and keeping up to keep old files
+func Open(path string, maxSize int64, keep int) (*Logger, error) {
+	f, err := openRotating(path, maxSize, keep)
+	if err != nil {
+		return nil, err
+	}
+	logger := log.NewWithOptions(f, log.Options{
+		Formatter:       log.JSONFormatter,
+		ReportTimestamp: true,
+		TimeFormat:      time.RFC3339Nano,
+	})
+	return &Logger{file: f, logger: logger}, nil
+}
+
+// Close closes the file
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Session logs for one session, with its ID on every line
+// A nil Session logs nothing, for sessions that aren't logged
+type Session struct {
+	id     string
+	logger *log.Logger
+}
+
+// contextKey stores the session's *Session in the ssh context
+type contextKey struct{}
+
+// Middleware gives each session an ID and logs when it connects and disconnects
+// Operators also get a line for each in the server log, tagged with the same ID,
+// which is all a nil Logger writes
+func (l *Logger) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			id := newID()
+			var session *Session
+			if l != nil {
+				session = &Session{id: id, logger: l.logger.With("session", id)}
+				s.Context().SetValue(contextKey{}, session)
+			}
+
+			pty, _, hasPty := s.Pty()
+			log.Info("Session connected", "session", id, "user", s.User(), "remote", s.RemoteAddr())
+			session.Log("connect",
+				"user", s.User(),
+				"remote", s.RemoteAddr().String(),
+				"client", s.Context().ClientVersion(),
+				"key", s.PublicKey() != nil,
+				"command", s.Command(),
+				"term", pty.Term,
+				"pty", hasPty,
+				"width", pty.Window.Width,
+				"height", pty.Window.Height,
+			)
+			start := time.Now()
+			next(s)
+			duration := time.Since(start).Round(time.Millisecond)
+			log.Info("Session disconnected", "session", id, "user", s.User(), "duration", duration)
+			session.Log("disconnect", "duration", duration.String())
+		}
+	}
+}
+
+// FromContext returns the session's logger, nil if Middleware didn't run
+func FromContext(ctx ssh.Context) *Session {
+	s, _ := ctx.Value(contextKey{}).(*Session)
+	return s
+}
+
+// ID is the session's correlation ID, empty for a nil Session
+func (s *Session) ID() string {
+	if s == nil {
+		return ""
+	}
+	return s.id
+}
+
+// Log writes one event with key value pairs of detail
+func (s *Session) Log(event string, keyvals ...any) {
+	if s == nil {
+		return
+	}
+	s.logger.Info(event, keyvals...)
+}
+
+// newID returns a random (version 4) UUID
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,162 @@
+// Package sessions keeps a registry of the SSH sessions that are currently
+// connected, so middleware, operator commands and admin views can list them
+// and disconnect the ones that need to go.
+package sessions
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Info describes one connected session
+type Info struct {
+	ID        uint64
+	User      string
+	Remote    string
+	Connected time.Time
+	Width     int
+	Height    int
+}
+
+// Registry tracks every session that passes through its Middleware
+type Registry struct {
+	mu       sync.Mutex
+	nextID   uint64
+	sessions map[uint64]*Handle
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{sessions: map[uint64]*Handle{}}
+}
+
+// Handle is one session's entry in the registry
+// A nil Handle does nothing, for sessions that aren't registered
+type Handle struct {
+	r       *Registry
+	info    Info
+	session ssh.Session
+}
+
+// contextKey stores the session's *Handle in the ssh context
+type contextKey struct{}
+
+// Middleware registers each session for as long as it runs
+func (r *Registry) Middleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			h := r.add(s)
+			defer r.remove(h)
+			s.Context().SetValue(contextKey{}, h)
+			next(s)
+		}
+	}
+}
+
+func (r *Registry) add(s ssh.Session) *Handle {
+	pty, _, _ := s.Pty()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	h := &Handle{
+		r: r,
+		info: Info{
+			ID:        r.nextID,
+			User:      user.CleanName(s.User()),
+			Remote:    s.RemoteAddr().String(),
+			Connected: time.Now(),
+			Width:     pty.Window.Width,
+			Height:    pty.Window.Height,
+		},
+		session: s,
+	}
+	r.sessions[h.info.ID] = h
+	return h
+}
+
+func (r *Registry) remove(h *Handle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, h.info.ID)
+}
+
+// List returns the connected sessions, oldest first
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Info, 0, len(r.sessions))
+	for _, h := range r.sessions {
+		list = append(list, h.info)
+	}
+	slices.SortFunc(list, func(a, b Info) int { return cmp.Compare(a.ID, b.ID) })
+	return list
+}
+
+// Len returns how many sessions are connected
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+// Kill disconnects session id, telling the user why first
+// It reports false when there is no such session
+func (r *Registry) Kill(id uint64, reason string) bool {
+	r.mu.Lock()
+	h, ok := r.sessions[id]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	fmt.Fprintf(h.session.Stderr(), "\r\nDisconnected: %s\r\n", reason)
+	// Closing the connection rather than the channel makes sure the program
+	// and anything else the client had open goes away with it
+	if conn, ok := h.session.Context().Value(ssh.ContextKeyConn).(gossh.Conn); ok {
+		conn.Close()
+	} else {
+		h.session.Close()
+	}
+	return true
+}
+
+// FromContext returns the session's handle, nil when it isn't registered
+func FromContext(ctx ssh.Context) *Handle {
+	h, _ := ctx.Value(contextKey{}).(*Handle)
+	return h
+}
+
+// ID returns the session's registry ID, 0 for a nil Handle
+func (h *Handle) ID() uint64 {
+	if h == nil {
+		return 0
+	}
+	return h.info.ID
+}
+
+// SetUser records who the session turned out to be, e.g. after a handoff
+func (h *Handle) SetUser(name string) {
+	if h == nil {
+		return
+	}
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	h.info.User = user.CleanName(name)
+}
+
+// Resize records the client's new window size
+func (h *Handle) Resize(width, height int) {
+	if h == nil {
+		return
+	}
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	h.info.Width, h.info.Height = width, height
+}
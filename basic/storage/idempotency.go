@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+)
+
+// ErrKeyReused is returned when an idempotency key comes back with a different request
+var ErrKeyReused = errors.New("that idempotency key was already used for a different request")
+
+// Once identifies a write a client may retry: Key is the client's name for
+// it, unique to Owner, and Fingerprint sums up the request so a key sent
+// again with something else isn't mistaken for a retry
+type Once struct {
+	Owner       string
+	Key         string
+	Fingerprint string
+}
+
+// SaveOnce is Save for a request that may be retried
+// The first time once's key is seen the submission is saved, and respond's
+// result is stored with the key in the same transaction; after that the
+// stored response comes back, replayed is true and nothing is saved
+func (s *Store) SaveOnce(once Once, sub Submission, notify func(Submission) []Message, respond func(id int64) string) (response string, replayed bool, err error) {
+	return s.once(once, func(tx *sql.Tx) (string, error) {
+		id, err := save(tx, sub, notify)
+		if err != nil {
+			return "", err
+		}
+		return respond(id), nil
+	})
+}
+
+// AppendOnce is Append for a request that may be retried, see SaveOnce
+// next builds the event from order id as it is inside the transaction, so a
+// retry gets the stored response back rather than an error about the order
+// having moved on since
+func (s *Store) AppendOnce(once Once, id int64, next func(orders.Order) (orders.Event, error), respond func(orders.Event) string) (response string, replayed bool, err error) {
+	response, replayed, err = s.once(once, func(tx *sql.Tx) (string, error) {
+		events, err := events(tx, id)
+		if err != nil {
+			return "", err
+		}
+		all, _ := orders.Project(events)
+		if len(all) == 0 {
+			return "", ErrNotFound
+		}
+		e, err := next(all[0])
+		if err != nil {
+			return "", err
+		}
+		if err := appendEvent(tx, e); err != nil {
+			return "", err
+		}
+		return respond(e), nil
+	})
+	if isUnique(err) {
+		return "", false, ErrConflict
+	}
+	return response, replayed, err
+}
+
+// Forget removes idempotency keys first used before cutoff, a retry after
+// that is a new request
+func (s *Store) Forget(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE at < ?`, cutoff.UTC().Format(deletedLayout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// once runs write and stores its response under once's key, or returns the
+// response already stored there
+// The database has a single connection, so nothing else runs between the
+// lookup and the write
+func (s *Store) once(once Once, write func(*sql.Tx) (string, error)) (string, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	var fingerprint, response string
+	err = tx.QueryRow(`SELECT fingerprint, response FROM idempotency_keys WHERE owner = ? AND key = ?`,
+		once.Owner, once.Key).Scan(&fingerprint, &response)
+	switch {
+	case err == nil && fingerprint != once.Fingerprint:
+		return "", false, ErrKeyReused
+	case err == nil:
+		return response, true, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return "", false, err
+	}
+	if response, err = write(tx); err != nil {
+		return "", false, err
+	}
+	_, err = tx.Exec(`INSERT INTO idempotency_keys (owner, key, fingerprint, response, at) VALUES (?, ?, ?, ?, ?)`,
+		once.Owner, once.Key, once.Fingerprint, response, time.Now().UTC().Format(deletedLayout))
+	if err != nil {
+		return "", false, err
+	}
+	return response, false, tx.Commit()
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Message is a notification waiting in the outbox to be delivered, see the
+// outbox package
+// It's written in the same transaction as the change it's about, so one
+// can't be saved without the other
+type Message struct {
+	ID int64
+	// Kind says what delivers it, e.g. webhook, slack or email
+	Kind string
+	// To is a URL or an email address, depending on Kind
+	To      string
+	Subject string // emails only
+	Body    string
+	// Attempts counts deliveries started, including the one being made
+	Attempts  int
+	LastError string
+}
+
+const outboxColumns = `id, kind, recipient, subject, body, attempts, last_error`
+
+// enqueue writes m to the outbox, due straight away
+func enqueue(db execer, m Message, at time.Time) error {
+	_, err := db.Exec(`INSERT INTO outbox (at, kind, recipient, subject, body, next_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		at.Format(time.RFC3339Nano), m.Kind, m.To, m.Subject, m.Body, at.Format(deletedLayout))
+	return err
+}
+
+// Claim returns up to n messages due by now and holds them for lease, so
+// neither another dispatcher nor the next round picks them up while they're
+// being sent
+// A dispatcher that dies mid-send leaves them to be claimed again once the
+// lease is up, so they're delivered at least once
+func (s *Store) Claim(now time.Time, lease time.Duration, n int) ([]Message, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT `+outboxColumns+` FROM outbox
+		WHERE next_at IS NOT NULL AND next_at <= ? ORDER BY next_at, id LIMIT ?`, now.UTC().Format(deletedLayout), n)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.Kind, &m.To, &m.Subject, &m.Body, &m.Attempts, &m.LastError); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.Attempts++
+		msgs = append(msgs, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	until := now.Add(lease).UTC().Format(deletedLayout)
+	for _, m := range msgs {
+		if _, err := tx.Exec(`UPDATE outbox SET attempts = ?, next_at = ? WHERE id = ?`, m.Attempts, until, m.ID); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, tx.Commit()
+}
+
+// Delivered marks message id as sent at, it's never claimed again
+func (s *Store) Delivered(id int64, at time.Time) error {
+	return s.change(`UPDATE outbox SET next_at = NULL, sent_at = ?, last_error = '' WHERE id = ?`,
+		at.UTC().Format(time.RFC3339Nano), id)
+}
+
+// Defer puts message id back until, without counting the claim as an
+// attempt, for when it wasn't sent at all
+func (s *Store) Defer(id int64, until time.Time) error {
+	return s.change(`UPDATE outbox SET next_at = ?, attempts = MAX(attempts - 1, 0) WHERE id = ?`,
+		until.UTC().Format(deletedLayout), id)
+}
+
+// Retry records why delivering message id failed and when to try again,
+// a zero next gives up on it
+func (s *Store) Retry(id int64, reason string, next time.Time) error {
+	var nextAt sql.NullString
+	if !next.IsZero() {
+		nextAt = sql.NullString{String: next.UTC().Format(deletedLayout), Valid: true}
+	}
+	return s.change(`UPDATE outbox SET next_at = ?, last_error = ? WHERE id = ?`, nextAt, reason, id)
+}
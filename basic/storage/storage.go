@@ -0,0 +1,409 @@
+// Package storage keeps submitted values in a SQLite database so they
+// survive restarts and can be queried later.
+//
+// Deleting a submission moves it to the trash, where it can be restored
+// until Purge removes it for good.
+//
+// Each submission is also an order for its coffee, kept as the order's
+// events, see the orders package.
+//
+// Notifications about a submission go in the outbox table in the same
+// transaction, and are delivered from there, see the outbox package.
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jwc20/wish-bubbletea-tests/basic/orders"
+	// Pure Go driver, so CGO_ENABLED=0 builds keep working
+	_ "modernc.org/sqlite"
+)
+
+// Submission is one value a user submitted
+type Submission struct {
+	ID   int64
+	At   time.Time
+	User string
+	// Owner is the key fingerprint it was submitted with, "user:" and the name
+	// for sessions without a key; it's who can delete and restore it
+	// Submissions from before owners were kept have none, only admins can move them
+	Owner string
+	// Value is the name the user gave, Email and Coffee the rest of the form
+	Value  string
+	Email  string
+	Coffee string
+	// DeletedAt is when it was moved to the trash, zero if it wasn't
+	DeletedAt time.Time
+}
+
+// ErrConflict is returned by Append when the order has moved on since it was loaded
+var ErrConflict = errors.New("the order changed, load it again")
+
+// ErrNotFound is returned for submissions that don't exist, aren't the user's,
+// or aren't where the call expects them, e.g. restoring one that isn't in the trash
+var ErrNotFound = errors.New("no such submission")
+
+// ErrNoUser is returned when a call that's scoped to a user is given none,
+// admins use the calls that aren't scoped instead
+var ErrNoUser = errors.New("no user given")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS submissions (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	at    TEXT NOT NULL,
+	user  TEXT NOT NULL,
+	value TEXT NOT NULL,
+	deleted_at TEXT,
+	email  TEXT NOT NULL DEFAULT '',
+	coffee TEXT NOT NULL DEFAULT '',
+	owner  TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS submissions_user ON submissions (user);
+CREATE TABLE IF NOT EXISTS order_events (
+	order_id INTEGER NOT NULL,
+	seq      INTEGER NOT NULL,
+	type     TEXT NOT NULL,
+	at       TEXT NOT NULL,
+	actor    TEXT NOT NULL,
+	item     TEXT NOT NULL DEFAULT '',
+	-- Two sessions appending the same event number can't both succeed
+	PRIMARY KEY (order_id, seq)
+);
+CREATE TABLE IF NOT EXISTS outbox (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	at        TEXT NOT NULL,
+	kind      TEXT NOT NULL,
+	recipient TEXT NOT NULL,
+	subject   TEXT NOT NULL DEFAULT '',
+	body      TEXT NOT NULL,
+	attempts  INTEGER NOT NULL DEFAULT 0,
+	-- When it can be claimed next, NULL once it's sent or given up on
+	next_at    TEXT,
+	sent_at    TEXT,
+	last_error TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS outbox_next ON outbox (next_at);
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	owner       TEXT NOT NULL,
+	key         TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	response    TEXT NOT NULL,
+	at          TEXT NOT NULL,
+	PRIMARY KEY (owner, key)
+);
+`
+
+// migrations bring databases made by older versions up to date, each one runs
+// once and is skipped if its change is already there
+var migrations = []string{
+	`ALTER TABLE submissions ADD COLUMN deleted_at TEXT`,
+	`ALTER TABLE submissions ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE submissions ADD COLUMN coffee TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE submissions ADD COLUMN owner TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS submissions_owner ON submissions (owner)`,
+}
+
+// deletedLayout writes deleted_at, the outbox's next_at and idempotency keys' at at a fixed width,
+// so comparing the text orders it by time, RFC3339Nano drops trailing zeros and doesn't
+const deletedLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// columns every query reads, in Submission's order
+const columns = `id, at, user, owner, value, email, coffee, deleted_at`
+
+// Store is the database, safe for every session to share
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its tables if needed
+func Open(path string) (*Store, error) {
+	// WAL lets readers carry on while a session writes,
+	// busy_timeout waits for the lock instead of failing straight away
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma": {"journal_mode(WAL)", "busy_timeout(5000)"},
+	}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, a single connection queues them in Go
+	// rather than bouncing off the lock
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, m := range migrations {
+		// SQLite has no ADD COLUMN IF NOT EXISTS, a duplicate column means it ran before
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Save records sub, its ID, At and DeletedAt are ignored, and creates the
+// order for its coffee under the same ID, which it returns
+// notify, if not nil, gives the messages to send about the saved submission,
+// they go in the outbox only if the submission is saved
+func (s *Store) Save(sub Submission, notify func(Submission) []Message) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, err := save(tx, sub, notify)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// save does Save's writes in tx
+func save(tx *sql.Tx, sub Submission, notify func(Submission) []Message) (int64, error) {
+	at := time.Now().UTC()
+	res, err := tx.Exec(`INSERT INTO submissions (at, user, owner, value, email, coffee) VALUES (?, ?, ?, ?, ?, ?)`,
+		at.Format(time.RFC3339Nano), sub.User, sub.Owner, sub.Value, sub.Email, sub.Coffee)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	created := orders.Event{OrderID: id, Seq: 1, Type: orders.Created, At: at, Actor: sub.User, Item: sub.Coffee}
+	if err := appendEvent(tx, created); err != nil {
+		return 0, err
+	}
+	if notify != nil {
+		sub.ID, sub.At = id, at
+		for _, m := range notify(sub) {
+			if err := enqueue(tx, m, at); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return id, nil
+}
+
+// Append records something that happened to an order, e from Order.NewEvent
+// It's ErrConflict when another event took e's place first
+func (s *Store) Append(e orders.Event) error {
+	err := appendEvent(s.db, e)
+	if isUnique(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// isUnique reports whether err is a row clashing with one that's already there
+func isUnique(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// execer is a *sql.DB or a *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func appendEvent(db execer, e orders.Event) error {
+	_, err := db.Exec(`INSERT INTO order_events (order_id, seq, type, at, actor, item) VALUES (?, ?, ?, ?, ?, ?)`,
+		e.OrderID, e.Seq, string(e.Type), e.At.UTC().Format(time.RFC3339Nano), e.Actor, e.Item)
+	return err
+}
+
+// Events returns order id's events in order, or every order's when id is 0,
+// ready for orders.Project
+func (s *Store) Events(id int64) ([]orders.Event, error) {
+	return events(s.db, id)
+}
+
+// querier is a *sql.DB or a *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func events(db querier, id int64) ([]orders.Event, error) {
+	rows, err := db.Query(`SELECT order_id, seq, type, at, actor, item FROM order_events
+		WHERE ? = 0 OR order_id = ? ORDER BY order_id, seq`, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []orders.Event
+	for rows.Next() {
+		var e orders.Event
+		var at string
+		if err := rows.Scan(&e.OrderID, &e.Seq, &e.Type, &at, &e.Actor, &e.Item); err != nil {
+			return nil, err
+		}
+		if e.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, fmt.Errorf("order %d event %d: %w", e.OrderID, e.Seq, err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// List returns every submission that isn't in the trash, oldest first
+func (s *Store) List() ([]Submission, error) {
+	return s.query(`SELECT ` + columns + ` FROM submissions WHERE deleted_at IS NULL ORDER BY id`)
+}
+
+// Recent returns the last n submissions that aren't in the trash, newest first
+func (s *Store) Recent(n int) ([]Submission, error) {
+	return s.query(`SELECT `+columns+` FROM submissions WHERE deleted_at IS NULL ORDER BY id DESC LIMIT ?`, n)
+}
+
+// Page returns n submissions that aren't in the trash, newest first, after
+// skipping offset of them, and how many there are in all
+// Only submissions up to ID top count, so the pages stay put while new ones
+// come in; a top of 0 is the newest
+func (s *Store) Page(top int64, offset, n int) ([]Submission, int, error) {
+	var total int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM submissions WHERE deleted_at IS NULL AND (? = 0 OR id <= ?)`, top, top).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	subs, err := s.query(`SELECT `+columns+` FROM submissions
+		WHERE deleted_at IS NULL AND (? = 0 OR id <= ?) ORDER BY id DESC LIMIT ? OFFSET ?`, top, top, n, offset)
+	return subs, total, err
+}
+
+// ByOwner returns owner's last n submissions that aren't in the trash, newest first
+func (s *Store) ByOwner(owner string, n int) ([]Submission, error) {
+	if owner == "" {
+		return nil, ErrNoUser
+	}
+	return s.query(`SELECT `+columns+` FROM submissions WHERE owner = ? AND deleted_at IS NULL ORDER BY id DESC LIMIT ?`, owner, n)
+}
+
+// Trash returns owner's submissions in the trash, most recently deleted first
+func (s *Store) Trash(owner string) ([]Submission, error) {
+	if owner == "" {
+		return nil, ErrNoUser
+	}
+	return s.query(`SELECT `+columns+` FROM submissions
+		WHERE deleted_at IS NOT NULL AND owner = ? ORDER BY deleted_at DESC, id DESC`, owner)
+}
+
+// TrashAll returns everyone's submissions in the trash, for admins
+func (s *Store) TrashAll() ([]Submission, error) {
+	return s.query(`SELECT ` + columns + ` FROM submissions
+		WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC`)
+}
+
+// Delete moves owner's submission id to the trash
+func (s *Store) Delete(id int64, owner string) error {
+	if owner == "" {
+		return ErrNoUser
+	}
+	return s.change(`UPDATE submissions SET deleted_at = ?
+		WHERE id = ? AND owner = ? AND deleted_at IS NULL`,
+		time.Now().UTC().Format(deletedLayout), id, owner)
+}
+
+// DeleteAny moves submission id to the trash whoever's it is, for admins
+func (s *Store) DeleteAny(id int64) error {
+	return s.change(`UPDATE submissions SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		time.Now().UTC().Format(deletedLayout), id)
+}
+
+// Restore takes owner's submission id back out of the trash
+func (s *Store) Restore(id int64, owner string) error {
+	if owner == "" {
+		return ErrNoUser
+	}
+	return s.change(`UPDATE submissions SET deleted_at = NULL
+		WHERE id = ? AND owner = ? AND deleted_at IS NOT NULL`, id, owner)
+}
+
+// RestoreAny takes submission id back out of the trash whoever's it is, for admins
+func (s *Store) RestoreAny(id int64) error {
+	return s.change(`UPDATE submissions SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+}
+
+// Expired lists what Purge with the same cutoff would remove, oldest first
+func (s *Store) Expired(cutoff time.Time) ([]Submission, error) {
+	return s.query(`SELECT `+columns+` FROM submissions
+		WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at, id`, cutoff.UTC().Format(deletedLayout))
+}
+
+// Purge removes everything that went in the trash before cutoff, for good
+// It returns how many submissions went
+func (s *Store) Purge(cutoff time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM submissions WHERE deleted_at IS NOT NULL AND deleted_at < ?`,
+		cutoff.UTC().Format(deletedLayout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// change runs an update meant for exactly one row, ErrNotFound when none matched
+func (s *Store) change(query string, args ...any) error {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) query(query string, args ...any) ([]Submission, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []Submission
+	for rows.Next() {
+		var sub Submission
+		var at string
+		var deletedAt sql.NullString
+		if err := rows.Scan(&sub.ID, &at, &sub.User, &sub.Owner, &sub.Value, &sub.Email, &sub.Coffee, &deletedAt); err != nil {
+			return nil, err
+		}
+		if sub.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, fmt.Errorf("submission %d: %w", sub.ID, err)
+		}
+		if deletedAt.Valid {
+			if sub.DeletedAt, err = time.Parse(time.RFC3339Nano, deletedAt.String); err != nil {
+				return nil, fmt.Errorf("submission %d: %w", sub.ID, err)
+			}
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Check runs SQLite's own consistency check on the database
+func (s *Store) Check() error {
+	var result string
+	if err := s.db.QueryRow(`PRAGMA quick_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("database is damaged: %s", result)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
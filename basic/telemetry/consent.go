@@ -0,0 +1,127 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Decision records whether a user agreed to send usage counts and when
+type Decision struct {
+	Allowed   bool      `json:"allowed"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// Consents keeps each user's decision in a JSON file
+// Every SSH session runs in its own goroutine, so access is guarded by a mutex
+type Consents struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewConsents returns a store that reads and writes the JSON file at path
+// The file is created on the first Decide
+func NewConsents(path string) *Consents {
+	return &Consents{path: path}
+}
+
+// Get returns user's decision, ok is false if they haven't been asked yet
+func (c *Consents) Get(user string) (d Decision, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	all, err := c.load()
+	if err != nil {
+		return Decision{}, false, err
+	}
+	d, ok = all[user]
+	return d, ok, nil
+}
+
+// Decide records user's decision, replacing any earlier one
+func (c *Consents) Decide(user string, allowed bool, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	all, err := c.load()
+	if err != nil {
+		return err
+	}
+	all[user] = Decision{Allowed: allowed, DecidedAt: at}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half a file behind
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// load reads the whole file; callers must hold c.mu
+func (c *Consents) load() (map[string]Decision, error) {
+	all := map[string]Decision{}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Check makes sure the consent file can be read and parsed
+// A missing file is fine, it just means nobody has been asked yet
+func (c *Consents) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.load()
+	return err
+}
+
+// DecidedMsg is sent once the user answers the consent screen
+type DecidedMsg struct {
+	Allowed bool
+}
+
+// ConsentModel asks the user whether to send usage counts
+type ConsentModel struct{}
+
+func (m ConsentModel) Update(msg tea.Msg) (ConsentModel, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "y":
+			return m, func() tea.Msg { return DecidedMsg{Allowed: true} }
+		case "n", "esc":
+			return m, func() tea.Msg { return DecidedMsg{Allowed: false} }
+		}
+	}
+	return m, nil
+}
+
+func (m ConsentModel) View() string {
+	return `Help improve this app?
+
+If you agree, we count which screens you open and which features you use,
+and send those totals to the developers every so often.
+
+  • only counts, added up across everyone who agreed
+  • no usernames, keys, addresses, or anything you type
+  • nothing is counted if you say no
+
+You can change your mind any time with ctrl+y.
+
+y to agree • n to decline`
+}
@@ -0,0 +1,131 @@
+// Package telemetry reports anonymous usage counts, such as which screens are
+// opened and which features are used, for users who opted in.
+//
+// Reports only contain event names and how often they happened in the last
+// period. Nothing identifies a user or a session, and users who didn't opt in
+// are never counted at all.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Report is the body POSTed to the endpoint
+type Report struct {
+	From   time.Time      `json:"from"`
+	To     time.Time      `json:"to"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Reporter counts events and sends them to an endpoint every interval
+// A nil *Reporter is valid and drops everything, that's telemetry turned off
+type Reporter struct {
+	endpoint string
+	interval time.Duration
+	client   *http.Client
+
+	mu     sync.Mutex
+	counts map[string]int
+	since  time.Time
+}
+
+// NewReporter returns a reporter sending to endpoint with client, or nil if endpoint is empty
+func NewReporter(endpoint string, interval time.Duration, client *http.Client) *Reporter {
+	if endpoint == "" {
+		return nil
+	}
+	return &Reporter{
+		endpoint: endpoint,
+		interval: interval,
+		client:   client,
+		counts:   map[string]int{},
+		since:    time.Now(),
+	}
+}
+
+// Enabled reports whether there is anywhere to send reports
+func (r *Reporter) Enabled() bool {
+	return r != nil
+}
+
+// Count adds one to event
+func (r *Reporter) Count(event string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[event]++
+}
+
+// Run sends a report every interval until ctx is done, then sends what's left
+func (r *Reporter) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	tick := time.NewTicker(r.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is already done, so the last report gets a context of its own
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			r.Flush(flushCtx)
+			cancel()
+			return
+		case <-tick.C:
+			r.Flush(ctx)
+		}
+	}
+}
+
+// Flush sends the counts so far and starts a new period
+// If sending fails the counts are kept for the next attempt
+func (r *Reporter) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	report := Report{From: r.since, To: time.Now(), Counts: r.counts}
+	r.counts = map[string]int{}
+	r.since = report.To
+	r.mu.Unlock()
+
+	if len(report.Counts) == 0 {
+		return nil
+	}
+	err := r.send(ctx, report)
+	if err != nil {
+		r.mu.Lock()
+		for event, n := range report.Counts {
+			r.counts[event] += n
+		}
+		r.since = report.From
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *Reporter) send(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package theme holds the app's styles: the accent color, the prompt, the box
+// around the input, hints, warnings and errors.
+//
+// Styles are built with the session's renderer, from bubbletea.MakeRenderer,
+// which asks the client's terminal for its background color. Colors are
+// lipgloss.AdaptiveColor pairs, so text stays readable on light and dark
+// terminals alike.
+package theme
+
+import "github.com/charmbracelet/lipgloss"
+
+// DefaultAccent is used until the user picks their own
+var DefaultAccent = lipgloss.AdaptiveColor{Light: "#5A56E0", Dark: "#7571F9"}
+
+var (
+	subtle = lipgloss.AdaptiveColor{Light: "#9B9B9B", Dark: "#5C5C5C"}
+	warn   = lipgloss.AdaptiveColor{Light: "#C46900", Dark: "#FFAF00"}
+	bad    = lipgloss.AdaptiveColor{Light: "#C4002B", Dark: "#FF5F87"}
+)
+
+// Theme is one session's set of styles
+type Theme struct {
+	// Dark is whether the client's terminal has a dark background
+	Dark bool
+	// Accent is the user's color, or DefaultAccent
+	Accent lipgloss.TerminalColor
+
+	// Name draws the user's name and other highlights in the accent color
+	Name lipgloss.Style
+	// Prompt is the question above the input
+	Prompt lipgloss.Style
+	// Input is the rounded box around the text input being typed in, Field is
+	// any other input, lined up with the text inside the box
+	Input lipgloss.Style
+	Field lipgloss.Style
+	// Banner is for announcements, Notice for things that must not be missed
+	Banner lipgloss.Style
+	Notice lipgloss.Style
+	// Hint, Warn and Error are for help text, nearing a limit and failures
+	Hint  lipgloss.Style
+	Warn  lipgloss.Style
+	Error lipgloss.Style
+
+	r *lipgloss.Renderer
+}
+
+// New builds the theme with the session's renderer
+// An empty accent is DefaultAccent
+func New(r *lipgloss.Renderer, accent string) Theme {
+	t := Theme{Dark: r.HasDarkBackground(), r: r}
+	return t.WithAccent(accent)
+}
+
+// WithAccent is the theme with another accent color, empty for DefaultAccent
+func (t Theme) WithAccent(accent string) Theme {
+	t.Accent = DefaultAccent
+	if accent != "" {
+		t.Accent = lipgloss.Color(accent)
+	}
+	r := t.r
+	t.Name = r.NewStyle().Foreground(t.Accent)
+	t.Prompt = r.NewStyle().Foreground(t.Accent).Bold(true)
+	t.Input = r.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(t.Accent).Padding(0, 1)
+	t.Field = r.NewStyle().Padding(0, 2)
+	t.Banner = r.NewStyle().Foreground(t.Accent).Bold(true)
+	t.Notice = r.NewStyle().Reverse(true).Bold(true)
+	t.Hint = r.NewStyle().Foreground(subtle)
+	t.Warn = r.NewStyle().Foreground(warn)
+	t.Error = r.NewStyle().Foreground(bad).Bold(true)
+	return t
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// timeTravel records every session's messages and states, set by --time-travel
+// It's meant for debugging, memory grows with every message up to maxFrames
+var timeTravel bool
+
+// maxFrames caps a session's history, the oldest frames are dropped first
+const maxFrames = 1000
+
+// frame is one step of a session: the message and the model it produced
+type frame struct {
+	msg   tea.Msg
+	after model
+}
+
+// timeline is a session's recorded history
+// Models are values, so a frame's copy is a snapshot of that moment
+// It's only touched from the program's own goroutine, so it needs no lock
+type timeline struct {
+	frames []frame
+	// at is the frame being looked at, -1 when not time traveling
+	at int
+}
+
+func newTimeline() *timeline {
+	return &timeline{at: -1}
+}
+
+// record adds a frame unless it's noise like cursor blinks and idle checks
+func (t *timeline) record(msg tea.Msg, after model) {
+	switch msg.(type) {
+	case lockMsg, idleMsg, queueMsg:
+		return
+	}
+	// Some cursor messages are unexported, so they're matched by package name
+	if strings.HasPrefix(fmt.Sprintf("%T", msg), "cursor.") {
+		return
+	}
+	// The snapshot doesn't need the history, and drawing it mustn't open this page again
+	after.timeline = nil
+	if len(t.frames) == maxFrames {
+		t.frames = t.frames[1:]
+	}
+	t.frames = append(t.frames, frame{msg: msg, after: after})
+}
+
+// traveling reports whether the developer page is showing
+func (t *timeline) traveling() bool {
+	return t != nil && t.at >= 0
+}
+
+// updateTimeline handles keys for the developer page
+// f12 opens and closes it, left and right step through the frames
+// handled is false for everything the page doesn't use, which goes on to update
+func (m model) updateTimeline(msg tea.Msg) (handled bool) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok || m.timeline == nil {
+		return false
+	}
+	t := m.timeline
+	if key.String() == "f12" {
+		if t.traveling() {
+			t.at = -1
+		} else if len(t.frames) > 0 {
+			t.at = len(t.frames) - 1
+		}
+		return true
+	}
+	if !t.traveling() {
+		return false
+	}
+	switch key.String() {
+	case "left", "h":
+		t.at = max(t.at-1, 0)
+	case "right", "l":
+		t.at = min(t.at+1, len(t.frames)-1)
+	case "home":
+		t.at = 0
+	case "end":
+		t.at = len(t.frames) - 1
+	case "esc":
+		t.at = -1
+	case "ctrl+c":
+		return false
+	}
+	return true
+}
+
+// timelineView shows the recorded frame being looked at
+func (m model) timelineView() string {
+	t := m.timeline
+	f := t.frames[t.at]
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "time travel • frame %d of %d\n", t.at+1, len(t.frames))
+	fmt.Fprintf(&sb, "message %T %+v\n", f.msg, f.msg)
+	sb.WriteString(strings.Repeat("─", 40) + "\n")
+	sb.WriteString(f.after.View())
+	sb.WriteString("\n" + strings.Repeat("─", 40) + "\n")
+	sb.WriteString("←/→ step • home/end • f12 or esc to return to the present")
+	return sb.String()
+}
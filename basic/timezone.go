@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// sessionZone picks the time zone a session's times are shown in:
+// the one the user saved, else TZ from the client's environment, else UTC
+// OpenSSH only forwards TZ with SendEnv TZ in ssh_config
+func sessionZone(s ssh.Session, saved string) string {
+	if saved != "" {
+		return saved
+	}
+	for _, kv := range s.Environ() {
+		if tz, ok := strings.CutPrefix(kv, "TZ="); ok {
+			// A leading colon means "read this zone file", the name after it still works
+			tz = strings.TrimPrefix(tz, ":")
+			if _, err := time.LoadLocation(tz); err == nil && tz != "" {
+				return tz
+			}
+		}
+	}
+	return "UTC"
+}
+
+// loadZone returns the named location, UTC if it can't be loaded
+func loadZone(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
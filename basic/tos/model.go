@@ -0,0 +1,71 @@
+package tos
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/hyperlink"
+)
+
+// AcceptedMsg is sent once the user accepts the document
+// The parent model decides what to do next (save it, show the app)
+type AcceptedMsg struct {
+	Version string
+}
+
+// Model shows the document in a scrollable viewport
+// Accepting is only allowed after scrolling to the bottom
+type Model struct {
+	vp viewport.Model
+	// read flips to true the first time the bottom is reached
+	// and stays true even if the user scrolls back up
+	read bool
+}
+
+// New creates the acceptance screen with a default size
+// The real size arrives with the first tea.WindowSizeMsg
+func New() Model {
+	vp := viewport.New(80, 20)
+	vp.SetContent(Document)
+	return Model{vp: vp, read: vp.AtBottom()}
+}
+
+// WithLinks makes the document's links clickable, for terminals that draw OSC 8 links
+func (m Model) WithLinks(on bool) Model {
+	m.vp.SetContent(hyperlink.Markdown(Document, on))
+	m.read = m.read || m.vp.AtBottom()
+	return m
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.vp.Width = msg.Width
+		// Leave room for the footer line
+		m.vp.Height = max(msg.Height-2, 1)
+	case tea.KeyMsg:
+		if msg.String() == "a" && m.read {
+			return m, func() tea.Msg { return AcceptedMsg{Version: Version} }
+		}
+	}
+
+	var cmd tea.Cmd
+	m.vp, cmd = m.vp.Update(msg)
+	if m.vp.AtBottom() {
+		m.read = true
+	}
+	return m, cmd
+}
+
+func (m Model) View() string {
+	footer := fmt.Sprintf("%3.f%% • scroll to the end to accept • ctrl+c to leave", m.vp.ScrollPercent()*100)
+	if m.read {
+		footer = "press a to accept • ctrl+c to leave"
+	}
+	return fmt.Sprintf("%s\n\n%s", m.vp.View(), footer)
+}
@@ -0,0 +1,103 @@
+// Package tos holds the Terms of Service document users must accept
+// before using the app, plus a small file-backed record of who accepted
+// which version and when.
+package tos
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Version identifies the current document
+// Bump it whenever tos.md changes so everyone is asked to accept again
+const Version = "2026-10-01"
+
+// Document is the markdown text shown in the acceptance screen
+//
+//go:embed tos.md
+var Document string
+
+// Acceptance records which version a user accepted and when
+type Acceptance struct {
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// Store keeps acceptances keyed by user in a JSON file
+// Every SSH session runs in its own goroutine, so access is guarded by a mutex
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStore returns a store that reads and writes the JSON file at path
+// The file is created on the first Accept
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Current reports whether user has accepted the current Version
+func (s *Store) Current(user string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	a, ok := all[user]
+	return ok && a.Version == Version, nil
+}
+
+// Accept records that user accepted version at the given time
+func (s *Store) Accept(user, version string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	all[user] = Acceptance{Version: version, AcceptedAt: at}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half a file behind
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// load reads the whole file; callers must hold s.mu
+func (s *Store) load() (map[string]Acceptance, error) {
+	all := map[string]Acceptance{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Check makes sure the acceptance file can be read and parsed
+// A missing file is fine, it just means nobody has accepted yet
+func (s *Store) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.load()
+	return err
+}
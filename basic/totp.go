@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/jwc20/wish-bubbletea-tests/basic/theme"
+	"github.com/jwc20/wish-bubbletea-tests/basic/totp"
+	"github.com/jwc20/wish-bubbletea-tests/basic/user"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// totpIssuer is what authenticator apps list the codes under
+const totpIssuer = "basic"
+
+// totpTries is how many wrong codes a session gets before it's closed
+const totpTries = 5
+
+// totpUsed is the step each key's code was last accepted for, so a code
+// someone saw over the user's shoulder can't be used again while it lasts
+var totpUsed = struct {
+	sync.Mutex
+	steps map[string]int64
+}{steps: map[string]int64{}}
+
+// totpPrompt asks users with a second factor for the code from their
+// authenticator app before they get to the app, see `totp enable`
+type totpPrompt struct {
+	input textinput.Model
+	tries int
+	err   string
+}
+
+func newTOTPPrompt() totpPrompt {
+	input := textinput.New()
+	input.Placeholder = "123456"
+	input.CharLimit = totp.Digits
+	input.Width = totp.Digits + 1
+	input.Focus()
+	return totpPrompt{input: input}
+}
+
+// totpResult is what a key did on the prompt
+type totpResult int
+
+const (
+	totpTyping totpResult = iota
+	totpWrong
+	totpRight
+)
+
+// update handles a message on the prompt, checking the code against the
+// profile for fingerprint on enter
+func (p totpPrompt) update(msg tea.Msg, fingerprint, name string) (totpPrompt, totpResult, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok && key.String() == "enter" {
+		if checkTOTP(fingerprint, name, p.input.Value()) {
+			return p, totpRight, textinput.Blink
+		}
+		p.tries++
+		log.Warn("Wrong authenticator code", "user", name, "tries", p.tries)
+		if p.tries >= totpTries {
+			return p, totpWrong, tea.Quit
+		}
+		p.err = "that's not the code, try the next one"
+		p.input.SetValue("")
+		return p, totpWrong, nil
+	}
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return p, totpTyping, cmd
+}
+
+// view asks name for the code
+func (p totpPrompt) view(name string, t theme.Theme) string {
+	view := fmt.Sprintf("Hi %s, enter the code from your authenticator app\n\n%s", name, p.input.View())
+	if p.err != "" {
+		view += "\n\n" + t.Error.Render(p.err)
+	}
+	return view + "\n\n" + t.Hint.Render("enter to check • ctrl+c to leave")
+}
+
+// updateTOTP handles messages until the user has given the right code
+func (m model) updateTOTP(msg tea.Msg) (model, tea.Cmd) {
+	var result totpResult
+	var cmd tea.Cmd
+	m.totp, result, cmd = m.totp.update(msg, m.fingerprint, m.user)
+	switch result {
+	case totpRight:
+		m.needsTOTP = false
+		m.trail.Log("totp", "ok", true)
+	case totpWrong:
+		m.trail.Log("totp", "ok", false, "tries", m.totp.tries)
+	}
+	return m, cmd
+}
+
+// checkTOTP reports whether code is the current one for fingerprint's profile and hasn't been used
+// The secret is read again rather than kept in the session, so turning the
+// second factor off or setting it up again applies straight away
+func checkTOTP(fingerprint, name, code string) bool {
+	p, ok, err := userStore.Get(fingerprint)
+	if err != nil {
+		log.Error("Could not load user profile", "user", name, "error", err)
+		return false
+	}
+	if !ok || p.TOTP == "" {
+		// Turned off since the session started
+		return ok
+	}
+	step, ok := totp.Verify(p.TOTP, code, now())
+	if !ok {
+		return false
+	}
+	totpUsed.Lock()
+	defer totpUsed.Unlock()
+	if step <= totpUsed.steps[fingerprint] {
+		return false
+	}
+	totpUsed.steps[fingerprint] = step
+	return true
+}
+
+// totpView asks for the code in place of the app
+func (m model) totpView() string {
+	return m.totp.view(m.name, m.theme)
+}
+
+// totpGate asks admins with a second factor for their code before the admin
+// view, or before they view the app as someone, which are run as next
+// next is started once the code is right, so its idle lock counts from then,
+// messages other than keys reach it before that so it knows the window's size
+type totpGate struct {
+	next        tea.Model
+	prompt      totpPrompt
+	name        string
+	fingerprint string
+	theme       theme.Theme
+}
+
+func newTOTPGate(s ssh.Session, next tea.Model) totpGate {
+	p, _ := user.FromContext(s.Context())
+	return totpGate{
+		next:        next,
+		prompt:      newTOTPPrompt(),
+		name:        user.CleanName(p.Name),
+		fingerprint: p.Fingerprint,
+		theme:       theme.New(bubbletea.MakeRenderer(s), p.Prefs.Accent),
+	}
+}
+
+func (g totpGate) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (g totpGate) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(tea.KeyMsg); !ok {
+		var cmd, blink tea.Cmd
+		g.next, cmd = g.next.Update(msg)
+		g.prompt.input, blink = g.prompt.input.Update(msg)
+		return g, tea.Batch(cmd, blink)
+	}
+	if key := msg.(tea.KeyMsg); key.String() == "ctrl+c" {
+		return g, tea.Quit
+	}
+	var result totpResult
+	var cmd tea.Cmd
+	g.prompt, result, cmd = g.prompt.update(msg, g.fingerprint, g.name)
+	if result == totpRight {
+		log.Info("Admin gave their authenticator code", "user", g.name)
+		// Once through, the gate steps out of the way
+		return g.next, g.next.Init()
+	}
+	return g, cmd
+}
+
+func (g totpGate) View() string {
+	return g.prompt.view(g.name, g.theme)
+}
+
+// hasTOTP reports whether the session's key has a second factor
+func hasTOTP(s ssh.Session) bool {
+	p, ok := user.FromContext(s.Context())
+	return ok && p.TOTP != ""
+}
+
+// totpCommand sets up or takes away a user's second factor, they're named
+// by their key's fingerprint or their profile's name
+func totpCommand(args []string) int {
+	if len(args) != 2 || args[0] != "enable" && args[0] != "disable" {
+		fmt.Fprintln(os.Stderr, "usage: totp enable|disable NAME|SHA256:FINGERPRINT")
+		return exitConfig
+	}
+	p, err := findProfile(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "totp: %v\n", err)
+		return exitError
+	}
+	if args[0] == "disable" {
+		if err := userStore.SetTOTP(p.Fingerprint, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "totp: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("✓ %s (%s) logs in with their key alone\n", p.Name, p.Fingerprint)
+		return exitOK
+	}
+	secret, err := totp.NewSecret()
+	if err == nil {
+		err = userStore.SetTOTP(p.Fingerprint, secret)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "totp: %v\n", err)
+		return exitError
+	}
+	uri := totp.URI(totpIssuer, p.Name, secret)
+	if q, err := qrcode.New(uri, qrcode.Low); err == nil {
+		fmt.Print(q.ToSmallString(false))
+	}
+	fmt.Printf("✓ %s (%s) is asked for a code from now on\nscan the code above in their authenticator app, or add it by hand:\n  secret %s\n  %s\n",
+		p.Name, p.Fingerprint, secret, uri)
+	return exitOK
+}
+
+// findProfile looks a user up by fingerprint, or by name when it isn't one
+// A name more than one key has taken is refused, the fingerprint says which
+func findProfile(who string) (user.Profile, error) {
+	var p user.Profile
+	var ok bool
+	var err error
+	if strings.HasPrefix(who, "SHA256:") {
+		p, ok, err = userStore.Get(who)
+	} else {
+		p, ok, err = userStore.FindByName(who)
+	}
+	if errors.Is(err, user.ErrAmbiguous) {
+		err = fmt.Errorf("%w, give the fingerprint of the one you mean instead", err)
+	}
+	if err == nil && !ok {
+		err = fmt.Errorf("no profile for %s, they need to connect with their key once first", who)
+	}
+	return p, err
+}
@@ -0,0 +1,88 @@
+// Package totp checks the six digit codes authenticator apps show, as
+// described in RFC 6238: an HMAC-SHA1 of the number of 30 second steps since
+// the Unix epoch, keyed with a secret shared when the app was set up.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Step is how long each code lasts
+const Step = 30 * time.Second
+
+// Digits is how long codes are
+const Digits = 6
+
+// skew is how many steps either side of now are accepted, for clocks that are a little off
+const skew = 1
+
+// encoding is how secrets are written, authenticator apps expect base32 without padding
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random secret, base32 encoded
+func NewSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(key), nil
+}
+
+// URI is the otpauth:// link authenticator apps take, usually as a QR code,
+// to set up codes for account at issuer
+func URI(issuer, account, secret string) string {
+	q := url.Values{"secret": {secret}, "issuer": {issuer}}
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + q.Encode()
+}
+
+// Verify reports whether code is right for secret around t, and which step it's
+// for, so callers can refuse a code that's already been used
+func Verify(secret, code string, t time.Time) (int64, bool) {
+	key, err := decode(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+	now := t.Unix() / int64(Step/time.Second)
+	for step := now - skew; step <= now+skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(at(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Code is the code for secret at t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return at(key, t.Unix()/int64(Step/time.Second)), nil
+}
+
+func decode(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("secret isn't base32: %w", err)
+	}
+	return key, nil
+}
+
+// at is the code for step, see RFC 4226 for the truncation
+func at(key []byte, step int64) string {
+	mac := hmac.New(sha1.New, key)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, n%1_000_000)
+}
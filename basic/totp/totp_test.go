@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 6238's test vectors, base32 encoded
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks the RFC's SHA-1 vectors, which are eight digits
+// long; six digit codes are their last six
+func TestCodeRFC6238(t *testing.T) {
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / int64(Step/time.Second)
+	for _, tt := range []struct {
+		name   string
+		code   string
+		at     time.Time
+		ok     bool
+		onStep int64
+	}{
+		{"now", "050471", now, true, step},
+		{"a step late", "050471", now.Add(Step), true, step},
+		{"a step early", "050471", now.Add(-Step), true, step},
+		{"two steps late", "050471", now.Add(2 * Step), false, 0},
+		{"wrong", "050472", now, false, 0},
+		{"too short", "50471", now, false, 0},
+	} {
+		got, ok := Verify(rfcSecret, tt.code, tt.at)
+		if ok != tt.ok || got != tt.onStep {
+			t.Errorf("%s: Verify = %d, %v, want %d, %v", tt.name, got, ok, tt.onStep, tt.ok)
+		}
+	}
+}
+
+func TestVerifyBadSecret(t *testing.T) {
+	if _, ok := Verify("not base32!", "050471", time.Unix(1111111111, 0)); ok {
+		t.Error("Verify accepted a code for a secret that isn't base32")
+	}
+}
+
+// TestSecretRoundTrip makes sure new secrets give codes that verify, padded or not
+func TestSecretRoundTrip(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Verify(secret, code, now); !ok {
+		t.Errorf("Verify refused the code for a new secret")
+	}
+	if _, ok := Verify(rfcSecret+"====", "050471", time.Unix(1111111111, 0)); !ok {
+		t.Errorf("Verify refused a padded secret")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/screens"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// trashRetention is how long deleted submissions can be restored, set by --trash-retention
+var trashRetention = 30 * 24 * time.Hour
+
+// purgeEvery is how often the trash is checked for submissions past retention
+const purgeEvery = time.Hour
+
+// shownSubmissions is how many of their submissions a user sees on the list
+const shownSubmissions = 20
+
+// purgeTrash removes submissions that have been in the trash longer than
+// trashRetention, once the database is open and then every purgeEvery until ctx is done
+// Idempotency keys older than keyRetention go at the same time, see exec.go
+func purgeTrash(ctx context.Context) {
+	select {
+	case <-warm.done:
+	case <-ctx.Done():
+		return
+	}
+	if warm.err != nil {
+		return
+	}
+	tick := time.NewTicker(purgeEvery)
+	defer tick.Stop()
+	for {
+		n, err := submissionStore.Purge(time.Now().Add(-trashRetention))
+		switch {
+		case err != nil:
+			log.Error("Could not purge the trash", "error", err)
+		case n > 0:
+			log.Info("Purged the trash", "submissions", n, "older-than", trashRetention)
+		}
+		// Idempotency keys are only needed while a script might still retry
+		if n, err := submissionStore.Forget(time.Now().Add(-keyRetention)); err != nil {
+			log.Error("Could not forget old idempotency keys", "error", err)
+		} else if n > 0 {
+			log.Debug("Forgot old idempotency keys", "keys", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// openSubmissions shows the user's submissions and trash
+func (m model) openSubmissions() (model, tea.Cmd) {
+	m.count("screen.submissions")
+	m.nav = m.nav.Push(screens.NewSubmissions(m.format, trashRetention))
+	return m, m.loadSubmissions("")
+}
+
+// loadSubmissions reads the user's submissions and trash for the Submissions screen
+func (m model) loadSubmissions(status string) tea.Cmd {
+	user, owner := m.user, m.owner()
+	return func() tea.Msg {
+		msg := screens.SubmissionsMsg{At: now(), Status: status}
+		var err error
+		if msg.Live, err = submissionStore.ByOwner(owner, shownSubmissions); err == nil {
+			msg.Trash, err = submissionStore.Trash(owner)
+		}
+		if err != nil {
+			log.Error("Could not load submissions", "user", user, "error", err)
+			msg.Err = "couldn't load your submissions, please try again"
+		}
+		return msg
+	}
+}
+
+// trashedMsg is what moving a submission to the trash, or back, came to
+// Err is what the user is told when it didn't work
+type trashedMsg struct {
+	ID      int64
+	Restore bool
+	Err     string
+}
+
+// deleteSubmission moves one of the user's submissions to the trash
+func (m model) deleteSubmission(id int64) (model, tea.Cmd) {
+	if m.readOnly {
+		return m, m.loadSubmissions("read-only while viewing as " + m.user)
+	}
+	owner := m.owner()
+	return m, func() tea.Msg {
+		chaos.slowStorage()
+		if err := submissionStore.Delete(id, owner); err != nil {
+			return trashedMsg{ID: id, Err: trashError("delete", err)}
+		}
+		return trashedMsg{ID: id}
+	}
+}
+
+// restoreSubmission takes one of the user's submissions out of the trash
+func (m model) restoreSubmission(id int64) (model, tea.Cmd) {
+	if m.readOnly {
+		return m, m.loadSubmissions("read-only while viewing as " + m.user)
+	}
+	owner := m.owner()
+	return m, func() tea.Msg {
+		chaos.slowStorage()
+		if err := submissionStore.Restore(id, owner); err != nil {
+			return trashedMsg{ID: id, Restore: true, Err: trashError("restore", err)}
+		}
+		return trashedMsg{ID: id, Restore: true}
+	}
+}
+
+// trashed records a delete or restore and shows the list as it is now
+func (m model) trashed(msg trashedMsg) (model, tea.Cmd) {
+	if msg.Err != "" {
+		return m, m.loadSubmissions(msg.Err)
+	}
+	if msg.Restore {
+		m.count("feature.restored")
+		m.trail.Log("restore", "user", m.user, "submission", msg.ID)
+		m.audit("impersonate.restored", fmt.Sprint(msg.ID))
+		return m, m.loadSubmissions("restored")
+	}
+	m.count("feature.deleted")
+	m.trail.Log("delete", "user", m.user, "submission", msg.ID)
+	m.audit("impersonate.deleted", fmt.Sprint(msg.ID))
+	return m, m.loadSubmissions(fmt.Sprintf("moved to the trash, it can be restored for %s", inDays(trashRetention)))
+}
+
+// trashError is what the user is told when a delete or restore fails
+func trashError(action string, err error) string {
+	if errors.Is(err, storage.ErrNotFound) {
+		// Usually a purge or another session got there first
+		return "that submission is gone, the list is up to date now"
+	}
+	log.Error("Could not "+action+" submission", "error", err)
+	return "couldn't " + action + " that, please try again"
+}
+
+// inDays says how long d is in days, or hours when it's less than two
+func inDays(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
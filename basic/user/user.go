@@ -0,0 +1,340 @@
+// Package user keeps a persistent profile for everyone who connects with a
+// public key, keyed by the key's SHA256 fingerprint.
+//
+// The profile is created on the first connection and handed to the app
+// through the session context, see Middleware and FromContext.
+//
+// Each profile has a version that goes up whenever its preferences change.
+// A session that saves with UpdatePrefsIf gets a *ConflictError, rather than
+// silently overwriting, when another session saved since it last looked.
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/jwc20/wish-bubbletea-tests/basic/lru"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Profile is what we remember about one key
+type Profile struct {
+	Fingerprint string    `json:"fingerprint"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	// LastSeen is when the key last connected, zero until its second connection
+	LastSeen time.Time `json:"last_seen,omitzero"`
+	Prefs    Prefs     `json:"prefs"`
+	// Version counts changes to Prefs, LastSeen is bookkeeping and doesn't count
+	Version int `json:"version"`
+	// TOTP is the base32 secret of the user's authenticator app, empty when
+	// they don't have a second factor, see SetTOTP
+	TOTP string `json:"totp,omitempty"`
+}
+
+// Prefs are settings the user chose in the app
+type Prefs struct {
+	// Accent is the theme's accent color, empty for the default
+	Accent string `json:"accent,omitempty"`
+	// TimeZone is the IANA name times are shown in, empty to go by the client's TZ
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// cacheSize is how many profiles are kept in memory
+const cacheSize = 1024
+
+// Store keeps profiles keyed by fingerprint in a JSON file
+// Every SSH session runs in its own goroutine, so access is guarded by a mutex
+//
+// Profiles that were read recently are cached, so a returning key doesn't read
+// and parse the whole file. The cache is dropped whenever the file changes
+// under us, e.g. when `seed` or an operator edits it while the server runs
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	cache   *lru.Cache[string, Profile]
+	modTime time.Time // of the file when the cache was last valid
+}
+
+// NewStore returns a store that reads and writes the JSON file at path
+// The file is created when the first profile is
+func NewStore(path string) *Store {
+	return &Store{path: path, cache: lru.New[string, Profile](cacheSize)}
+}
+
+// FindOrCreate returns the profile for fingerprint, creating it named name if it's new
+func (s *Store) FindOrCreate(fingerprint, name string, at time.Time) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revalidate()
+	if p, ok := s.cache.Get(fingerprint); ok {
+		return p, nil
+	}
+	all, err := s.load()
+	if err != nil {
+		return Profile{}, err
+	}
+	if p, ok := all[fingerprint]; ok {
+		s.cache.Add(fingerprint, p)
+		return p, nil
+	}
+	p := Profile{Fingerprint: fingerprint, Name: name, CreatedAt: at}
+	all[fingerprint] = p
+	if err := s.save(all); err != nil {
+		return Profile{}, err
+	}
+	s.cache.Add(fingerprint, p)
+	return p, nil
+}
+
+// ErrAmbiguous is returned by FindByName when more than one key has a profile with the name
+var ErrAmbiguous = errors.New("more than one key has a profile with that name")
+
+// FindByName returns the profile named name, false if there's none
+// Names are whatever the client connected as, so they aren't unique, and
+// anyone can take one with a new key; when several profiles share the name
+// it's an ErrAmbiguous listing their fingerprints, rather than a guess
+func (s *Store) FindByName(name string) (Profile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.load()
+	if err != nil {
+		return Profile{}, false, err
+	}
+	var found []Profile
+	for _, p := range all {
+		if p.Name == name {
+			found = append(found, p)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Profile{}, false, nil
+	case 1:
+		return found[0], true, nil
+	}
+	fingerprints := make([]string, len(found))
+	for i, p := range found {
+		fingerprints[i] = p.Fingerprint
+	}
+	slices.Sort(fingerprints)
+	return Profile{}, false, fmt.Errorf("%w: %s", ErrAmbiguous, strings.Join(fingerprints, ", "))
+}
+
+// Get returns the profile for fingerprint, false if there's none
+func (s *Store) Get(fingerprint string) (Profile, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revalidate()
+	if p, ok := s.cache.Get(fingerprint); ok {
+		return p, true, nil
+	}
+	all, err := s.load()
+	if err != nil {
+		return Profile{}, false, err
+	}
+	p, ok := all[fingerprint]
+	if ok {
+		s.cache.Add(fingerprint, p)
+	}
+	return p, ok, nil
+}
+
+// Touch records that fingerprint connected at, for the next connection's LastSeen
+func (s *Store) Touch(fingerprint string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revalidate()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	p, ok := all[fingerprint]
+	if !ok {
+		return errors.New("no profile for " + fingerprint)
+	}
+	p.LastSeen = at
+	all[fingerprint] = p
+	s.cache.Remove(fingerprint)
+	return s.save(all)
+}
+
+// SetTOTP gives fingerprint's profile the authenticator secret, empty to take it away
+// Like LastSeen it's not a preference, so the version stays as it is
+func (s *Store) SetTOTP(fingerprint, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revalidate()
+	all, err := s.load()
+	if err != nil {
+		return err
+	}
+	p, ok := all[fingerprint]
+	if !ok {
+		return errors.New("no profile for " + fingerprint)
+	}
+	p.TOTP = secret
+	all[fingerprint] = p
+	s.cache.Remove(fingerprint)
+	return s.save(all)
+}
+
+// ConflictError is returned by UpdatePrefsIf when the profile changed since
+// the version the caller had, Current is what it is now
+type ConflictError struct {
+	Current Profile
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("profile %s changed, it's at version %d", e.Current.Fingerprint, e.Current.Version)
+}
+
+// UpdatePrefs changes the preferences of an existing profile, whatever its version
+func (s *Store) UpdatePrefs(fingerprint string, update func(*Prefs)) error {
+	_, err := s.UpdatePrefsIf(fingerprint, -1, update)
+	return err
+}
+
+// UpdatePrefsIf changes the preferences of an existing profile if it's still at
+// version, or at any version when version is negative, and returns the profile
+// as saved. A profile at another version isn't changed, the error is a *ConflictError
+func (s *Store) UpdatePrefsIf(fingerprint string, version int, update func(*Prefs)) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revalidate()
+	all, err := s.load()
+	if err != nil {
+		return Profile{}, err
+	}
+	p, ok := all[fingerprint]
+	if !ok {
+		return Profile{}, errors.New("no profile for " + fingerprint)
+	}
+	if version >= 0 && p.Version != version {
+		return Profile{}, &ConflictError{Current: p}
+	}
+	update(&p.Prefs)
+	p.Version++
+	all[fingerprint] = p
+	// Dropped rather than updated, so a failed save can't leave the cache ahead of the file
+	s.cache.Remove(fingerprint)
+	return p, s.save(all)
+}
+
+// revalidate drops the cache if the file changed since it was last read or written
+// by this store; callers must hold s.mu
+func (s *Store) revalidate() {
+	var modTime time.Time
+	if info, err := os.Stat(s.path); err == nil {
+		modTime = info.ModTime()
+	}
+	if !modTime.Equal(s.modTime) {
+		s.cache.Purge()
+		s.modTime = modTime
+	}
+}
+
+// load reads the whole file; callers must hold s.mu
+func (s *Store) load() (map[string]Profile, error) {
+	all := map[string]Profile{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// save writes the whole file; callers must hold s.mu
+func (s *Store) save(all map[string]Profile) error {
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file and rename so a crash never leaves half a file behind
+	// Only the server's user can read it, it has authenticator secrets in it
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	// Our own write doesn't make the cache stale
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Check makes sure the profile file can be read and parsed
+// A missing file is fine, it just means nobody has connected with a key yet
+func (s *Store) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.load()
+	return err
+}
+
+// CleanName replaces control characters in a name the client chose, so
+// drawing it in someone else's terminal can't send escape sequences there
+func CleanName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f || r >= 0x80 && r < 0xa0 {
+			return '�'
+		}
+		return r
+	}, name)
+}
+
+// contextKey stores the session's Profile in the ssh context
+type contextKey struct{}
+
+// Middleware looks up the profile for the session's key and puts it in the context
+// Sessions without a key, or whose profile can't be loaded, go on without one
+// The profile's LastSeen is from before this session, the store has the new time
+func Middleware(store *Store) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if pk := s.PublicKey(); pk != nil {
+				p, err := store.FindOrCreate(gossh.FingerprintSHA256(pk), CleanName(s.User()), time.Now())
+				if err != nil {
+					log.Error("Could not load user profile", "user", s.User(), "error", err)
+				} else {
+					s.Context().SetValue(contextKey{}, p)
+					if err := store.Touch(p.Fingerprint, time.Now()); err != nil {
+						log.Error("Could not update user profile", "user", s.User(), "error", err)
+					}
+				}
+			}
+			next(s)
+		}
+	}
+}
+
+// FromContext returns the profile Middleware found, false for anonymous sessions
+func FromContext(ctx ssh.Context) (Profile, bool) {
+	p, ok := ctx.Value(contextKey{}).(Profile)
+	return p, ok
+}
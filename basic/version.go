@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/outbound"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Anything left unset is filled in from the module's VCS stamp where possible
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns the version, commit and build date of this binary
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.time" && d == "":
+				d = s.Value
+			}
+		}
+	}
+	return v, c, d
+}
+
+// versionCommand prints the build info for the `version` subcommand
+func versionCommand() int {
+	v, c, d := buildInfo()
+	fmt.Printf("version %s\ncommit  %s\nbuilt   %s\n", v, orUnknown(c), orUnknown(d))
+	return exitOK
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// checkForUpdate warns when the release at url is newer than this build
+// url returns a GitHub style release, e.g.
+// https://api.github.com/repos/OWNER/REPO/releases/latest
+// It's only advice, so failures are logged at debug level and startup carries on
+func checkForUpdate(ctx context.Context, url string) {
+	if version == "dev" {
+		log.Debug("Skipping update check for a dev build")
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		log.Debug("Update check failed", "error", err)
+		return
+	}
+	resp, err := outboundPolicies.Get(outbound.UpdateCheck).Client().Do(req)
+	if err != nil {
+		log.Debug("Update check failed", "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		log.Debug("Update check failed", "error", err)
+		return
+	}
+	if newerVersion(release.TagName, version) {
+		log.Warn("A newer release is available", "running", version, "latest", release.TagName)
+	}
+}
+
+// newerVersion reports whether a is a later vMAJOR.MINOR.PATCH than b
+// Versions that don't parse are never newer, so odd tags don't cause warnings
+func newerVersion(a, b string) bool {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return false
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(s string) ([3]int, bool) {
+	var v [3]int
+	// Pre-release and build suffixes are ignored, "v1.2.3-rc1" counts as 1.2.3
+	s, _, _ = strings.Cut(strings.TrimPrefix(s, "v"), "-")
+	s, _, _ = strings.Cut(s, "+")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
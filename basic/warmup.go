@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+	"github.com/jwc20/wish-bubbletea-tests/basic/prompt"
+	"github.com/jwc20/wish-bubbletea-tests/basic/storage"
+)
+
+// warmStep is one subsystem to get ready before sessions can use the app
+type warmStep struct {
+	name string
+	run  func() error
+}
+
+// warmup runs the steps concurrently while the server is already accepting
+// Sessions that arrive first see a short "warming up" screen instead of errors
+type warmup struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+func newWarmup() *warmup {
+	return &warmup{done: make(chan struct{})}
+}
+
+// warm tracks the server's warm-up, see main
+var warm = newWarmup()
+
+// run runs every step at once and returns their combined error
+func (w *warmup) run(steps []warmStep) error {
+	start := time.Now()
+	errs := make([]error, len(steps))
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stepStart := time.Now()
+			errs[i] = step.run()
+			log.Debug("Warm-up step done", "step", step.name, "took", time.Since(stepStart), "error", errs[i])
+		}()
+	}
+	wg.Wait()
+	w.err = errors.Join(errs...)
+	close(w.done)
+	if w.err == nil {
+		log.Info("Ready", "warm-up", time.Since(start).Round(time.Millisecond))
+	}
+	return w.err
+}
+
+// ready reports whether warm-up finished without problems
+func (w *warmup) ready() bool {
+	select {
+	case <-w.done:
+		return w.err == nil
+	default:
+		return false
+	}
+}
+
+// warmedMsg tells a waiting session that the server is ready
+type warmedMsg struct{}
+
+// waitForWarm is a command that blocks until warm-up finishes
+// If it failed the server is shutting down, and the drain ends the session
+func waitForWarm(w *warmup) tea.Cmd {
+	return func() tea.Msg {
+		<-w.done
+		if w.err != nil {
+			return nil
+		}
+		return warmedMsg{}
+	}
+}
+
+// warmingView is shown to sessions that connect before the server is ready
+func warmingView() string {
+	return "warming up, one moment…"
+}
+
+// dataChecks open and check everything that reads the app's data
+// Startup runs them as warm-up steps, the `check` subcommand runs them in turn
+func dataChecks(dbPath string) []warmStep {
+	return []warmStep{
+		{"storage", func() error { return openStorage(dbPath) }},
+		{"profiles", func() error {
+			if err := userStore.Check(); err != nil {
+				return checkProblem{
+					what: "user profiles",
+					err:  err,
+					fix:  "fix users.json, removing it loses everyone's names and preferences",
+				}
+			}
+			return nil
+		}},
+		{"stores", func() error {
+			var problems []error
+			if err := tosStore.Check(); err != nil {
+				problems = append(problems, checkProblem{
+					what: "ToS acceptance store",
+					err:  err,
+					fix:  "fix or remove tos.json, removing it asks every user to accept again",
+				})
+			}
+			if err := macroStore.Check(); err != nil {
+				problems = append(problems, checkProblem{
+					what: "macro store",
+					err:  err,
+					fix:  "fix or remove macros.json, removing it deletes everyone's macros",
+				})
+			}
+			if err := usageConsents.Check(); err != nil {
+				problems = append(problems, checkProblem{
+					what: "telemetry consent store",
+					err:  err,
+					fix:  "fix or remove telemetry.json, removing it asks every user again",
+				})
+			}
+			return errors.Join(problems...)
+		}},
+		{"content", func() error {
+			if err := prompt.Check(contentFS()); err != nil {
+				return checkProblem{
+					what: "prompt templates",
+					err:  err,
+					fix:  "fix the JSON or template syntax in that file",
+				}
+			}
+			return nil
+		}},
+	}
+}
+
+// openStorage opens and checks the submission database as submissionStore
+func openStorage(path string) error {
+	chaos.slowStorage()
+	db, err := storage.Open(path)
+	if err != nil {
+		return checkProblem{what: "submission database", err: err, fix: "check --db and the directory's permissions"}
+	}
+	if err := db.Check(); err != nil {
+		db.Close()
+		return checkProblem{
+			what: "submission database",
+			err:  err,
+			fix:  "restore submissions.db from a backup, or try sqlite3's .recover",
+		}
+	}
+	submissionStore = db
+	return nil
+}